@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (m *ComfyUIMock) handleQueueReorder(c *gin.Context) {
+	var request struct {
+		PromptID string `json:"prompt_id" binding:"required"`
+		Position string `json:"position" binding:"required,oneof=front back"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 共享队列的编号需要在持锁之前分配
+	id := 0
+	if request.Position == "back" && m.store != nil {
+		m.mu.Lock()
+		clientID := ""
+		if prompt, ok := m.prompts[request.PromptID]; ok {
+			clientID = prompt.ClientID
+		}
+		m.mu.Unlock()
+		id = m.sharedQueueID(clientID)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prompt, exists := m.prompts[request.PromptID]
+	if !exists || prompt.Status != "pending" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prompt not found in queue"})
+		return
+	}
+
+	// 调整的位置优先于优先级，否则优先级不同时 front 不起作用。
+	// back 分配新的队列编号；front 保留原编号，避免编号减到 0 或负数
+	m.reorderSeq++
+	m.removePending(prompt)
+	switch request.Position {
+	case "front":
+		prompt.Pinned = m.reorderSeq
+		m.pending = append([]*PromptInfo{prompt}, m.pending...)
+	case "back":
+		prompt.Pinned = -m.reorderSeq
+		if id == 0 {
+			id = m.nextQueueID(prompt.ClientID)
+		}
+		prompt.ID = id
+		m.pending = append(m.pending, prompt)
+	}
+
+	m.persist(prompt)
+
+	c.JSON(http.StatusOK, gin.H{"prompt_id": prompt.PromptID, "number": prompt.ID})
+}
+
+// handleQueuePause 暂停执行，模拟卡住的 GPU：prompt 仍可入队，执行中的 prompt 停在当前节点
+func (m *ComfyUIMock) handleQueuePause(c *gin.Context) {
+	m.mu.Lock()
+	if m.resumed == nil {
+		m.resumed = make(chan struct{})
+	}
+	m.mu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"paused": true})
+}
+
+func (m *ComfyUIMock) handleQueueResume(c *gin.Context) {
+	m.mu.Lock()
+	if m.resumed != nil {
+		close(m.resumed)
+		m.resumed = nil
+	}
+	m.mu.Unlock()
+
+	m.notifyQueue()
+	c.JSON(http.StatusOK, gin.H{"paused": false})
+}
+
+// waitResumed 暂停期间阻塞，ctx 被取消时返回 false
+func (m *ComfyUIMock) waitResumed(ctx context.Context) bool {
+	m.mu.Lock()
+	resumed := m.resumed
+	m.mu.Unlock()
+	if resumed == nil {
+		return true
+	}
+
+	select {
+	case <-resumed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
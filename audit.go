@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAuditEntries 是内存中保留的审计记录条数，--audit-log 文件中保留全部记录
+const maxAuditEntries = 10000
+
+// auditDetailsKey 和 auditActionKey 是 handler 补充审计信息时使用的 gin.Context 键
+const (
+	auditDetailsKey = "mock.audit.details"
+	auditActionKey  = "mock.audit.action"
+)
+
+// auditActions 是改变状态的接口对应的审计动作，不在表中的 POST、PUT、PATCH 和 DELETE 请求按 "方法 路由" 记录
+var auditActions = map[string]string{
+	"POST /prompt":             "submit",
+	"POST /prompt/batch":       "submit_batch",
+	"POST /queue":              "queue_update",
+	"DELETE /queue/:prompt_id": "queue_delete",
+	"POST /interrupt":          "interrupt",
+	"POST /history":            "history_delete",
+	"POST /free":               "free",
+	"POST /upload/image":       "upload_image",
+	"POST /upload/mask":        "upload_mask",
+	"POST /users":              "user_create",
+	"POST /userdata/*file":     "userdata_write",
+	"DELETE /userdata/*file":   "userdata_delete",
+	"POST /settings":           "settings_update",
+	"POST /settings/:id":       "settings_update",
+	"POST /__mock/drain":       "drain",
+	"DELETE /__mock/drain":     "drain_cancel",
+}
+
+// auditReadOnly 是不改变状态的 POST 接口，不记录
+var auditReadOnly = map[string]bool{
+	"POST /validate":       true,
+	"POST /__mock/dedupe":  true,
+	"POST /__mock/convert": true,
+}
+
+// auditEntry 是一条审计记录，time 按 --clock-skew 偏移
+type auditEntry struct {
+	Seq      int                    `json:"seq"`
+	Time     time.Time              `json:"time"`
+	Action   string                 `json:"action"`
+	Method   string                 `json:"method"`
+	Path     string                 `json:"path"`
+	Status   int                    `json:"status"`
+	ClientIP string                 `json:"client_ip"`
+	ClientID string                 `json:"client_id,omitempty"`
+	User     string                 `json:"user,omitempty"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+}
+
+// auditLog 是只追加的审计日志，配置了 --audit-log 时同时以 JSON Lines 追加写入文件，重启后从文件恢复
+type auditLog struct {
+	mu      sync.Mutex
+	entries []auditEntry
+	seq     int
+	file    *os.File
+	enc     *json.Encoder
+}
+
+func newAuditLog(path string) (*auditLog, error) {
+	a := &auditLog{}
+	if path == "" {
+		return a, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("打开审计日志失败: %w", err)
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("读取审计日志失败: %w", err)
+		}
+		a.keep(entry)
+		a.seq = max(a.seq, entry.Seq)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("读取审计日志失败: %w", err)
+	}
+
+	a.file = file
+	a.enc = json.NewEncoder(file)
+	return a, nil
+}
+
+// keep 将记录加入内存，调用方需持有 a.mu
+func (a *auditLog) keep(entry auditEntry) {
+	a.entries = append(a.entries, entry)
+	if len(a.entries) > maxAuditEntries {
+		a.entries = a.entries[len(a.entries)-maxAuditEntries:]
+	}
+}
+
+func (a *auditLog) record(entry auditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.seq++
+	entry.Seq = a.seq
+	a.keep(entry)
+	if a.enc != nil {
+		if err := a.enc.Encode(entry); err != nil {
+			fmt.Printf("写入审计日志失败: %v\n", err)
+		}
+	}
+}
+
+// auditDetail 由 handler 补充审计记录的内容，如提交的 prompt_id
+func auditDetail(c *gin.Context, key string, value interface{}) {
+	stored, _ := c.Get(auditDetailsKey)
+	details, _ := stored.(map[string]interface{})
+	if details == nil {
+		details = map[string]interface{}{}
+		c.Set(auditDetailsKey, details)
+	}
+	details[key] = value
+}
+
+// auditMiddleware 在请求结束后记录所有改变状态的请求，包括失败的请求
+func (m *ComfyUIMock) auditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		method := c.Request.Method
+		if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions || c.FullPath() == "" {
+			return
+		}
+		route := method + " " + c.FullPath()
+		if auditReadOnly[route] {
+			return
+		}
+
+		action, ok := auditActions[route]
+		if override := c.GetString(auditActionKey); override != "" {
+			action = override
+		} else if !ok {
+			action = route
+		}
+		stored, _ := c.Get(auditDetailsKey)
+		details, _ := stored.(map[string]interface{})
+		clientID := c.Query("client_id")
+		if value, ok := details["client_id"].(string); ok {
+			clientID = value
+			delete(details, "client_id")
+		}
+		if len(details) == 0 {
+			details = nil
+		}
+
+		m.audit.record(auditEntry{
+			Time:     m.clock.report(time.Now()),
+			Action:   action,
+			Method:   method,
+			Path:     c.Request.URL.Path,
+			Status:   c.Writer.Status(),
+			ClientIP: c.ClientIP(),
+			ClientID: clientID,
+			User:     c.GetHeader("comfy-user"),
+			Details:  details,
+		})
+	}
+}
+
+// handleAudit 按时间顺序返回审计记录，可以按 action、client_id、since (seq) 过滤，limit 限制返回最新的条数
+func (m *ComfyUIMock) handleAudit(c *gin.Context) {
+	since, limit := 0, 0
+	var err error
+	if value := c.Query("since"); value != "" {
+		if since, err = strconv.Atoi(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since: " + value})
+			return
+		}
+	}
+	if value := c.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: " + value})
+			return
+		}
+	}
+	action, clientID := c.Query("action"), c.Query("client_id")
+
+	m.audit.mu.Lock()
+	entries := []auditEntry{}
+	for _, entry := range m.audit.entries {
+		if entry.Seq <= since || (action != "" && entry.Action != action) || (clientID != "" && entry.ClientID != clientID) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	m.audit.mu.Unlock()
+
+	total := len(entries)
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "total": total})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsBackpressure 模拟慢速客户端：消息先进入每个连接的发送队列，由单独的 goroutine 延迟或批量写出
+type wsBackpressure struct {
+	delay  time.Duration
+	batch  time.Duration
+	buffer int
+	// overflow 为 close 时队列满后断开连接，为 drop 时丢弃新消息
+	overflow string
+}
+
+func (b wsBackpressure) enabled() bool {
+	return b.delay > 0 || b.batch > 0 || b.buffer > 0
+}
+
+var errSendQueueClosed = errors.New("WebSocket 连接已关闭")
+
+type queuedMessage struct {
+	kind int
+	data []byte
+}
+
+type sendQueue struct {
+	client   *wsClient
+	config   wsBackpressure
+	messages chan queuedMessage
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newSendQueue(client *wsClient, config wsBackpressure) *sendQueue {
+	if config.buffer <= 0 {
+		config.buffer = 256
+	}
+	q := &sendQueue{
+		client:   client,
+		config:   config,
+		messages: make(chan queuedMessage, config.buffer),
+		done:     make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+func (q *sendQueue) push(kind int, data []byte) error {
+	select {
+	case <-q.done:
+		return errSendQueueClosed
+	default:
+	}
+
+	select {
+	case q.messages <- queuedMessage{kind: kind, data: data}:
+		return nil
+	default:
+	}
+
+	if q.config.overflow == "drop" {
+		return fmt.Errorf("WebSocket 发送队列已满 (%d)，丢弃消息", q.config.buffer)
+	}
+	q.client.closeWith(websocket.ClosePolicyViolation, "slow consumer: send queue overflow")
+	return fmt.Errorf("WebSocket 发送队列已满 (%d)，断开连接", q.config.buffer)
+}
+
+// run 逐条延迟写出，配置了 batch 时每个周期集中写出队列中的所有消息
+func (q *sendQueue) run() {
+	for {
+		var message queuedMessage
+		select {
+		case message = <-q.messages:
+		case <-q.done:
+			return
+		}
+
+		if q.config.batch > 0 {
+			select {
+			case <-time.After(q.config.batch):
+			case <-q.done:
+				return
+			}
+			if !q.write(message) {
+				return
+			}
+			for drained := false; !drained; {
+				select {
+				case message = <-q.messages:
+					if !q.write(message) {
+						return
+					}
+				default:
+					drained = true
+				}
+			}
+			continue
+		}
+
+		select {
+		case <-time.After(q.config.delay):
+		case <-q.done:
+			return
+		}
+		if !q.write(message) {
+			return
+		}
+	}
+}
+
+func (q *sendQueue) write(message queuedMessage) bool {
+	q.client.mu.Lock()
+	err := q.client.conn.WriteMessage(message.kind, message.data)
+	q.client.mu.Unlock()
+	if err != nil {
+		q.stop()
+		return false
+	}
+	return true
+}
+
+func (q *sendQueue) stop() {
+	q.once.Do(func() { close(q.done) })
+}
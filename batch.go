@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// batchItem 是批量提交中的单个 workflow，字段与 /prompt 的请求体相同，client_id 和 extra_data 缺省时使用批量请求的值
+type batchItem struct {
+	ClientID  string                 `json:"client_id"`
+	Prompt    map[string]interface{} `json:"prompt"`
+	ExtraData map[string]interface{} `json:"extra_data"`
+}
+
+// handlePromptBatch 一次提交多个 workflow，ComfyUI 没有这个接口。
+// 所有 workflow 先全部检查，任一不合法时整批拒绝；合法时在同一次加锁中按顺序进入队列，编号连续，不会与其他请求交错
+func (m *ComfyUIMock) handlePromptBatch(c *gin.Context) {
+	if m.rejectDraining(c) {
+		return
+	}
+	var request struct {
+		ClientID  string                 `json:"client_id"`
+		ExtraData map[string]interface{} `json:"extra_data"`
+		Prompts   []batchItem            `json:"prompts"`
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		if abortTooLarge(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(request.Prompts) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "prompts must be a non-empty array"})
+		return
+	}
+
+	auditDetail(c, "client_id", request.ClientID)
+	priorities := make([]int, len(request.Prompts))
+	converted := false
+	for i := range request.Prompts {
+		item := &request.Prompts[i]
+		if item.ClientID == "" {
+			item.ClientID = request.ClientID
+		}
+		item.ExtraData = mergeExtraData(request.ExtraData, item.ExtraData)
+
+		if item.Prompt != nil && isUIWorkflow(item.Prompt) {
+			graph, err := convertWorkflow(item.Prompt, m.currentObjectInfo())
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("prompts[%d]: %s", i, err), "index": i})
+				return
+			}
+			item.Prompt = graph
+			converted = true
+		}
+		if m.cfg.Strict {
+			if item.Prompt == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationError("no_prompt", "No prompt provided", "No prompt provided"), "node_errors": []interface{}{}, "index": i})
+				return
+			}
+			if validationErr, nodeErrors := validatePrompt(item.Prompt, m.currentObjectInfo()); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr, "node_errors": nodeErrors, "index": i})
+				return
+			}
+		}
+		if priorities[i], err = requestPriority(c, item.ExtraData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("prompts[%d]: %s", i, err), "index": i})
+			return
+		}
+		if err := m.checkDependencies(item.ExtraData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("prompts[%d]: %s", i, err), "index": i})
+			return
+		}
+		if _, err := promptLabels(item.ExtraData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("prompts[%d]: %s", i, err), "index": i})
+			return
+		}
+	}
+	if converted {
+		c.Header("X-Mock-Warning", "UI-format workflow converted to API format; real ComfyUI rejects this request")
+	}
+
+	counts := map[string]int{}
+	for _, item := range request.Prompts {
+		counts[item.ClientID]++
+	}
+	prompts := make([]*PromptInfo, len(request.Prompts))
+	ids := make([]int, len(request.Prompts))
+	for i, item := range request.Prompts {
+		ids[i] = m.sharedQueueID(item.ClientID)
+	}
+	m.mu.Lock()
+	if err := m.admitClients(counts); err != nil {
+		m.mu.Unlock()
+		rejectQuota(c, err)
+		return
+	}
+	for i, item := range request.Prompts {
+		prompts[i], _ = m.newPrompt(c.Request.Context(), item.ClientID, item.Prompt, item.ExtraData, priorities[i], ids[i], nil)
+	}
+	m.mu.Unlock()
+	m.flushStore()
+	for _, prompt := range prompts {
+		m.runSubmitHook(prompt)
+	}
+
+	results := make([]gin.H, len(prompts))
+	promptIDs := make([]string, len(prompts))
+	for i, prompt := range prompts {
+		if m.cfg.Instances > 1 {
+			affinity.record(prompt.ClientID, m.cfg.InstanceID)
+		}
+		m.announcePrompt(prompt)
+		results[i] = gin.H{"prompt_id": prompt.PromptID, "number": prompt.ID, "node_errors": gin.H{}}
+		promptIDs[i] = prompt.PromptID
+	}
+	m.broadcastStatus()
+	m.notifyQueue()
+
+	auditDetail(c, "prompt_ids", promptIDs)
+	c.JSON(http.StatusOK, gin.H{"prompt_ids": promptIDs, "prompts": results})
+}
+
+// mergeExtraData 合并批量请求和单个 workflow 的 extra_data，单个 workflow 的值优先
+func mergeExtraData(shared, own map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(shared)+len(own))
+	for key, value := range shared {
+		merged[key] = value
+	}
+	for key, value := range own {
+		merged[key] = value
+	}
+	return merged
+}
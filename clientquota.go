@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientLimit 是单个 client_id 的配额，0 表示不限制
+type clientLimit struct {
+	queued int
+	hourly int
+}
+
+// clientQuotas 按 client_id 限制排队中的 prompt 数和每小时提交的 prompt 数，没有 client_id 的提交按空 client_id 计算
+type clientQuotas struct {
+	defaults  clientLimit
+	overrides map[string]clientLimit
+	// submissions 是每个 client 最近一小时内的提交时间，由 m.mu 保护
+	submissions map[string][]time.Time
+}
+
+// newClientQuotas 解析 --client-max-queued、--client-max-hourly 和 --client-quota，
+// --client-quota 的格式为 "client_id=queued:hourly"，省略的一项使用默认值
+func newClientQuotas(queued, hourly int, specs []string) (*clientQuotas, error) {
+	q := &clientQuotas{
+		defaults:    clientLimit{queued: queued, hourly: hourly},
+		overrides:   map[string]clientLimit{},
+		submissions: map[string][]time.Time{},
+	}
+	for _, spec := range specs {
+		clientID, value, ok := strings.Cut(spec, "=")
+		queuedValue, hourlyValue, hasHourly := strings.Cut(value, ":")
+		if !ok || clientID == "" || !hasHourly {
+			return nil, fmt.Errorf("client 配额格式错误: %s", spec)
+		}
+		limit := q.defaults
+		for _, field := range []struct {
+			value  string
+			target *int
+		}{{queuedValue, &limit.queued}, {hourlyValue, &limit.hourly}} {
+			if field.value == "" {
+				continue
+			}
+			number, err := strconv.Atoi(field.value)
+			if err != nil || number < 0 {
+				return nil, fmt.Errorf("client 配额格式错误: %s", spec)
+			}
+			*field.target = number
+		}
+		q.overrides[clientID] = limit
+	}
+	return q, nil
+}
+
+func (q *clientQuotas) enabled() bool {
+	return q != nil && (q.defaults.queued > 0 || q.defaults.hourly > 0 || len(q.overrides) > 0)
+}
+
+func (q *clientQuotas) limit(clientID string) clientLimit {
+	if limit, ok := q.overrides[clientID]; ok {
+		return limit
+	}
+	return q.defaults
+}
+
+// quotaError 是超过 client 配额时的错误，retryAfter 为 0 时需要等排队中的 prompt 执行完
+type quotaError struct {
+	details    string
+	retryAfter time.Duration
+}
+
+func (e *quotaError) Error() string {
+	return e.details
+}
+
+// admitClients 检查 counts 中每个 client 提交的 prompt 数是否超过配额，都没有超过时记录这次提交，调用方需持有锁
+func (m *ComfyUIMock) admitClients(counts map[string]int) *quotaError {
+	q := m.quotas
+	if !q.enabled() {
+		return nil
+	}
+
+	now := time.Now()
+	clientIDs := make([]string, 0, len(counts))
+	for clientID := range counts {
+		clientIDs = append(clientIDs, clientID)
+	}
+	sort.Strings(clientIDs)
+
+	for _, clientID := range clientIDs {
+		limit := q.limit(clientID)
+		if limit.queued > 0 {
+			queued := 0
+			for _, prompt := range m.prompts {
+				if prompt.ClientID == clientID && (prompt.Status == "pending" || prompt.Status == "processing") {
+					queued++
+				}
+			}
+			if queued+counts[clientID] > limit.queued {
+				return &quotaError{details: fmt.Sprintf("client %q has %d queued prompts, max_queued is %d", clientID, queued, limit.queued)}
+			}
+		}
+		if limit.hourly > 0 {
+			recent := q.submissions[clientID]
+			for len(recent) > 0 && now.Sub(recent[0]) >= time.Hour {
+				recent = recent[1:]
+			}
+			q.submissions[clientID] = recent
+			if len(recent)+counts[clientID] > limit.hourly {
+				retryAfter := time.Hour
+				if len(recent) > 0 {
+					retryAfter = recent[0].Add(time.Hour).Sub(now)
+				}
+				return &quotaError{retryAfter: retryAfter,
+					details: fmt.Sprintf("client %q submitted %d prompts in the last hour, max_per_hour is %d", clientID, len(recent), limit.hourly)}
+			}
+		}
+	}
+
+	for _, clientID := range clientIDs {
+		if q.limit(clientID).hourly > 0 {
+			for i := 0; i < counts[clientID]; i++ {
+				q.submissions[clientID] = append(q.submissions[clientID], now)
+			}
+		}
+	}
+	return nil
+}
+
+// rejectQuota 返回 429，响应体与 ComfyUI /prompt 的错误格式一致，每小时配额用完时带上 Retry-After
+func rejectQuota(c *gin.Context, err *quotaError) {
+	if err.retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(err.retryAfter.Seconds()))))
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       validationError("client_quota_exceeded", "Client quota exceeded", err.details),
+		"node_errors": gin.H{},
+	})
+}
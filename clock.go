@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mockClock 是 mock 对外报告时间所用的时钟，相对本机时钟偏移 skew，
+// 用于测试混用服务端时间和本地时间计算耗时的客户端。内部的计时和排序仍使用本机时钟
+type mockClock struct {
+	skew atomic.Int64
+}
+
+func newMockClock(skew time.Duration) *mockClock {
+	c := &mockClock{}
+	c.skew.Store(int64(skew))
+	return c
+}
+
+func (c *mockClock) offset() time.Duration {
+	return time.Duration(c.skew.Load())
+}
+
+// report 将本机时间转换为对外报告的时间
+func (c *mockClock) report(t time.Time) time.Time {
+	return t.Add(c.offset())
+}
+
+// millis 返回对外报告的毫秒时间戳，与 ComfyUI 消息中的 timestamp 一致
+func (c *mockClock) millis(t time.Time) int64 {
+	return c.report(t).UnixMilli()
+}
+
+// local 将客户端传回的服务端时间转换为本机时间
+func (c *mockClock) local(t time.Time) time.Time {
+	return t.Add(-c.offset())
+}
+
+// clockMiddleware 按偏移后的时钟设置 Date 响应头
+func (m *ComfyUIMock) clockMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m.clock.offset() != 0 {
+			c.Header("Date", m.clock.report(time.Now()).UTC().Format(http.TimeFormat))
+		}
+		c.Next()
+	}
+}
+
+func (m *ComfyUIMock) handleClock(c *gin.Context) {
+	now := time.Now()
+	c.JSON(http.StatusOK, gin.H{
+		"skew":     m.clock.offset().String(),
+		"skew_ms":  m.clock.offset().Milliseconds(),
+		"local":    now.Format(time.RFC3339Nano),
+		"reported": m.clock.report(now).Format(time.RFC3339Nano),
+	})
+}
+
+// handleClockUpdate 修改时钟偏移，skew 为 Go duration 格式，如 -90s
+func (m *ComfyUIMock) handleClockUpdate(c *gin.Context) {
+	var request struct {
+		Skew string `json:"skew"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	skew, err := time.ParseDuration(request.Skew)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	m.clock.skew.Store(int64(skew))
+	m.handleClock(c)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// processFlags 是保存在包级变量中的参数，所有虚拟实例共用，不能按实例覆盖
+var processFlags = map[string]bool{
+	"input-dir":           true,
+	"output-dir":          true,
+	"temp-dir":            true,
+	"user-dir":            true,
+	"fixtures-dir":        true,
+	"image-fixture":       true,
+	"in-memory":           true,
+	"in-memory-max-files": true,
+	"output-format":       true,
+	"output-quality":      true,
+	"output-generator":    true,
+	"deterministic":       true,
+	"seed-images":         true,
+	"image-dimensions":    true,
+}
+
+// runCluster 在连续端口上启动 --instances 个虚拟实例，每个实例有独立的队列，
+// 实例的参数为启动参数加上对应的 --instance-profile，profile 中不能包含 processFlags
+func runCluster(cfg Config, args []string) error {
+	host, portValue, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("监听地址格式错误: %w", err)
+	}
+	port, err := strconv.Atoi(portValue)
+	if err != nil {
+		return fmt.Errorf("监听地址格式错误: %s", cfg.Addr)
+	}
+
+	overrides := map[int][]string{}
+	for _, profile := range cfg.Profiles {
+		index, flags, ok := strings.Cut(profile, ":")
+		id, err := strconv.Atoi(strings.TrimSpace(index))
+		if !ok || err != nil || id < 0 || id >= cfg.Instances {
+			return fmt.Errorf("实例参数格式错误: %s", profile)
+		}
+		for _, flag := range strings.Fields(flags) {
+			name, _, _ := strings.Cut(strings.TrimLeft(flag, "-"), "=")
+			if strings.HasPrefix(flag, "-") && processFlags[name] {
+				return fmt.Errorf("--%s 对所有虚拟实例生效，不能在 --instance-profile 中覆盖: %s", name, profile)
+			}
+			overrides[id] = append(overrides[id], flag)
+		}
+	}
+
+	errs := make(chan error, cfg.Instances)
+	for i := 0; i < cfg.Instances; i++ {
+		instance := parseConfig(append(append([]string{}, args...), overrides[i]...))
+		instance.InstanceID = i
+		instance.Addr = net.JoinHostPort(host, strconv.Itoa(port+i))
+		if cfg.RecordDir != "" {
+			instance.RecordDir = filepath.Join(cfg.RecordDir, fmt.Sprintf("instance-%d", i))
+		}
+		// 共享的目录只需要一个 janitor，gRPC 端口和终端界面也只能由一个实例使用
+		if i > 0 {
+			instance.TUI = false
+			instance.GRPCAddr = ""
+			instance.CleanupMaxAge = 0
+			instance.CleanupSizeMB = 0
+		}
+
+		fmt.Printf("虚拟实例 %d 监听 %s\n", i, instance.Addr)
+		go func(id int) {
+			errs <- fmt.Errorf("虚拟实例 %d 退出: %w", id, runInstance(instance))
+		}(i)
+	}
+	return <-errs
+}
+
+// faultMiddleware 为每个请求增加固定延迟，并按 errorRate 随机返回 500，/__mock 下的管理接口不受影响
+func faultMiddleware(latency time.Duration, errorRate float64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, "/__mock/") {
+			c.Next()
+			return
+		}
+
+		if latency > 0 {
+			time.Sleep(latency)
+		}
+		if errorRate > 0 && rand.Float64() < errorRate {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "simulated server error"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// clientAffinity 记录集群模式下每个 client_id 访问过哪些虚拟实例，所有实例共用，用于验证会话粘滞
+type clientAffinity struct {
+	mu      sync.Mutex
+	clients map[string]map[int]int
+}
+
+var affinity = &clientAffinity{clients: make(map[string]map[int]int)}
+
+func (a *clientAffinity) record(clientID string, instance int) {
+	if clientID == "" {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.clients[clientID] == nil {
+		a.clients[clientID] = make(map[int]int)
+	}
+	a.clients[clientID][instance]++
+}
+
+// instanceMiddleware 在响应头中标记虚拟实例编号，并记录请求中的 client_id
+func instanceMiddleware(instance int) gin.HandlerFunc {
+	id := strconv.Itoa(instance)
+	return func(c *gin.Context) {
+		c.Header("X-Mock-Instance", id)
+		if strings.HasPrefix(c.Request.URL.Path, "/__mock/") {
+			c.Next()
+			return
+		}
+		clientID := c.Query("clientId")
+		if clientID == "" {
+			clientID = c.Query("client_id")
+		}
+		affinity.record(clientID, instance)
+		c.Next()
+	}
+}
+
+// handleAffinity 报告每个 client_id 访问过的实例，访问过多个实例的 client_id 列在 violations 中
+func (m *ComfyUIMock) handleAffinity(c *gin.Context) {
+	affinity.mu.Lock()
+	defer affinity.mu.Unlock()
+
+	clients := gin.H{}
+	violations := []string{}
+	for clientID, instances := range affinity.clients {
+		hits := gin.H{}
+		for instance, count := range instances {
+			hits[strconv.Itoa(instance)] = count
+		}
+		clients[clientID] = gin.H{"instances": hits, "sticky": len(instances) == 1}
+		if len(instances) > 1 {
+			violations = append(violations, clientID)
+		}
+	}
+	sort.Strings(violations)
+
+	c.JSON(http.StatusOK, gin.H{"clients": clients, "violations": violations})
+}
+
+func (m *ComfyUIMock) handleAffinityReset(c *gin.Context) {
+	affinity.mu.Lock()
+	affinity.clients = make(map[string]map[int]int)
+	affinity.mu.Unlock()
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// compatProfile 描述不同 ComfyUI 版本的消息和 history 格式，版本边界是大致的发布时间，
+// 用于测试客户端是否兼容客户实际运行的版本
+type compatProfile struct {
+	name string
+	// displayNode 为 false 时 executing/executed 消息不带 display_node
+	displayNode bool
+	// executionSuccess 为 false 时不发送 execution_success 消息，客户端只能通过 executing 的 node 为 null 判断完成
+	executionSuccess bool
+	// historyTimestamps 为 true 时 history 的 messages 带有 timestamp，成功时以 execution_success 结尾
+	historyTimestamps bool
+	// progressState 为 true 时执行过程中发送汇总节点状态的 progress_state 消息
+	progressState bool
+	// version 是 /system_stats 中的 comfyui_version，为空时不返回该字段
+	version string
+}
+
+var compatProfiles = map[string]compatProfile{
+	"0.1":    {name: "0.1"},
+	"0.2":    {name: "0.2", displayNode: true, executionSuccess: true, historyTimestamps: true},
+	"0.3":    {name: "0.3", displayNode: true, executionSuccess: true, historyTimestamps: true, version: "0.3.10"},
+	"latest": {name: "latest", displayNode: true, executionSuccess: true, historyTimestamps: true, version: "mock", progressState: true},
+}
+
+func parseCompat(name string) (compatProfile, error) {
+	profile, ok := compatProfiles[name]
+	if !ok {
+		names := make([]string, 0, len(compatProfiles))
+		for profileName := range compatProfiles {
+			names = append(names, profileName)
+		}
+		sort.Strings(names)
+		return profile, fmt.Errorf("未知的 --compat 版本 %s，可用的版本: %s", name, strings.Join(names, ", "))
+	}
+	return profile, nil
+}
+
+// allows 判断该版本是否发送这种消息
+func (p compatProfile) allows(msgType string) bool {
+	return msgType != "execution_success" || p.executionSuccess
+}
+
+// adapt 按版本去掉旧版本没有的字段，不修改原消息
+func (p compatProfile) adapt(data interface{}) interface{} {
+	fields, ok := data.(gin.H)
+	if !ok || p.displayNode {
+		return data
+	}
+	if _, exists := fields["display_node"]; !exists {
+		return data
+	}
+	adapted := make(gin.H, len(fields))
+	for key, value := range fields {
+		if key != "display_node" {
+			adapted[key] = value
+		}
+	}
+	return adapted
+}
+
+// historyMessage 构造 history status 中的一条消息，新版本带上时间戳
+func (p compatProfile) historyMessage(msgType string, data gin.H, at int64) []interface{} {
+	if p.historyTimestamps {
+		stamped := make(gin.H, len(data)+1)
+		for key, value := range data {
+			stamped[key] = value
+		}
+		stamped["timestamp"] = at
+		data = stamped
+	}
+	return []interface{}{msgType, data}
+}
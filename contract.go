@@ -0,0 +1,231 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contractTracker 记录每个 client 与 mock 的交互方式，用于在测试中断言客户端按预期的顺序调用接口：
+// 提交时带 client_id、提交前已打开 WebSocket、执行完后读取 history 并下载输出文件
+type contractTracker struct {
+	mu        sync.Mutex
+	sessions  map[string]*contractSession
+	downloads map[string]time.Time
+	histories map[string]time.Time
+}
+
+type contractSession struct {
+	wsConnectedAt time.Time
+	wsOpen        int
+	prompts       []contractPrompt
+}
+
+type contractPrompt struct {
+	promptID    string
+	submittedAt time.Time
+	wsOpen      bool
+}
+
+func newContractTracker() *contractTracker {
+	return &contractTracker{
+		sessions:  map[string]*contractSession{},
+		downloads: map[string]time.Time{},
+		histories: map[string]time.Time{},
+	}
+}
+
+// session 返回 client 的记录，没有时创建，调用方需持有 t.mu
+func (t *contractTracker) session(clientID string) *contractSession {
+	session, ok := t.sessions[clientID]
+	if !ok {
+		session = &contractSession{}
+		t.sessions[clientID] = session
+	}
+	return session
+}
+
+func (t *contractTracker) wsOpened(clientID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	session := t.session(clientID)
+	if session.wsConnectedAt.IsZero() {
+		session.wsConnectedAt = time.Now()
+	}
+	session.wsOpen++
+}
+
+func (t *contractTracker) wsClosed(clientID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.session(clientID).wsOpen--
+}
+
+func (t *contractTracker) submitted(prompt *PromptInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	session := t.session(prompt.ClientID)
+	session.prompts = append(session.prompts, contractPrompt{
+		promptID:    prompt.PromptID,
+		submittedAt: prompt.QueuedAt,
+		wsOpen:      session.wsOpen > 0,
+	})
+}
+
+// contractMiddleware 记录成功的 /view 下载和 /history/:prompt_id 请求
+func (m *ComfyUIMock) contractMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Request.Method != http.MethodGet || c.Writer.Status() >= http.StatusBadRequest {
+			return
+		}
+
+		now := time.Now()
+		switch c.FullPath() {
+		case "/view":
+			fileType := c.Query("type")
+			if fileType == "" {
+				fileType = "input"
+			}
+			m.contract.mu.Lock()
+			m.contract.downloads[objectKey(fileType, c.Query("subfolder"), c.Query("filename"))] = now
+			m.contract.mu.Unlock()
+		case "/history/:prompt_id":
+			m.contract.mu.Lock()
+			m.contract.histories[c.Param("prompt_id")] = now
+			m.contract.mu.Unlock()
+		}
+	}
+}
+
+// outputFileKeys 返回 history outputs 中引用的文件，格式与 objectKey 一致
+func outputFileKeys(outputs map[string]interface{}) []string {
+	keys := []string{}
+	for _, output := range outputs {
+		for _, record := range fileRecords(output) {
+			filename, _ := record["filename"].(string)
+			subfolder, _ := record["subfolder"].(string)
+			fileType, _ := record["type"].(string)
+			keys = append(keys, objectKey(fileType, subfolder, filename))
+		}
+	}
+	return keys
+}
+
+// fileRecords 返回单个节点 output 中带 filename 的文件记录
+func fileRecords(output interface{}) []map[string]interface{} {
+	found := []map[string]interface{}{}
+	fields, _ := output.(map[string]interface{})
+	for _, value := range fields {
+		var records []interface{}
+		switch v := value.(type) {
+		case []map[string]interface{}:
+			for _, record := range v {
+				records = append(records, record)
+			}
+		case []interface{}:
+			records = v
+		}
+		for _, item := range records {
+			record, _ := item.(map[string]interface{})
+			if filename, _ := record["filename"].(string); filename != "" {
+				found = append(found, record)
+			}
+		}
+	}
+	return found
+}
+
+// handleContract 返回每个 client 的交互记录和检查结果，client_id 参数只返回一个 client。
+// 没有带 client_id 提交的 prompt 归到空字符串下
+func (m *ComfyUIMock) handleContract(c *gin.Context) {
+	type promptState struct {
+		status     string
+		finishedAt time.Time
+		files      []string
+	}
+	m.mu.Lock()
+	states := map[string]promptState{}
+	for promptID, prompt := range m.prompts {
+		states[promptID] = promptState{status: prompt.Status, finishedAt: prompt.FinishedAt, files: outputFileKeys(prompt.Output)}
+	}
+	m.mu.Unlock()
+
+	m.contract.mu.Lock()
+	defer m.contract.mu.Unlock()
+
+	only, filtered := c.GetQuery("client_id")
+	clients := gin.H{}
+	for clientID, session := range m.contract.sessions {
+		if filtered && clientID != only {
+			continue
+		}
+
+		checks := gin.H{
+			"sent_client_id":     clientID != "",
+			"ws_before_submit":   true,
+			"fetched_history":    true,
+			"downloaded_outputs": true,
+		}
+		prompts := []gin.H{}
+		for _, submitted := range session.prompts {
+			state := states[submitted.promptID]
+			finished := state.status == "completed" || state.status == "failed"
+			fetchedAt, fetched := m.contract.histories[submitted.promptID]
+			historyFetched := fetched && finished && !fetchedAt.Before(state.finishedAt)
+			downloaded := 0
+			for _, key := range state.files {
+				if _, ok := m.contract.downloads[key]; ok {
+					downloaded++
+				}
+			}
+
+			if !submitted.wsOpen {
+				checks["ws_before_submit"] = false
+			}
+			if finished && !historyFetched {
+				checks["fetched_history"] = false
+			}
+			if state.status == "completed" && downloaded < len(state.files) {
+				checks["downloaded_outputs"] = false
+			}
+			prompts = append(prompts, gin.H{
+				"prompt_id":             submitted.promptID,
+				"status":                state.status,
+				"submitted_at":          submitted.submittedAt.Format(time.RFC3339Nano),
+				"ws_open_before_submit": submitted.wsOpen,
+				"history_fetched":       historyFetched,
+				"outputs_total":         len(state.files),
+				"outputs_downloaded":    downloaded,
+			})
+		}
+
+		passed := true
+		for _, ok := range checks {
+			passed = passed && ok.(bool)
+		}
+		var wsConnectedAt interface{}
+		if !session.wsConnectedAt.IsZero() {
+			wsConnectedAt = session.wsConnectedAt.Format(time.RFC3339Nano)
+		}
+		clients[clientID] = gin.H{
+			"ws_connected_at": wsConnectedAt,
+			"ws_open":         session.wsOpen > 0,
+			"prompts":         prompts,
+			"checks":          checks,
+			"passed":          passed,
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"clients": clients})
+}
+
+func (m *ComfyUIMock) handleContractReset(c *gin.Context) {
+	m.contract.mu.Lock()
+	m.contract.sessions = map[string]*contractSession{}
+	m.contract.downloads = map[string]time.Time{}
+	m.contract.histories = map[string]time.Time{}
+	m.contract.mu.Unlock()
+	c.Status(http.StatusNoContent)
+}
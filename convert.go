@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 与 ComfyUI 前端一致的节点模式：2 为静音，4 为绕过
+const (
+	nodeModeNever  = 2
+	nodeModeBypass = 4
+)
+
+// virtualNodes 只存在于界面中，不会出现在 API 格式里
+var virtualNodes = map[string]bool{
+	"Note":          true,
+	"MarkdownNote":  true,
+	"Reroute":       true,
+	"PrimitiveNode": true,
+}
+
+// controlValues 是 seed 等整数控件后面由界面添加的 control_after_generate 值
+var controlValues = map[string]bool{"fixed": true, "increment": true, "decrement": true, "randomize": true}
+
+type uiLink struct {
+	originID   string
+	originSlot int
+}
+
+type uiNode struct {
+	id      string
+	raw     map[string]interface{}
+	class   string
+	mode    int
+	inputs  []map[string]interface{}
+	outputs []map[string]interface{}
+}
+
+// isUIWorkflow 判断是否为界面保存的 workflow，即带有 nodes 和 links 数组
+func isUIWorkflow(body map[string]interface{}) bool {
+	_, hasNodes := body["nodes"].([]interface{})
+	_, hasLinks := body["links"].([]interface{})
+	return hasNodes && hasLinks
+}
+
+func uiID(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatInt(int64(v), 10)
+	case string:
+		return v
+	}
+	return ""
+}
+
+func objectList(value interface{}) []map[string]interface{} {
+	items, _ := value.([]interface{})
+	result := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if object, ok := item.(map[string]interface{}); ok {
+			result = append(result, object)
+		}
+	}
+	return result
+}
+
+// convertWorkflow 按 ComfyUI 前端 graphToPrompt 的规则将界面格式的 workflow 转换为 /prompt 接受的 API 格式：
+// 跳过注释、Reroute 和静音的节点，绕过的节点按类型把输入直接连到下游，PrimitiveNode 的值直接写入下游的输入
+func convertWorkflow(workflow map[string]interface{}, objectInfo map[string]interface{}) (map[string]interface{}, error) {
+	if !isUIWorkflow(workflow) {
+		return nil, fmt.Errorf("workflow 缺少 nodes 或 links，不是界面格式")
+	}
+
+	nodes := map[string]*uiNode{}
+	order := []string{}
+	for _, raw := range objectList(workflow["nodes"]) {
+		node := &uiNode{
+			id:      uiID(raw["id"]),
+			raw:     raw,
+			inputs:  objectList(raw["inputs"]),
+			outputs: objectList(raw["outputs"]),
+		}
+		node.class, _ = raw["type"].(string)
+		if mode, ok := raw["mode"].(float64); ok {
+			node.mode = int(mode)
+		}
+		if node.id == "" || node.class == "" {
+			return nil, fmt.Errorf("节点缺少 id 或 type")
+		}
+		nodes[node.id] = node
+		order = append(order, node.id)
+	}
+
+	links := map[string]uiLink{}
+	for _, item := range workflow["links"].([]interface{}) {
+		switch link := item.(type) {
+		case []interface{}:
+			if len(link) < 3 {
+				continue
+			}
+			slot, _ := link[2].(float64)
+			links[uiID(link[0])] = uiLink{originID: uiID(link[1]), originSlot: int(slot)}
+		case map[string]interface{}:
+			slot, _ := link["origin_slot"].(float64)
+			links[uiID(link["id"])] = uiLink{originID: uiID(link["origin_id"]), originSlot: int(slot)}
+		}
+	}
+
+	prompt := map[string]interface{}{}
+	for _, id := range order {
+		node := nodes[id]
+		if virtualNodes[node.class] || node.mode == nodeModeNever || node.mode == nodeModeBypass {
+			continue
+		}
+		info, ok := objectInfo[node.class].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("节点 #%s 的类型 %s 不存在", id, node.class)
+		}
+
+		inputs := widgetInputs(node, info)
+		for _, input := range node.inputs {
+			name, _ := input["name"].(string)
+			if name == "" || input["link"] == nil {
+				continue
+			}
+			// 上游被静音或绕过后没有匹配的输入时不传这个输入，控件保留自己的值
+			if value, ok := resolveLink(nodes, links, uiID(input["link"]), 0); ok {
+				inputs[name] = value
+			}
+		}
+
+		title, _ := node.raw["title"].(string)
+		if title == "" {
+			title, _ = info["display_name"].(string)
+		}
+		if title == "" {
+			title = node.class
+		}
+		prompt[id] = map[string]interface{}{
+			"inputs":     inputs,
+			"class_type": node.class,
+			"_meta":      map[string]interface{}{"title": title},
+		}
+	}
+	return prompt, nil
+}
+
+// resolveLink 返回连接的上游输出 [node_id, slot]，PrimitiveNode 返回它的值，沿 Reroute 和绕过的节点向上查找
+func resolveLink(nodes map[string]*uiNode, links map[string]uiLink, linkID string, depth int) (interface{}, bool) {
+	link, ok := links[linkID]
+	if !ok || depth > len(nodes) {
+		return nil, false
+	}
+	origin, ok := nodes[link.originID]
+	if !ok || origin.mode == nodeModeNever {
+		return nil, false
+	}
+
+	switch {
+	case origin.class == "PrimitiveNode":
+		values, _ := origin.raw["widgets_values"].([]interface{})
+		if len(values) == 0 {
+			return nil, false
+		}
+		return values[0], true
+	case origin.class == "Reroute":
+		for _, input := range origin.inputs {
+			if input["link"] != nil {
+				return resolveLink(nodes, links, uiID(input["link"]), depth+1)
+			}
+		}
+		return nil, false
+	case origin.mode == nodeModeBypass:
+		outputType := ""
+		if link.originSlot < len(origin.outputs) {
+			outputType, _ = origin.outputs[link.originSlot]["type"].(string)
+		}
+		for _, input := range origin.inputs {
+			if inputType, _ := input["type"].(string); inputType == outputType && input["link"] != nil {
+				return resolveLink(nodes, links, uiID(input["link"]), depth+1)
+			}
+		}
+		return nil, false
+	}
+	return []interface{}{link.originID, link.originSlot}, true
+}
+
+// widgetInputs 把 widgets_values 对应到控件名。连接到其他节点的控件在 widgets_values 中仍然占一个位置，
+// 值由调用方用连接覆盖
+func widgetInputs(node *uiNode, info map[string]interface{}) map[string]interface{} {
+	inputs := map[string]interface{}{}
+	if values, ok := node.raw["widgets_values"].(map[string]interface{}); ok {
+		for name, value := range values {
+			inputs[name] = value
+		}
+		return inputs
+	}
+	values, _ := node.raw["widgets_values"].([]interface{})
+
+	index := 0
+	for _, name := range widgetNames(node, info) {
+		if index >= len(values) {
+			break
+		}
+		inputs[name] = values[index]
+		index++
+		if hasControlWidget(name, inputSpec(info, name)) && index < len(values) {
+			if control, ok := values[index].(string); ok && controlValues[control] {
+				index++
+			}
+		}
+	}
+	return inputs
+}
+
+// widgetNames 按 object_info 的 input_order 返回控件名，没有 input_order 时按界面中列出的控件顺序
+func widgetNames(node *uiNode, info map[string]interface{}) []string {
+	names := []string{}
+	order, ok := info["input_order"].(map[string]interface{})
+	if !ok {
+		for _, input := range node.inputs {
+			if widget, ok := input["widget"].(map[string]interface{}); ok {
+				if name, ok := widget["name"].(string); ok {
+					names = append(names, name)
+				}
+			}
+		}
+		return names
+	}
+
+	for _, section := range []string{"required", "optional"} {
+		items, _ := order[section].([]interface{})
+		for _, item := range items {
+			name, _ := item.(string)
+			if isWidgetSpec(inputSpec(info, name)) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func inputSpec(info map[string]interface{}, name string) []interface{} {
+	definitions, _ := info["input"].(map[string]interface{})
+	for _, section := range []string{"required", "optional"} {
+		specs, _ := definitions[section].(map[string]interface{})
+		if spec, ok := specs[name].([]interface{}); ok {
+			return spec
+		}
+	}
+	return nil
+}
+
+// isWidgetSpec 判断 object_info 中的输入是否是界面上的控件，而不是只能连接的输入
+func isWidgetSpec(spec []interface{}) bool {
+	if len(spec) == 0 {
+		return false
+	}
+	if options, ok := spec[len(spec)-1].(map[string]interface{}); ok && len(spec) > 1 {
+		if forceInput, _ := options["forceInput"].(bool); forceInput {
+			return false
+		}
+	}
+	switch inputType := spec[0].(type) {
+	case []interface{}:
+		return true
+	case string:
+		switch inputType {
+		case "INT", "FLOAT", "STRING", "BOOLEAN", "COMBO":
+			return true
+		}
+	}
+	return false
+}
+
+func hasControlWidget(name string, spec []interface{}) bool {
+	if len(spec) > 1 {
+		if options, ok := spec[1].(map[string]interface{}); ok {
+			if control, ok := options["control_after_generate"].(bool); ok {
+				return control
+			}
+		}
+	}
+	return name == "seed" || name == "noise_seed"
+}
+
+// handleConvert 将请求体中界面格式的 workflow 转换为 API 格式，使用当前的 object_info
+func (m *ComfyUIMock) handleConvert(c *gin.Context) {
+	var workflow map[string]interface{}
+	if err := c.ShouldBindJSON(&workflow); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	prompt, err := convertWorkflow(workflow, m.currentObjectInfo())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, prompt)
+}
+
+// runConvert 实现 convert 子命令，把界面保存的 workflow 转换为 API 格式的测试 fixture
+func runConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	objectInfoPath := fs.String("object-info", "resources/object_info.json", "object_info JSON 文件")
+	customNodes := fs.String("custom-nodes", "", "逗号分隔的自定义节点定义 JSON 文件或目录，合并到 object_info 中")
+	out := fs.String("out", "", "输出文件，为空时写到标准输出")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("用法: mock-comfy convert [--object-info file] [--out api.json] workflow.json")
+	}
+
+	objectInfo, err := loadObjectInfo(*objectInfoPath, *customNodes)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("读取 workflow 文件失败: %w", err)
+	}
+	var workflow map[string]interface{}
+	if err := json.Unmarshal(data, &workflow); err != nil {
+		return fmt.Errorf("解析 workflow 文件失败: %w", err)
+	}
+
+	prompt, err := convertWorkflow(workflow, objectInfo)
+	if err != nil {
+		return err
+	}
+	result, err := json.MarshalIndent(prompt, "", "  ")
+	if err != nil {
+		return err
+	}
+	result = append(result, '\n')
+
+	if *out == "" {
+		_, err = os.Stdout.Write(result)
+		return err
+	}
+	if err := os.WriteFile(*out, result, 0644); err != nil {
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsMiddleware 对应 ComfyUI 的 --enable-cors-header，origins 为逗号分隔的允许列表，"*" 表示允许所有来源
+func corsMiddleware(origins string, credentials bool) gin.HandlerFunc {
+	allowed := map[string]bool{}
+	for _, origin := range strings.Split(origins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			allowed[strings.TrimSuffix(origin, "/")] = true
+		}
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		switch {
+		case allowed["*"] && !credentials:
+			c.Header("Access-Control-Allow-Origin", "*")
+		case origin != "" && (allowed["*"] || allowed[origin]):
+			// 允许携带凭证时浏览器不接受 "*"，需要回显具体的来源
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Vary", "Origin")
+		default:
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Methods", "POST, GET, DELETE, PUT, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		if credentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusOK)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// crashed 判断是否处于模拟崩溃期间，调用方需持有锁
+func (m *ComfyUIMock) crashed() bool {
+	return time.Now().Before(m.crashedUntil)
+}
+
+// errCrashed 是模拟崩溃时取消执行中 prompt 的原因
+var errCrashed = errors.New("process crashed")
+
+// crashMiddleware 模拟崩溃期间直接断开连接，/__mock 下的管理接口不受影响
+func (m *ComfyUIMock) crashMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, "/__mock/") {
+			c.Next()
+			return
+		}
+
+		m.mu.Lock()
+		crashed := m.crashed()
+		m.mu.Unlock()
+		if !crashed {
+			c.Next()
+			return
+		}
+
+		conn, _, err := c.Writer.Hijack()
+		if err != nil {
+			c.AbortWithStatus(http.StatusBadGateway)
+			return
+		}
+		conn.Close()
+		c.Abort()
+	}
+}
+
+// handleCrash 模拟 ComfyUI 进程重启：断开所有 WebSocket，在指定时间内拒绝连接，
+// 恢复后按配置保留或清空队列，执行中的 prompt 总是丢失，保留队列时重新排队
+func (m *ComfyUIMock) handleCrash(c *gin.Context) {
+	var request struct {
+		Seconds   float64 `json:"seconds"`
+		KeepQueue *bool   `json:"keep_queue"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Seconds <= 0 {
+		request.Seconds = 5
+	}
+	keepQueue := m.cfg.CrashKeepQueue
+	if request.KeepQueue != nil {
+		keepQueue = *request.KeepQueue
+	}
+	downtime := time.Duration(request.Seconds * float64(time.Second))
+
+	m.mu.Lock()
+	m.crashedUntil = time.Now().Add(downtime)
+	m.startedAt = m.crashedUntil
+	m.vramUsed = 0
+	m.modelsLoaded = false
+
+	// 已经完成、正在发送 executed 消息的 prompt 不需要重新执行
+	if running := m.cancelRunning(errCrashed); running != nil && running.Status == "processing" {
+		running.trace.finish("crashed", nil)
+		running.trace = nil
+		running.Status = "pending"
+		// 与 ComfyUI 重启后恢复队列一样，中断的 prompt 重新排在最前面
+		m.pending = append([]*PromptInfo{running}, m.pending...)
+		m.persist(running)
+	}
+	if !keepQueue {
+		for promptID, prompt := range m.prompts {
+			prompt.trace.finish("crashed", nil)
+			delete(m.prompts, promptID)
+			m.unpersist(promptID)
+		}
+		m.pending = nil
+		m.queueID = 0
+		m.clientQueueIDs = make(map[string]int)
+	}
+	m.mu.Unlock()
+
+	m.ws.closeAll()
+
+	time.AfterFunc(downtime, m.notifyQueue)
+
+	c.JSON(http.StatusOK, gin.H{"down_seconds": request.Seconds, "keep_queue": keepQueue})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleDedupe 查询相同的 workflow 是否提交过，作为去重层测试的基准。
+// 使用与 --deterministic 相同的 workflow 哈希，只在 _meta 上不同的 workflow 视为相同
+func (m *ComfyUIMock) handleDedupe(c *gin.Context) {
+	var request struct {
+		Prompt   map[string]interface{} `json:"prompt" binding:"required"`
+		ClientID string                 `json:"client_id"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hash := workflowHash(request.Prompt)
+
+	m.mu.Lock()
+	matches := []*PromptInfo{}
+	for _, prompt := range m.prompts {
+		if request.ClientID != "" && prompt.ClientID != request.ClientID {
+			continue
+		}
+		if workflowHash(prompt.Prompt) == hash {
+			matches = append(matches, prompt)
+		}
+	}
+	// 按提交时间排序，第一个是最早提交的 prompt
+	sort.Slice(matches, func(i, j int) bool { return matches[i].QueuedAt.Before(matches[j].QueuedAt) })
+	submissions := make([]gin.H, 0, len(matches))
+	for _, prompt := range matches {
+		submissions = append(submissions, gin.H{
+			"prompt_id": prompt.PromptID,
+			"client_id": prompt.ClientID,
+			"number":    prompt.ID,
+			"status":    prompt.Status,
+			"queued_at": prompt.QueuedAt,
+		})
+	}
+	m.mu.Unlock()
+
+	response := gin.H{
+		"hash":        fmt.Sprintf("%016x", hash),
+		"submitted":   len(submissions) > 0,
+		"submissions": submissions,
+	}
+	if len(submissions) > 0 {
+		response["prompt_id"] = submissions[0]["prompt_id"]
+	}
+	c.JSON(http.StatusOK, response)
+}
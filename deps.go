@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+)
+
+// dependencyKey 是 extra_data 中声明前置 prompt 的字段，值为一个 prompt_id 或 prompt_id 数组。
+// ComfyUI 没有这个字段，会原样保存在 extra_data 中
+const dependencyKey = "depends_on"
+
+// promptDependencies 返回 extra_data 中声明的前置 prompt_id
+func promptDependencies(extraData map[string]interface{}) ([]string, error) {
+	switch value := extraData[dependencyKey].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{value}, nil
+	case []interface{}:
+		ids := make([]string, 0, len(value))
+		for _, item := range value {
+			id, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid %s: %v", dependencyKey, value)
+			}
+			ids = append(ids, id)
+		}
+		return ids, nil
+	default:
+		return nil, fmt.Errorf("invalid %s: %v", dependencyKey, value)
+	}
+}
+
+// checkDependencies 检查提交时声明的前置 prompt 都存在
+func (m *ComfyUIMock) checkDependencies(extraData map[string]interface{}) error {
+	ids, err := promptDependencies(extraData)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range ids {
+		if _, ok := m.prompts[id]; !ok {
+			return fmt.Errorf("%s: prompt %s not found", dependencyKey, id)
+		}
+	}
+	return nil
+}
+
+// dependencyState 返回前置 prompt 是否都已完成，前置 prompt 失败或已被删除时 reason 不为空，调用方需持有锁
+func (m *ComfyUIMock) dependencyState(prompt *PromptInfo) (ready bool, reason string) {
+	ids, _ := promptDependencies(prompt.ExtraData)
+	ready = true
+	for _, id := range ids {
+		dependency, ok := m.prompts[id]
+		switch {
+		case !ok:
+			return false, fmt.Sprintf("dependency %s was deleted before it completed", id)
+		case dependency.Status == "failed":
+			return false, fmt.Sprintf("dependency %s failed", id)
+		case dependency.Status != "completed":
+			ready = false
+		}
+	}
+	return ready, ""
+}
+
+// nextRunnable 按执行顺序返回第一个前置 prompt 都已完成、on_submit 已返回的 prompt，并将其移出队列。
+// 前置 prompt 失败的 prompt 直接标记为失败并移出队列，由调用方在释放锁后通知客户端，调用方需持有锁
+func (m *ComfyUIMock) nextRunnable() (task *PromptInfo, abandoned []*PromptInfo) {
+	for _, prompt := range m.pendingPrompts() {
+		if prompt.scripting {
+			continue
+		}
+		ready, reason := m.dependencyState(prompt)
+		if reason != "" {
+			m.removePending(prompt)
+			markFailed(prompt, "DependencyError", reason)
+			m.persist(prompt)
+			abandoned = append(abandoned, prompt)
+			continue
+		}
+		if ready {
+			m.removePending(prompt)
+			return prompt, abandoned
+		}
+	}
+	return nil, abandoned
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/color"
+	"math/rand"
+)
+
+// deterministicOutputs 由 --deterministic 配置，开启后输出图片由 workflow 哈希决定，便于快照测试
+var deterministicOutputs bool
+
+// seededOutputs 由 --seed-images 配置，开启后输出图片的图案由采样节点的 seed 决定
+var seededOutputs bool
+
+// samplerSeed 返回第一个采样节点的 seed，seed 连接到其他节点时无法确定，返回 false
+func samplerSeed(graph map[string]interface{}) (uint64, bool) {
+	for _, nodeID := range findNodes(graph, "KSampler", "KSamplerAdvanced", "RandomNoise", "SamplerCustom") {
+		inputs, _ := graph[nodeID].(map[string]interface{})["inputs"].(map[string]interface{})
+		for _, key := range []string{"seed", "noise_seed"} {
+			if seed, ok := inputs[key].(float64); ok {
+				return uint64(int64(seed)), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// outputSizes 是 deterministic 模式下可能的输出尺寸，与常见的 SD/SDXL 分辨率一致
+var outputSizes = [][2]int{{512, 512}, {768, 512}, {512, 768}, {1024, 1024}, {1216, 832}, {832, 1216}}
+
+// workflowHash 对 prompt 图做哈希，忽略只影响界面显示的 _meta。json.Marshal 按键排序输出，
+// 相同的图无论提交时的键顺序如何都得到相同的哈希
+func workflowHash(graph map[string]interface{}) uint64 {
+	normalized := make(map[string]interface{}, len(graph))
+	for nodeID, value := range graph {
+		node, ok := value.(map[string]interface{})
+		if !ok {
+			normalized[nodeID] = value
+			continue
+		}
+		stripped := make(map[string]interface{}, len(node))
+		for key, field := range node {
+			if key != "_meta" {
+				stripped[key] = field
+			}
+		}
+		normalized[nodeID] = stripped
+	}
+
+	data, _ := json.Marshal(normalized)
+	sum := sha256.Sum256(data)
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// renderImage 用 seed 生成确定的渐变条纹图案，相同的 seed 总是得到相同的像素
+func renderImage(seed uint64, width, height int) image.Image {
+	rng := rand.New(rand.NewSource(int64(seed)))
+	from := color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255}
+	to := color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255}
+	stripe := 16 + rng.Intn(48)
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			t := (x + y) * 255 / (width + height)
+			if (x/stripe+y/stripe)%2 == 0 {
+				t = 255 - t
+			}
+			offset := img.PixOffset(x, y)
+			img.Pix[offset] = uint8((int(from.R)*(255-t) + int(to.R)*t) / 255)
+			img.Pix[offset+1] = uint8((int(from.G)*(255-t) + int(to.G)*t) / 255)
+			img.Pix[offset+2] = uint8((int(from.B)*(255-t) + int(to.B)*t) / 255)
+			img.Pix[offset+3] = 255
+		}
+	}
+	return img
+}
+
+// promptImage 返回 prompt 的输出图片内容。deterministic 模式下按 workflow 哈希选择尺寸和图案，
+// --seed-images 时图案只由 seed 决定：相同的 seed 得到相同的图片，不同的 seed 得到不同的图片
+func promptImage(prompt *PromptInfo) ([]byte, error) {
+	seed, seeded := samplerSeed(prompt.Prompt)
+	seeded = seeded && seededOutputs
+	format, chosen := promptImageFormat(prompt.Prompt)
+	width, height, sized := renderSize(prompt.Prompt)
+	if !deterministicOutputs && !seeded {
+		data, err := imageFixture()
+		if err != nil {
+			return nil, err
+		}
+		if sized {
+			return resizeImageData(data, width, height, format, chosen)
+		}
+		if !chosen {
+			return data, nil
+		}
+		return convertImage(data, format)
+	}
+
+	hash := workflowHash(prompt.Prompt)
+	pattern := hash
+	if seeded {
+		pattern = seed
+	}
+	size := [2]int{512, 512}
+	if sized {
+		size = [2]int{width, height}
+	} else if deterministicOutputs {
+		size = outputSizes[hash%uint64(len(outputSizes))]
+	}
+
+	var buf bytes.Buffer
+	if err := encodeImage(&buf, renderImage(pattern, size[0], size[1]), format); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
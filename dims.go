@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// imageDimensions 由 --image-dimensions 配置，开启后按图中节点推算的尺寸生成输出图片，图片记录中带上 width 和 height
+var imageDimensions bool
+
+// maxRenderPixels 是按图中尺寸生成图片的像素上限，超过时仍使用默认尺寸
+const maxRenderPixels = 4096 * 4096
+
+// dimensionInputs 是沿连接向上游查找尺寸时依次检查的输入
+var dimensionInputs = []string{"images", "image", "samples", "pixels", "latent_image", "latent"}
+
+var upscaleFactor = regexp.MustCompile(`(?i)(?:^|[^0-9])([1-8])x|x([1-8])(?:[^0-9]|$)`)
+
+// nodeDimensions 按节点类型推算节点输出图片的像素尺寸：Empty*Latent*、EmptyImage 和 LoadImage 引用的图片给出初始尺寸，
+// 缩放和放大节点在上游尺寸的基础上计算，其他节点沿图片或 latent 输入向上游查找
+func nodeDimensions(graph map[string]interface{}, nodeID string, depth int) (int, int, bool) {
+	if depth > len(graph) {
+		return 0, 0, false
+	}
+	node, _ := graph[nodeID].(map[string]interface{})
+	inputs, _ := node["inputs"].(map[string]interface{})
+	classType, _ := node["class_type"].(string)
+	number := func(name string) float64 {
+		value, _ := inputs[name].(float64)
+		return value
+	}
+	upstream := func() (int, int, bool) {
+		for _, name := range dimensionInputs {
+			if link, ok := inputs[name].([]interface{}); ok && len(link) == 2 {
+				return nodeDimensions(graph, fmt.Sprint(link[0]), depth+1)
+			}
+		}
+		return 0, 0, false
+	}
+
+	switch classType {
+	case "EmptyLatentImage", "EmptySD3LatentImage", "EmptyHunyuanLatentVideo", "EmptyMochiLatentVideo", "EmptyLTXVLatentVideo", "EmptyImage", "ImageCrop":
+		width, height := int(number("width")), int(number("height"))
+		return width, height, width > 0 && height > 0
+
+	case "LatentUpscale", "ImageScale":
+		width, height := int(number("width")), int(number("height"))
+		if width == 0 || height == 0 {
+			// 与 ComfyUI 一致，宽或高为 0 时按上游的宽高比计算
+			srcWidth, srcHeight, ok := upstream()
+			if !ok || (width == 0 && height == 0) {
+				return 0, 0, false
+			}
+			if width == 0 {
+				width = int(math.Round(float64(srcWidth) * float64(height) / float64(srcHeight)))
+			} else {
+				height = int(math.Round(float64(srcHeight) * float64(width) / float64(srcWidth)))
+			}
+		}
+		if classType == "LatentUpscale" {
+			width, height = width/8*8, height/8*8
+		}
+		return width, height, width > 0 && height > 0
+
+	case "LatentUpscaleBy", "ImageScaleBy":
+		width, height, ok := upstream()
+		scale := number("scale_by")
+		if !ok || scale <= 0 {
+			return 0, 0, false
+		}
+		if classType == "LatentUpscaleBy" {
+			return int(math.Round(float64(width/8)*scale)) * 8, int(math.Round(float64(height/8)*scale)) * 8, true
+		}
+		return int(math.Round(float64(width) * scale)), int(math.Round(float64(height) * scale)), true
+
+	case "ImageScaleToTotalPixels":
+		width, height, ok := upstream()
+		megapixels := number("megapixels")
+		if !ok || megapixels <= 0 || width*height <= 0 {
+			return 0, 0, false
+		}
+		scale := math.Sqrt(megapixels * 1024 * 1024 / float64(width*height))
+		return int(math.Round(float64(width) * scale)), int(math.Round(float64(height) * scale)), true
+
+	case "LoadImage":
+		return loadImageDimensions(inputs)
+
+	case "ImageUpscaleWithModel":
+		width, height, ok := upstream()
+		if !ok {
+			return 0, 0, false
+		}
+		scale := modelUpscaleFactor(graph, inputs["upscale_model"])
+		return width * scale, height * scale, true
+	}
+	return upstream()
+}
+
+// modelUpscaleFactor 从放大模型的文件名中读取倍数，如 4x-UltraSharp.pth、RealESRGAN_x2.pth，无法确定时为 4
+func modelUpscaleFactor(graph map[string]interface{}, link interface{}) int {
+	source, ok := link.([]interface{})
+	if !ok || len(source) != 2 {
+		return 4
+	}
+	loader, _ := graph[fmt.Sprint(source[0])].(map[string]interface{})
+	inputs, _ := loader["inputs"].(map[string]interface{})
+	name, _ := inputs["model_name"].(string)
+	match := upscaleFactor.FindStringSubmatch(name)
+	if match == nil {
+		return 4
+	}
+	factor := match[1]
+	if factor == "" {
+		factor = match[2]
+	}
+	scale, _ := strconv.Atoi(factor)
+	return scale
+}
+
+// promptDimensions 返回 prompt 输出图片的尺寸，按第一个能推算出尺寸的图片输出节点计算
+func promptDimensions(graph map[string]interface{}) (int, int, bool) {
+	candidates := findNodes(graph, "SaveImage", "PreviewImage", "SaveImageWebsocket")
+	candidates = append(candidates, terminalNodes(graph)...)
+	for _, nodeID := range candidates {
+		if width, height, ok := nodeDimensions(graph, nodeID, 0); ok {
+			return width, height, true
+		}
+	}
+	return 0, 0, false
+}
+
+// renderSize 返回按图中尺寸生成图片时使用的尺寸，没有开启 --image-dimensions、尺寸未知或过大时 ok 为 false
+func renderSize(graph map[string]interface{}) (int, int, bool) {
+	if !imageDimensions {
+		return 0, 0, false
+	}
+	width, height, ok := promptDimensions(graph)
+	if !ok || width*height > maxRenderPixels {
+		return 0, 0, false
+	}
+	return width, height, true
+}
+
+// resizeImage 按最近邻缩放图片
+func resizeImage(src image.Image, width, height int) image.Image {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		sy := bounds.Min.Y + y*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			dst.Set(x, y, src.At(bounds.Min.X+x*bounds.Dx()/width, sy))
+		}
+	}
+	return dst
+}
+
+// resizeImageData 将编码后的图片缩放为 width x height，尺寸相同且没有指定输出格式时原样返回
+func resizeImageData(data []byte, width, height int, format imageFormat, chosen bool) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解码源图片失败: %w", err)
+	}
+	if src.Bounds().Dx() == width && src.Bounds().Dy() == height {
+		if !chosen && matchesFormat(data, format) {
+			return data, nil
+		}
+		return convertImage(data, format)
+	}
+	var buf bytes.Buffer
+	if err := encodeImage(&buf, resizeImage(src, width, height), format); err != nil {
+		return nil, fmt.Errorf("编码输出图片失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// imageRecord 返回输出图片的文件记录，--image-dimensions 时带上图片的 width 和 height
+func imageRecord(prompt *PromptInfo, filename, subfolder, fileType string) map[string]interface{} {
+	record := fileRecord(filename, subfolder, fileType)
+	if width, height, ok := renderSize(prompt.Prompt); ok {
+		record["width"] = width
+		record["height"] = height
+	}
+	return record
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// 文件目录，由 --input-dir、--output-dir、--temp-dir、--user-dir 和 --fixtures-dir 配置
+var (
+	inputDir    = "input"
+	outputDir   = "outputs"
+	tempDir     = "temp"
+	userDir     = "user"
+	fixturesDir = "resources"
+)
+
+// setupDirs 应用配置的目录并在启动时创建输入、输出、临时和用户目录
+func setupDirs(cfg Config) error {
+	inputDir = cfg.InputDir
+	outputDir = cfg.OutputDir
+	tempDir = cfg.TempDir
+	userDir = cfg.UserDir
+	fixturesDir = cfg.FixturesDir
+	imageFixturePath = cfg.ImageFixture
+	inMemoryOutputs = cfg.InMemory
+	if err := parseOutputFormat(cfg.OutputFormat); err != nil {
+		return err
+	}
+	outputFormat = cfg.OutputFormat
+	outputQuality = cfg.OutputQuality
+
+	if inMemoryOutputs && imageFixturePath != "" {
+		data, err := imageFixture()
+		if err != nil {
+			return err
+		}
+		imageFixtureData = data
+	}
+
+	memFilesMax = cfg.MemFilesMax
+	disk.reset()
+
+	dirs := []string{inputDir, outputDir, tempDir, userDir}
+	if inMemoryOutputs {
+		// 输出文件只保存在内存中，不创建 output 和 temp 目录
+		dirs = []string{inputDir, userDir}
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return fmt.Errorf("创建目录 %s 失败: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// fixturePath 返回 fixtures 目录下的文件路径，如 object_info.json
+func fixturePath(name string) string {
+	return filepath.Join(fixturesDir, name)
+}
+
+// envOr 读取环境变量，未设置时返回默认值
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
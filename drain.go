@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// drainState 是 /__mock/drain 开始后的状态：不再接受新的 prompt，已经入队的 prompt 照常执行完
+type drainState struct {
+	status     int
+	retryAfter int
+	since      time.Time
+	// idleLogged 记录是否已经输出过排空完成的日志
+	idleLogged bool
+}
+
+// drainIdle 判断排空是否完成，调用方需持有锁
+func (m *ComfyUIMock) drainIdle() bool {
+	return m.drain != nil && m.runningTask == nil && len(m.pending) == 0
+}
+
+// drainStatus 返回排空状态，调用方需持有锁
+func (m *ComfyUIMock) drainStatus() gin.H {
+	if m.drain == nil {
+		return gin.H{"draining": false}
+	}
+	return gin.H{
+		"draining": true,
+		"idle":     m.drainIdle(),
+		"running":  m.runningTask != nil,
+		"pending":  len(m.pending),
+		"since":    m.clock.report(m.drain.since),
+		"status":   m.drain.status,
+	}
+}
+
+// logDrained 在排空完成时输出一次日志
+func (m *ComfyUIMock) logDrained() {
+	m.mu.Lock()
+	idle := m.drainIdle() && !m.drain.idleLogged
+	if idle {
+		m.drain.idleLogged = true
+	}
+	m.mu.Unlock()
+	if idle {
+		m.logf("Drain complete, no prompts in flight")
+	}
+}
+
+// rejectDraining 在排空期间拒绝提交 prompt，返回 true 时已写入响应
+func (m *ComfyUIMock) rejectDraining(c *gin.Context) bool {
+	// handleDrain 会修改 status 和 retry_after，需要在持锁时复制
+	m.mu.Lock()
+	draining := m.drain != nil
+	var status, retryAfter int
+	if draining {
+		status, retryAfter = m.drain.status, m.drain.retryAfter
+	}
+	m.mu.Unlock()
+	if !draining {
+		return false
+	}
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+	}
+	c.JSON(status, gin.H{
+		"error":       validationError("server_draining", "Server is draining", "Server is draining and does not accept new prompts"),
+		"node_errors": gin.H{},
+	})
+	return true
+}
+
+// handleDrain 开始排空，请求体可以指定拒绝新 prompt 时的 status 和 retry_after 秒数，默认 status 为 --drain-status
+func (m *ComfyUIMock) handleDrain(c *gin.Context) {
+	var request struct {
+		Status     int `json:"status"`
+		RetryAfter int `json:"retry_after"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if request.Status == 0 {
+		request.Status = m.cfg.DrainStatus
+	}
+	if request.Status < 400 || request.Status > 599 || request.RetryAfter < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be a 4xx or 5xx code and retry_after must not be negative"})
+		return
+	}
+
+	m.mu.Lock()
+	if m.drain == nil {
+		m.drain = &drainState{since: time.Now()}
+	}
+	m.drain.status = request.Status
+	m.drain.retryAfter = request.RetryAfter
+	m.mu.Unlock()
+
+	m.logf("Draining, new prompts are rejected with %d", request.Status)
+	m.logDrained()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c.JSON(http.StatusOK, m.drainStatus())
+}
+
+// handleDrainStatus 返回排空状态，带 wait 参数时最多等待这么长时间直到排空完成
+func (m *ComfyUIMock) handleDrainStatus(c *gin.Context) {
+	var wait time.Duration
+	if value := c.Query("wait"); value != "" {
+		var err error
+		if wait, err = time.ParseDuration(value); err != nil || wait < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid wait: " + value})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), wait)
+	defer cancel()
+	for {
+		m.mu.Lock()
+		done := m.drain == nil || m.drainIdle()
+		m.mu.Unlock()
+		if done || !sleepCtx(ctx, 50*time.Millisecond) {
+			break
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c.JSON(http.StatusOK, m.drainStatus())
+}
+
+// handleDrainCancel 结束排空，重新接受新的 prompt
+func (m *ComfyUIMock) handleDrainCancel(c *gin.Context) {
+	m.mu.Lock()
+	draining := m.drain != nil
+	m.drain = nil
+	m.mu.Unlock()
+
+	if draining {
+		m.logf("Drain cancelled, accepting prompts")
+	}
+	c.JSON(http.StatusOK, gin.H{"draining": false})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleQueueETA 按 worker 使用的处理时间估算每个 prompt 的开始和完成时间。
+// 暂停期间按立即恢复估算并返回 paused；等待的前置 prompt 失败、被删除或永远不会完成时返回 blocked，不给出时间
+func (m *ComfyUIMock) handleQueueETA(c *gin.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clientID := c.Query("client_id")
+	now := time.Now()
+	queueRunning := []gin.H{}
+	queuePending := []gin.H{}
+
+	// next 为下一个 prompt 可以开始的时间，执行中的 prompt 是 /__mock/stuck 安装的 prompt 时永远不会结束
+	next := now
+	known := true
+	// finished 是执行中和已经排好时间的 prompt，用于判断 depends_on 何时满足
+	finished := map[string]bool{}
+	modelsLoaded := m.modelsLoaded
+	if running := m.runningTask; running != nil {
+		var completion time.Time
+		switch {
+		case running.stuck:
+			known = false
+		case running.expected > 0:
+			completion = running.processingAt.Add(running.expected)
+		default:
+			// 还在加载模型，processPrompt 尚未确定处理时间
+			completion = running.started.Add(m.cfg.ColdStart + m.expectedProcessing(running))
+		}
+		if known && completion.Before(now) {
+			completion = now
+		}
+		next = completion
+		finished[running.PromptID] = true
+
+		if m.visibleTo(running, clientID) {
+			entry := gin.H{
+				"prompt_id":  running.PromptID,
+				"number":     running.ID,
+				"started_at": running.started.Format(time.RFC3339),
+			}
+			if known {
+				entry["estimated_completion"] = completion.Format(time.RFC3339)
+				entry["remaining_seconds"] = completion.Sub(now).Seconds()
+			}
+			queueRunning = append(queueRunning, entry)
+		}
+	}
+
+	// 与 nextRunnable 一样每次选择第一个前置 prompt 都已完成的 prompt
+	waiting := m.pendingPrompts()
+	position := 0
+	for len(waiting) > 0 {
+		index := -1
+		for i, prompt := range waiting {
+			if m.dependenciesMet(prompt, finished) {
+				index = i
+				break
+			}
+		}
+		if index < 0 || !known {
+			break
+		}
+		prompt := waiting[index]
+		waiting = append(waiting[:index], waiting[index+1:]...)
+
+		start := next
+		duration := m.expectedProcessing(prompt)
+		if !modelsLoaded {
+			duration += m.cfg.ColdStart
+			modelsLoaded = true
+		}
+		next = start.Add(duration)
+		finished[prompt.PromptID] = true
+		position++
+
+		if !m.visibleTo(prompt, clientID) {
+			continue
+		}
+		queuePending = append(queuePending, gin.H{
+			"prompt_id":            prompt.PromptID,
+			"number":               prompt.ID,
+			"position":             position,
+			"estimated_start":      start.Format(time.RFC3339),
+			"estimated_completion": next.Format(time.RFC3339),
+			"starts_in_seconds":    start.Sub(now).Seconds(),
+		})
+	}
+	for _, prompt := range waiting {
+		position++
+		if m.visibleTo(prompt, clientID) {
+			queuePending = append(queuePending, gin.H{
+				"prompt_id": prompt.PromptID,
+				"number":    prompt.ID,
+				"position":  position,
+				"blocked":   true,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"queue_running": queueRunning,
+		"queue_pending": queuePending,
+		"paused":        m.resumed != nil,
+	})
+}
+
+// dependenciesMet 判断 prompt 的前置 prompt 是否都已完成或在 finished 中，前置 prompt 失败或被删除时永远不满足，调用方需持有锁
+func (m *ComfyUIMock) dependenciesMet(prompt *PromptInfo, finished map[string]bool) bool {
+	ids, _ := promptDependencies(prompt.ExtraData)
+	for _, id := range ids {
+		dependency, ok := m.prompts[id]
+		if !ok || dependency.Status == "failed" {
+			return false
+		}
+		if dependency.Status != "completed" && !finished[id] {
+			return false
+		}
+	}
+	return true
+}
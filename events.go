@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+)
+
+// eventPublisher 将 prompt 生命周期事件发送到消息队列，key 为 prompt_id
+type eventPublisher interface {
+	Publish(key string, payload []byte) error
+	Close() error
+}
+
+// newEventPublisher 按 URL 的 scheme 选择 nats://（tls:// 为使用 TLS 的 NATS）或 kafka://，多个地址用逗号分隔
+func newEventPublisher(rawURL, topic string) (eventPublisher, error) {
+	scheme, hosts, ok := strings.Cut(rawURL, "://")
+	if !ok || hosts == "" {
+		return nil, fmt.Errorf("事件发布地址格式错误: %s", rawURL)
+	}
+
+	switch scheme {
+	case "nats", "tls":
+		servers := strings.Split(hosts, ",")
+		for i, host := range servers {
+			servers[i] = scheme + "://" + host
+		}
+		return newNATSPublisher(servers, topic)
+	case "kafka":
+		return newKafkaPublisher(strings.Split(hosts, ","), topic), nil
+	default:
+		return nil, fmt.Errorf("不支持的事件发布协议: %s", scheme)
+	}
+}
+
+// publishEvent 发布 queued、started、progress、completed、failed 等生命周期事件，调用方不能持有锁
+func (m *ComfyUIMock) publishEvent(event string, prompt *PromptInfo, extra gin.H) {
+	if m.publisher == nil {
+		return
+	}
+
+	payload := gin.H{
+		"event":     event,
+		"prompt_id": prompt.PromptID,
+		"client_id": prompt.ClientID,
+		"number":    prompt.ID,
+		"timestamp": m.clock.millis(time.Now()),
+	}
+	for key, value := range extra {
+		payload[key] = value
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Printf("编码事件失败: %v\n", err)
+		return
+	}
+	if err := m.publisher.Publish(prompt.PromptID, data); err != nil {
+		fmt.Printf("发布事件失败: %v\n", err)
+	}
+}
+
+// natsPublisher 使用 nats.go 发布消息，断线后自动重连，重连期间的消息缓存在客户端
+type natsPublisher struct {
+	conn    *nats.Conn
+	subject string
+}
+
+// newNATSPublisher 连接 servers 中的 NATS 服务器，地址中可以带用户名和密码，tls:// 使用 TLS
+func newNATSPublisher(servers []string, subject string) (*natsPublisher, error) {
+	conn, err := nats.Connect(strings.Join(servers, ","),
+		nats.Name("mock-comfy"),
+		nats.Timeout(5*time.Second),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				fmt.Printf("NATS 连接断开: %v\n", err)
+			}
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			fmt.Printf("NATS 已重连: %s\n", conn.ConnectedUrl())
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			fmt.Printf("NATS 返回错误: %v\n", err)
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("连接 NATS 失败: %w", err)
+	}
+	return &natsPublisher{conn: conn, subject: subject}, nil
+}
+
+func (p *natsPublisher) Publish(key string, payload []byte) error {
+	return p.conn.Publish(p.subject, payload)
+}
+
+// Close 发送缓存中的消息后断开连接
+func (p *natsPublisher) Close() error {
+	err := p.conn.FlushTimeout(5 * time.Second)
+	p.conn.Close()
+	return err
+}
+
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func newKafkaPublisher(brokers []string, topic string) *kafkaPublisher {
+	return &kafkaPublisher{writer: &kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Topic:                  topic,
+		Balancer:               &kafka.Hash{},
+		BatchTimeout:           10 * time.Millisecond,
+		AllowAutoTopicCreation: true,
+		// 异步写入不阻塞执行流程，同一个 prompt 的事件落在同一分区，顺序不变
+		Async: true,
+		Completion: func(messages []kafka.Message, err error) {
+			if err != nil {
+				fmt.Printf("发布事件到 Kafka 失败: %v\n", err)
+			}
+		},
+	}}
+}
+
+func (p *kafkaPublisher) Publish(key string, payload []byte) error {
+	return p.writer.WriteMessages(context.Background(), kafka.Message{Key: []byte(key), Value: payload})
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var defaultExtensions = []string{
+	"/extensions/core/clipspace.js",
+	"/extensions/core/colorPalette.js",
+	"/extensions/core/contextMenuFilter.js",
+	"/extensions/core/dynamicPrompts.js",
+	"/extensions/core/groupNode.js",
+	"/extensions/core/maskeditor.js",
+	"/extensions/core/nodeTemplates.js",
+	"/extensions/core/rerouteNode.js",
+	"/extensions/core/uploadImage.js",
+	"/extensions/core/widgetInputs.js",
+}
+
+func (m *ComfyUIMock) handleExtensions(c *gin.Context) {
+	if m.cfg.Extensions == "" {
+		c.JSON(http.StatusOK, defaultExtensions)
+		return
+	}
+
+	extensions := []string{}
+	for _, extension := range strings.Split(m.cfg.Extensions, ",") {
+		if extension = strings.TrimSpace(extension); extension != "" {
+			extensions = append(extensions, extension)
+		}
+	}
+	c.JSON(http.StatusOK, extensions)
+}
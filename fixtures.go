@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+// defaultImage 是内置的输出图片，未配置 --image-fixture 时不依赖任何外部文件
+//
+//go:embed resources/default.png
+var defaultImage []byte
+
+// defaultObjectInfo 在 fixtures 目录中没有 object_info.json 时使用
+//
+//go:embed resources/object_info.json
+var defaultObjectInfo []byte
+
+// imageFixturePath 由 --image-fixture 配置，为空时使用内置图片
+var imageFixturePath string
+
+// imageFixtureData 在 in-memory 模式下缓存 --image-fixture 的内容，避免每次生成输出都读磁盘
+var imageFixtureData []byte
+
+// imageFixture 返回输出图片的内容
+func imageFixture() ([]byte, error) {
+	if imageFixturePath == "" {
+		return defaultImage, nil
+	}
+	if imageFixtureData != nil {
+		return imageFixtureData, nil
+	}
+	data, err := os.ReadFile(imageFixturePath)
+	if err != nil {
+		return nil, fmt.Errorf("读取图片 fixture 失败: %w", err)
+	}
+	return data, nil
+}
+
+// imageExt 输出图片的扩展名与图片来源一致
+func imageExt() string {
+	if imageFixturePath == "" {
+		return ".png"
+	}
+	return strings.ToLower(filepath.Ext(imageFixturePath))
+}
+
+func outputImageName(prompt *PromptInfo) string {
+	return "output_" + shortPromptID(prompt) + promptExt(prompt)
+}
+
+// saveImageName 返回第 index 个 SaveImage 节点的文件名，第一个节点沿用 outputImageName，其余节点加上节点 ID 避免重名
+func saveImageName(prompt *PromptInfo, index int, nodeID string) string {
+	if index == 0 {
+		return outputImageName(prompt)
+	}
+	return "output_" + shortPromptID(prompt) + "_" + nodeID + promptExt(prompt)
+}
+
+// shortPromptID 返回文件名中使用的 prompt_id 前 8 位，导入的 prompt_id 可能更短
+func shortPromptID(prompt *PromptInfo) string {
+	if len(prompt.PromptID) <= 8 {
+		return prompt.PromptID
+	}
+	return prompt.PromptID[:8]
+}
+
+func decodeImageFixture() (image.Image, error) {
+	data, err := imageFixture()
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解码源图片失败: %w", err)
+	}
+	return img, nil
+}
+
+func decodeImageFile(path string) (image.Image, error) {
+	data, err := readOutputFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开源文件失败: %w", err)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解码源图片失败: %w", err)
+	}
+	return img, nil
+}
+
+// encodeImage 按扩展名选择 PNG、JPEG 或 WEBP 编码
+func encodeImage(w io.Writer, img image.Image, format imageFormat) error {
+	switch format.ext {
+	case ".jpg", ".jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: format.quality})
+	case ".webp":
+		return nativewebp.Encode(w, img, nil)
+	}
+	return png.Encode(w, img)
+}
+
+// loadFixtures 读取 --script、--models-fixture、object_info 和 --metadata-fixture 等文件，
+// 启动时和收到 SIGHUP 时调用。全部读取成功后才替换，读取失败时保留当前的内容
+func (m *ComfyUIMock) loadFixtures() error {
+	var scripts *scriptHooks
+	if m.cfg.Script != "" {
+		loaded, err := loadScript(m.cfg.Script)
+		if err != nil {
+			return err
+		}
+		scripts = loaded
+	}
+
+	models := defaultModels()
+	if m.cfg.ModelsFixture != "" {
+		loaded, err := loadModelsFixture(m.cfg.ModelsFixture)
+		if err != nil {
+			return err
+		}
+		models = loaded
+	}
+
+	objectInfo, err := loadObjectInfo(fixturePath("object_info.json"), m.cfg.CustomNodes)
+	if err != nil {
+		return err
+	}
+
+	metadata := defaultModelMetadata()
+	if m.cfg.MetadataFixture != "" {
+		loaded, err := loadModelMetadataFixture(m.cfg.MetadataFixture)
+		if err != nil {
+			return err
+		}
+		metadata = loaded
+	}
+
+	m.mu.Lock()
+	m.scripts = scripts
+	m.models = models
+	m.objectInfo = objectInfo
+	m.modelMetadata = metadata
+	m.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"strings"
+)
+
+// outputFormat 和 outputQuality 由 --output-format 和 --output-quality 配置，outputFormat 为空时与图片来源一致
+var (
+	outputFormat  string
+	outputQuality = 90
+)
+
+// imageFormatExts 是支持的输出格式对应的扩展名
+var imageFormatExts = map[string]string{
+	"png":  ".png",
+	"jpg":  ".jpg",
+	"jpeg": ".jpg",
+	"webp": ".webp",
+}
+
+// imageFormat 是输出图片的编码方式，quality 只作用于 JPEG，WEBP 总是无损编码
+type imageFormat struct {
+	ext     string
+	quality int
+}
+
+// parseOutputFormat 检查 --output-format 的值
+func parseOutputFormat(value string) error {
+	if value == "" {
+		return nil
+	}
+	if _, ok := imageFormatExts[strings.ToLower(value)]; !ok {
+		return fmt.Errorf("不支持的输出格式: %s，可选 png、jpeg、webp", value)
+	}
+	return nil
+}
+
+// promptImageFormat 返回 prompt 输出图片的格式：图中节点的 format、extension 或 file_type 输入优先，
+// 同一节点的 quality 输入覆盖 --output-quality，其次是 --output-format。都没有时 chosen 为 false，输出与图片来源一致
+func promptImageFormat(graph map[string]interface{}) (format imageFormat, chosen bool) {
+	format = imageFormat{ext: imageExt(), quality: outputQuality}
+	if ext, ok := imageFormatExts[strings.ToLower(outputFormat)]; ok {
+		format.ext = ext
+		chosen = true
+	}
+
+	for _, nodeID := range sortedNodeIDs(graph) {
+		node, _ := graph[nodeID].(map[string]interface{})
+		inputs, _ := node["inputs"].(map[string]interface{})
+		for _, name := range []string{"format", "extension", "file_type"} {
+			value, _ := inputs[name].(string)
+			ext, ok := imageFormatExts[strings.ToLower(strings.TrimPrefix(value, "."))]
+			if !ok {
+				continue
+			}
+			format.ext = ext
+			if quality, ok := inputs["quality"].(float64); ok && quality > 0 && quality <= 100 {
+				format.quality = int(quality)
+			}
+			return format, true
+		}
+	}
+	return format, chosen
+}
+
+// promptExt 返回 prompt 输出图片的扩展名
+func promptExt(prompt *PromptInfo) string {
+	format, _ := promptImageFormat(prompt.Prompt)
+	return format.ext
+}
+
+// matchesFormat 判断图片数据的实际编码是否与 format 的扩展名一致，不一致时需要重新编码，否则 /view 返回的 Content-Type 与内容不符
+func matchesFormat(data []byte, format imageFormat) bool {
+	_, name, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	switch name {
+	case "jpeg":
+		return format.ext == ".jpg" || format.ext == ".jpeg"
+	case "png", "webp":
+		return format.ext == "."+name
+	}
+	return false
+}
+
+// convertImage 将图片重新编码为 format
+func convertImage(data []byte, format imageFormat) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解码源图片失败: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := encodeImage(&buf, img, format); err != nil {
+		return nil, fmt.Errorf("编码输出图片失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// OutputGenerator 为整个 prompt 生成 history outputs 和对应的文件，用于接入特定领域的假输出，
+// 例如真实模型生成的缩略图。实现放在单独的文件中，在 init 里调用 RegisterOutputGenerator 注册，
+// 启动时用 --output-generator 选择。返回 nil outputs 时使用内置的输出
+type OutputGenerator interface {
+	Generate(graph map[string]interface{}, prompt *PromptInfo) (map[string]interface{}, []OutputFile, error)
+}
+
+// OutputGeneratorFunc 让普通函数实现 OutputGenerator
+type OutputGeneratorFunc func(graph map[string]interface{}, prompt *PromptInfo) (map[string]interface{}, []OutputFile, error)
+
+func (f OutputGeneratorFunc) Generate(graph map[string]interface{}, prompt *PromptInfo) (map[string]interface{}, []OutputFile, error) {
+	return f(graph, prompt)
+}
+
+// OutputFile 是生成器返回的文件，Type 为 output 或 temp，写入后可以通过 /view 读取
+type OutputFile struct {
+	Type      string
+	Subfolder string
+	Filename  string
+	Data      []byte
+}
+
+var (
+	generatorsMu      sync.Mutex
+	registeredOutputs = map[string]OutputGenerator{}
+	selectedGenerator OutputGenerator
+)
+
+// RegisterOutputGenerator 注册一个输出生成器，重复注册同一个名字时 panic
+func RegisterOutputGenerator(name string, generator OutputGenerator) {
+	generatorsMu.Lock()
+	defer generatorsMu.Unlock()
+
+	if _, exists := registeredOutputs[name]; exists {
+		panic(fmt.Sprintf("输出生成器 %s 已注册", name))
+	}
+	registeredOutputs[name] = generator
+}
+
+// selectOutputGenerator 按 --output-generator 选择生成器，为空时使用内置的输出
+func selectOutputGenerator(name string) error {
+	generatorsMu.Lock()
+	defer generatorsMu.Unlock()
+
+	if name == "" {
+		selectedGenerator = nil
+		return nil
+	}
+	generator, ok := registeredOutputs[name]
+	if !ok {
+		names := make([]string, 0, len(registeredOutputs))
+		for registered := range registeredOutputs {
+			names = append(names, registered)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("未注册的输出生成器 %s，可用的生成器: [%s]", name, strings.Join(names, ", "))
+	}
+	selectedGenerator = generator
+	return nil
+}
+
+// pluginOutputs 调用选择的生成器并写入返回的文件，没有选择生成器或生成器返回 nil 时 ok 为 false
+func pluginOutputs(prompt *PromptInfo) (map[string]interface{}, bool, error) {
+	generatorsMu.Lock()
+	generator := selectedGenerator
+	generatorsMu.Unlock()
+	if generator == nil {
+		return nil, false, nil
+	}
+
+	outputs, files, err := generator.Generate(prompt.Prompt, prompt)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, file := range files {
+		path, err := resolveFilePath(file.Type, file.Subfolder, file.Filename)
+		if err != nil {
+			return nil, false, fmt.Errorf("输出文件 %s 路径无效: %w", file.Filename, err)
+		}
+		if err := writeFile(path, file.Data); err != nil {
+			return nil, false, err
+		}
+	}
+	return outputs, outputs != nil, nil
+}
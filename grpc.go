@@ -0,0 +1,189 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative comfypb/comfy.proto
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/nofrish/mock-comfy/comfypb"
+)
+
+// grpcServer 在 gRPC 上提供与 /prompt、/history 和 /ws 相同的行为
+type grpcServer struct {
+	comfypb.UnimplementedComfyUIServer
+	mock *ComfyUIMock
+}
+
+func (m *ComfyUIMock) serveGRPC(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("监听 gRPC 地址失败: %w", err)
+	}
+
+	server := grpc.NewServer()
+	comfypb.RegisterComfyUIServer(server, &grpcServer{mock: m})
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			fmt.Printf("gRPC 服务退出: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// unavailable 模拟崩溃期间拒绝所有 gRPC 请求
+func (s *grpcServer) unavailable() error {
+	s.mock.mu.Lock()
+	defer s.mock.mu.Unlock()
+	if s.mock.crashed() {
+		return status.Error(codes.Unavailable, "server is restarting")
+	}
+	return nil
+}
+
+func (s *grpcServer) QueuePrompt(ctx context.Context, req *comfypb.QueuePromptRequest) (*comfypb.QueuePromptResponse, error) {
+	if err := s.unavailable(); err != nil {
+		return nil, err
+	}
+
+	var graph map[string]interface{}
+	if err := json.Unmarshal([]byte(req.PromptJson), &graph); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid prompt_json: %v", err)
+	}
+	if s.mock.cfg.Strict {
+		if validationErr, nodeErrors := validatePrompt(graph, s.mock.currentObjectInfo()); validationErr != nil {
+			details, _ := json.Marshal(gin.H{"error": validationErr, "node_errors": nodeErrors})
+			return nil, status.Error(codes.InvalidArgument, string(details))
+		}
+	}
+
+	s.mock.mu.Lock()
+	draining := s.mock.drain != nil
+	s.mock.mu.Unlock()
+	if draining {
+		return nil, status.Error(codes.Unavailable, "server is draining")
+	}
+	prompt, quotaErr := s.mock.enqueuePrompt(ctx, req.ClientId, graph, nil, 0)
+	if quotaErr != nil {
+		return nil, status.Error(codes.ResourceExhausted, quotaErr.Error())
+	}
+	clientIP := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		clientIP, _, _ = net.SplitHostPort(p.Addr.String())
+	}
+	s.mock.audit.record(auditEntry{
+		Time:     s.mock.clock.report(time.Now()),
+		Action:   "submit",
+		Method:   "gRPC",
+		Path:     comfypb.ComfyUI_QueuePrompt_FullMethodName,
+		Status:   int(codes.OK),
+		ClientIP: clientIP,
+		ClientID: req.ClientId,
+		Details:  map[string]interface{}{"prompt_id": prompt.PromptID},
+	})
+	return &comfypb.QueuePromptResponse{PromptId: prompt.PromptID, Number: int32(prompt.ID)}, nil
+}
+
+func (s *grpcServer) GetHistory(ctx context.Context, req *comfypb.GetHistoryRequest) (*comfypb.GetHistoryResponse, error) {
+	if err := s.unavailable(); err != nil {
+		return nil, err
+	}
+
+	prompt, exists := s.mock.lookupPrompt(req.PromptId)
+	if !exists || !s.mock.visibleTo(prompt, req.ClientId) {
+		return nil, status.Error(codes.NotFound, "Prompt not found")
+	}
+
+	data, err := json.Marshal(s.mock.historyResponse(prompt))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &comfypb.GetHistoryResponse{HistoryJson: string(data)}, nil
+}
+
+func (s *grpcServer) StreamEvents(req *comfypb.StreamEventsRequest, stream comfypb.ComfyUI_StreamEventsServer) error {
+	if err := s.unavailable(); err != nil {
+		return err
+	}
+
+	sid := req.ClientId
+	if sid == "" {
+		sid = strings.ReplaceAll(uuid.New().String(), "-", "")
+	}
+
+	m := s.mock
+	client := newGRPCEventClient()
+	m.ws.add(sid, client)
+	defer m.ws.remove(sid, client)
+
+	m.mu.Lock()
+	statusData := m.statusData()
+	m.mu.Unlock()
+	statusData["sid"] = sid
+	m.ws.sendTo(sid, client, "status", statusData)
+
+	for {
+		select {
+		case event := <-client.events:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		case <-client.done:
+			return status.Error(codes.Unavailable, "server is restarting")
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// grpcEventClient 将 hub 中的消息转换为 gRPC Event
+type grpcEventClient struct {
+	events chan *comfypb.Event
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newGRPCEventClient() *grpcEventClient {
+	return &grpcEventClient{events: make(chan *comfypb.Event, 256), done: make(chan struct{})}
+}
+
+func (c *grpcEventClient) push(event *comfypb.Event) error {
+	select {
+	case c.events <- event:
+		return nil
+	case <-c.done:
+		return fmt.Errorf("gRPC 连接已关闭")
+	default:
+		return fmt.Errorf("gRPC 发送缓冲区已满")
+	}
+}
+
+func (c *grpcEventClient) writeJSON(v interface{}) error {
+	message, _ := v.(gin.H)
+	msgType, _ := message["type"].(string)
+	data, err := json.Marshal(message["data"])
+	if err != nil {
+		return err
+	}
+	return c.push(&comfypb.Event{Type: msgType, DataJson: string(data)})
+}
+
+func (c *grpcEventClient) writeBinary(data []byte) error {
+	return c.push(&comfypb.Event{Type: "binary", Binary: data})
+}
+
+func (c *grpcEventClient) close() {
+	c.once.Do(func() { close(c.done) })
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"path/filepath"
+	"strings"
+)
+
+// resolveImageInput 解析 LoadImage 的 image 输入，返回引用的文件路径。
+// 与 ComfyUI 一致支持 "[input]"、"[output]"、"[temp]" 注解；没有注解且 input 目录中不存在时，
+// 依次在 output 和 temp 目录中查找，前一个 prompt 的输出文件名可以直接作为后一个 prompt 的输入
+func resolveImageInput(name string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+
+	fileTypes := []string{"input", "output", "temp"}
+	for _, annotated := range fileTypes {
+		suffix := " [" + annotated + "]"
+		if strings.HasSuffix(name, suffix) {
+			name = strings.TrimSuffix(name, suffix)
+			fileTypes = []string{annotated}
+			break
+		}
+	}
+
+	for _, fileType := range fileTypes {
+		path, err := resolveFilePath(fileType, filepath.Dir(name), filepath.Base(name))
+		if err != nil {
+			return "", false
+		}
+		if outputFileExists(path) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// isImageUpload 判断 object_info 中的输入是否是带 image_upload 的图片选择框，
+// ComfyUI 的 LoadImage 对这类输入用 VALIDATE_INPUTS 检查文件是否存在，不检查选项
+func isImageUpload(spec interface{}) bool {
+	specList, _ := spec.([]interface{})
+	if len(specList) < 2 {
+		return false
+	}
+	options, _ := specList[1].(map[string]interface{})
+	upload, _ := options["image_upload"].(bool)
+	return upload
+}
+
+// validateImageInput 检查 image_upload 输入引用的文件是否存在，错误信息与 ComfyUI 的 LoadImage 一致
+func validateImageInput(name string, value interface{}) map[string]interface{} {
+	filename, _ := value.(string)
+	if _, ok := resolveImageInput(filename); ok {
+		return nil
+	}
+	return inputError("custom_validation_failed", "Custom validation failed for node",
+		fmt.Sprintf("%s - Invalid image file: %v", name, value), name)
+}
+
+// loadImageDimensions 返回 LoadImage 引用的图片的尺寸
+func loadImageDimensions(inputs map[string]interface{}) (int, int, bool) {
+	name, _ := inputs["image"].(string)
+	path, ok := resolveImageInput(name)
+	if !ok {
+		return 0, 0, false
+	}
+	data, err := readOutputFile(path)
+	if err != nil {
+		return 0, 0, false
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, false
+	}
+	return config.Width, config.Height, true
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleHealthz 进程存活即返回 200
+func (m *ComfyUIMock) handleHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// handleReadyz 在 --warmup 时间内返回 503，模拟 ComfyUI 启动时加载模型，排空期间同样返回 503
+func (m *ComfyUIMock) handleReadyz(c *gin.Context) {
+	m.mu.Lock()
+	remaining := m.cfg.Warmup - time.Since(m.startedAt)
+	draining := m.drain != nil
+	m.mu.Unlock()
+	if draining {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	}
+	if remaining > 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":            "warming_up",
+			"remaining_seconds": remaining.Seconds(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// historyFilter 是 GET /history 的查询条件，max_items 和 offset 与 ComfyUI 一致，其余为 mock 的扩展
+type historyFilter struct {
+	clientID string
+	status   string
+	since    time.Time
+	until    time.Time
+	labels   labelSelector
+	maxItems int
+	offset   int
+}
+
+func parseHistoryFilter(c *gin.Context) (historyFilter, error) {
+	filter := historyFilter{clientID: c.Query("client_id"), status: c.Query("status"), maxItems: -1}
+
+	switch filter.status {
+	case "", "success", "error":
+	default:
+		return filter, fmt.Errorf("invalid status: %s", filter.status)
+	}
+
+	var err error
+	if filter.labels, err = parseLabelSelector(c.QueryArray("label")); err != nil {
+		return filter, err
+	}
+	if filter.since, err = parseTimeParam(c.Query("since")); err != nil {
+		return filter, fmt.Errorf("invalid since: %w", err)
+	}
+	if filter.until, err = parseTimeParam(c.Query("until")); err != nil {
+		return filter, fmt.Errorf("invalid until: %w", err)
+	}
+	if value := c.Query("max_items"); value != "" {
+		if filter.maxItems, err = strconv.Atoi(value); err != nil || filter.maxItems < 0 {
+			return filter, fmt.Errorf("invalid max_items: %s", value)
+		}
+	}
+	if value := c.Query("offset"); value != "" {
+		if filter.offset, err = strconv.Atoi(value); err != nil || filter.offset < 0 {
+			return filter, fmt.Errorf("invalid offset: %s", value)
+		}
+	}
+	return filter, nil
+}
+
+// parseTimeParam 接受 Unix 秒（可以带小数）或 RFC 3339 时间
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.UnixMilli(int64(seconds * 1000)), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (f historyFilter) match(prompt *PromptInfo) bool {
+	switch {
+	case f.status == "success" && prompt.Status != "completed":
+		return false
+	case f.status == "error" && prompt.Status != "failed":
+		return false
+	case !f.since.IsZero() && prompt.FinishedAt.Before(f.since):
+		return false
+	case !f.until.IsZero() && prompt.FinishedAt.After(f.until):
+		return false
+	}
+	return f.labels.match(prompt)
+}
+
+// handleHistoryList 按完成时间从新到旧返回 history，max_items 和 offset 用于分页
+func (m *ComfyUIMock) handleHistoryList(c *gin.Context) {
+	filter, err := parseHistoryFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// since 和 until 是客户端按偏移后的时间计算的
+	if !filter.since.IsZero() {
+		filter.since = m.clock.local(filter.since)
+	}
+	if !filter.until.IsZero() {
+		filter.until = m.clock.local(filter.until)
+	}
+
+	listed, seq := m.sharedPrompts()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	finished := []*PromptInfo{}
+	prompts := m.reconcileShared(listed, seq)
+	for _, prompt := range m.prompts {
+		prompts = append(prompts, prompt)
+	}
+	for _, prompt := range prompts {
+		if prompt.Status != "completed" && prompt.Status != "failed" {
+			continue
+		}
+		if m.visibleTo(prompt, filter.clientID) && filter.match(prompt) {
+			finished = append(finished, prompt)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		if !finished[i].FinishedAt.Equal(finished[j].FinishedAt) {
+			return finished[i].FinishedAt.After(finished[j].FinishedAt)
+		}
+		return finished[i].PromptID < finished[j].PromptID
+	})
+
+	total := len(finished)
+	if filter.offset < len(finished) {
+		finished = finished[filter.offset:]
+	} else {
+		finished = nil
+	}
+	if filter.maxItems >= 0 && filter.maxItems < len(finished) {
+		finished = finished[:filter.maxItems]
+	}
+
+	history := orderedObject{}
+	for _, prompt := range finished {
+		history = append(history, orderedField{prompt.PromptID, m.historyEntry(prompt)})
+	}
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.JSON(http.StatusOK, history)
+}
+
+// handleHistoryUpdate 与 ComfyUI 的 POST /history 一致：clear 清空 history，delete 删除指定的 prompt，
+// 只删除已经执行完的 prompt，输出文件保留
+func (m *ComfyUIMock) handleHistoryUpdate(c *gin.Context) {
+	var request struct {
+		Clear  bool     `json:"clear"`
+		Delete []string `json:"delete"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	listed, seq := m.sharedPrompts()
+	m.mu.Lock()
+	finished := map[string]*PromptInfo{}
+	for _, prompt := range m.reconcileShared(listed, seq) {
+		finished[prompt.PromptID] = prompt
+	}
+	for promptID, prompt := range m.prompts {
+		finished[promptID] = prompt
+	}
+	for promptID, prompt := range finished {
+		if prompt.Status != "completed" && prompt.Status != "failed" {
+			delete(finished, promptID)
+		}
+	}
+
+	promptIDs := request.Delete
+	if request.Clear {
+		c.Set(auditActionKey, "history_clear")
+		promptIDs = nil
+		for promptID := range finished {
+			promptIDs = append(promptIDs, promptID)
+		}
+		sort.Strings(promptIDs)
+	}
+	deleted := []string{}
+	for _, promptID := range promptIDs {
+		if _, ok := finished[promptID]; !ok {
+			continue
+		}
+		delete(finished, promptID)
+		delete(m.prompts, promptID)
+		m.unpersist(promptID)
+		deleted = append(deleted, promptID)
+	}
+	m.mu.Unlock()
+	auditDetail(c, "deleted", deleted)
+
+	c.Status(http.StatusOK)
+}
+
+type orderedField struct {
+	key   string
+	value interface{}
+}
+
+// orderedObject 按顺序输出 JSON 对象的键，map 会被 encoding/json 按键排序
+type orderedObject []orderedField
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(field.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errInterrupted 是 POST /interrupt 取消执行中 prompt 的原因
+var errInterrupted = errors.New("interrupted by client")
+
+// handleInterrupt 与 ComfyUI 一致中断执行中的 prompt，请求体可以为空；指定了 prompt_id 时只在该 prompt 正在执行时中断
+func (m *ComfyUIMock) handleInterrupt(c *gin.Context) {
+	var request struct {
+		PromptID string `json:"prompt_id"`
+	}
+	// ComfyUI 忽略无法解析的请求体
+	c.ShouldBindJSON(&request)
+
+	// /__mock/stuck 安装的 prompt 模拟卡死的节点，不响应中断
+	m.mu.Lock()
+	prompt := m.runningTask
+	if prompt == nil || prompt.stuck || (request.PromptID != "" && prompt.PromptID != request.PromptID) {
+		m.mu.Unlock()
+		c.Status(http.StatusOK)
+		return
+	}
+	m.cancelRunning(errInterrupted)
+	markFailed(prompt, "comfy.model_management.InterruptProcessingException", "Interrupted by client")
+	m.persist(prompt)
+	m.stats.record(prompt, prompt.Status, time.Now())
+	m.mu.Unlock()
+	auditDetail(c, "prompt_id", prompt.PromptID)
+
+	prompt.trace.finish(prompt.Status, prompt.Error)
+	m.logf("Processing interrupted")
+	m.ws.send(prompt.ClientID, "execution_interrupted", gin.H{
+		"prompt_id": prompt.PromptID,
+		"node_id":   prompt.Error["node_id"],
+		"node_type": prompt.Error["node_type"],
+		"executed":  []string{},
+		"timestamp": m.clock.millis(time.Now()),
+	})
+	m.publishEvent("failed", prompt, gin.H{"error": prompt.Error})
+	m.broadcastStatus()
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// janitorTypes 是 janitor 默认清理的文件类型，input 中是用户上传的文件，需要显式开启
+var janitorTypes = []string{"output", "temp"}
+
+// runJanitor 定期按 --cleanup-max-age 和 --cleanup-max-size 清理输出目录
+func (m *ComfyUIMock) runJanitor() {
+	ticker := time.NewTicker(m.cfg.CleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		fileTypes := janitorTypes
+		if m.cfg.CleanupInputs {
+			fileTypes = append(fileTypes, "input")
+		}
+		for _, fileType := range fileTypes {
+			dir, _ := typeDir(fileType)
+			removed, err := cleanupDir(dir, m.cfg.CleanupMaxAge, m.cfg.CleanupSizeMB*mib)
+			if err != nil {
+				fmt.Printf("清理目录 %s 失败: %v\n", dir, err)
+			}
+			if removed > 0 {
+				fmt.Printf("清理目录 %s: 删除 %d 个文件\n", dir, removed)
+			}
+		}
+	}
+}
+
+type fileEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// cleanupDir 删除超过 maxAge 的文件，总大小超过 maxSize 时再从最旧的文件开始删除，0 表示不限制
+func cleanupDir(dir string, maxAge time.Duration, maxSize int64) (int, error) {
+	files := []fileEntry{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, fileEntry{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	var total int64
+	for _, file := range files {
+		total += file.size
+	}
+
+	removed := 0
+	now := time.Now()
+	for _, file := range files {
+		expired := maxAge > 0 && now.Sub(file.modTime) > maxAge
+		oversize := maxSize > 0 && total > maxSize
+		if !expired && !oversize {
+			continue
+		}
+		if err := os.Remove(file.path); err != nil {
+			return removed, err
+		}
+		disk.add(-file.size)
+		total -= file.size
+		removed++
+	}
+	return removed, nil
+}
+
+// wipeDir 删除目录下的所有内容，保留目录本身
+func wipeDir(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// 删除的是整棵目录，不逐个统计文件大小
+	defer disk.reset()
+	for i, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
+
+func (m *ComfyUIMock) handleFilesWipe(c *gin.Context) {
+	var request struct {
+		Types []string `json:"types"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(request.Types) == 0 {
+		request.Types = janitorTypes
+	}
+
+	removed := gin.H{}
+	for _, fileType := range request.Types {
+		dir, ok := typeDir(fileType)
+		if !ok || fileType == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid type: " + fileType})
+			return
+		}
+		count, err := wipeDir(dir)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		removed[fileType] = count + wipeMemFiles(dir)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"removed": removed})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// labelsKey 是 extra_data 中的任务标签，值为 {"key": "value"} 对象或字符串数组，字符串数组中的标签值为空
+const labelsKey = "labels"
+
+// promptLabels 返回 extra_data 中的标签
+func promptLabels(extraData map[string]interface{}) (map[string]string, error) {
+	labels := map[string]string{}
+	switch value := extraData[labelsKey].(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		for key, item := range value {
+			switch item := item.(type) {
+			case string:
+				labels[key] = item
+			case float64, bool:
+				labels[key] = fmt.Sprint(item)
+			default:
+				return nil, fmt.Errorf("invalid %s: value of %s must be a string", labelsKey, key)
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			key, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid %s: %v", labelsKey, value)
+			}
+			labels[key] = ""
+		}
+	default:
+		return nil, fmt.Errorf("invalid %s: %v", labelsKey, value)
+	}
+	return labels, nil
+}
+
+// labelSelector 是 /queue 和 /history 的 label 查询参数，可以重复，所有条件都满足时匹配。
+// "key" 只要求有这个标签，"key=value" 要求标签值相等
+type labelSelector []labelRequirement
+
+type labelRequirement struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+func parseLabelSelector(values []string) (labelSelector, error) {
+	selector := labelSelector{}
+	for _, value := range values {
+		key, labelValue, hasValue := strings.Cut(value, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid label: %s", value)
+		}
+		selector = append(selector, labelRequirement{key: key, value: labelValue, hasValue: hasValue})
+	}
+	return selector, nil
+}
+
+func (s labelSelector) match(prompt *PromptInfo) bool {
+	for _, requirement := range s {
+		value, ok := prompt.Labels[requirement.key]
+		if !ok || (requirement.hasValue && value != requirement.value) {
+			return false
+		}
+	}
+	return true
+}
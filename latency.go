@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// z99 是标准正态分布的 99 分位数
+const z99 = 2.326
+
+// endpointLatency 是单个路径的响应延迟分布，按 p50 和 p99 拟合对数正态分布，p99 为 0 时为固定延迟
+type endpointLatency struct {
+	path string
+	p50  time.Duration
+	p99  time.Duration
+}
+
+// parseEndpointLatency 解析 "/history=300ms:2s" 形式的配置，路径匹配自身及其下的子路径
+func parseEndpointLatency(spec string) (endpointLatency, error) {
+	path, value, ok := strings.Cut(spec, "=")
+	path = strings.TrimSpace(path)
+	if !ok || !strings.HasPrefix(path, "/") {
+		return endpointLatency{}, fmt.Errorf("接口延迟格式错误: %s", spec)
+	}
+	p50Value, p99Value, hasP99 := strings.Cut(value, ":")
+	p50, err := time.ParseDuration(strings.TrimSpace(p50Value))
+	if err != nil || p50 < 0 {
+		return endpointLatency{}, fmt.Errorf("接口延迟格式错误: %s", spec)
+	}
+	latency := endpointLatency{path: strings.TrimSuffix(path, "/"), p50: p50}
+	if hasP99 {
+		latency.p99, err = time.ParseDuration(strings.TrimSpace(p99Value))
+		if err != nil || latency.p99 < p50 {
+			return endpointLatency{}, fmt.Errorf("接口延迟格式错误，p99 不能小于 p50: %s", spec)
+		}
+	}
+	return latency, nil
+}
+
+func (l endpointLatency) matches(path string) bool {
+	return path == l.path || strings.HasPrefix(path, l.path+"/")
+}
+
+// sample 返回一次延迟，中位数为 p50，99% 的请求不超过 p99
+func (l endpointLatency) sample() time.Duration {
+	if l.p99 <= l.p50 || l.p50 <= 0 {
+		return l.p50
+	}
+	sigma := math.Log(float64(l.p99)/float64(l.p50)) / z99
+	return time.Duration(float64(l.p50) * math.Exp(sigma*rand.NormFloat64()))
+}
+
+// endpointLatencyMiddleware 按 --endpoint-latency 为匹配的接口增加随机延迟，多个配置匹配时使用最长的路径
+func endpointLatencyMiddleware(latencies []endpointLatency) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var matched *endpointLatency
+		for i := range latencies {
+			if latencies[i].matches(c.Request.URL.Path) && (matched == nil || len(latencies[i].path) > len(matched.path)) {
+				matched = &latencies[i]
+			}
+		}
+		if matched != nil {
+			time.Sleep(matched.sample())
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// terminalNodes 返回输出没有被其他节点引用的节点，即图的终端节点
+func terminalNodes(graph map[string]interface{}) []string {
+	referenced := map[string]bool{}
+	for _, value := range graph {
+		node, _ := value.(map[string]interface{})
+		inputs, _ := node["inputs"].(map[string]interface{})
+		for _, input := range inputs {
+			if link, ok := input.([]interface{}); ok && len(link) == 2 {
+				referenced[fmt.Sprint(link[0])] = true
+			}
+		}
+	}
+	terminal := []string{}
+	for _, id := range sortedNodeIDs(graph) {
+		if !referenced[id] {
+			terminal = append(terminal, id)
+		}
+	}
+	return terminal
+}
+
+// producesOutput 判断节点是否在 history 中产生 output，--lenient 时所有终端节点都会产生
+func (m *ComfyUIMock) producesOutput(graph map[string]interface{}, nodeID string) bool {
+	if isOutputNode(graph[nodeID]) {
+		return true
+	}
+	if !m.cfg.Lenient {
+		return false
+	}
+	for _, id := range terminalNodes(graph) {
+		if id == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// lenientOutputs 为还没有 output 的终端节点生成输出，不论 class_type，返回生成的数量。
+// SaveImage 和 SaveImageWebsocket 仍按原有方式处理
+func lenientOutputs(prompt *PromptInfo, outputs map[string]interface{}) int {
+	generated := 0
+	for _, nodeID := range terminalNodes(prompt.Prompt) {
+		node, _ := prompt.Prompt[nodeID].(map[string]interface{})
+		classType, _ := node["class_type"].(string)
+		if _, ok := outputs[nodeID]; ok || classType == "SaveImage" || classType == "SaveImageWebsocket" {
+			continue
+		}
+		output, err := echoOutput(prompt, nodeID, node)
+		if err != nil {
+			fmt.Printf("生成节点 %s 的输出时出错: %v\n", nodeID, err)
+			continue
+		}
+		outputs[nodeID] = output
+		generated++
+	}
+	return generated
+}
+
+// echoOutput 为未知节点写入一张图片到 output 目录，并在 echo 中回显节点的 class_type 和非连接输入
+func echoOutput(prompt *PromptInfo, nodeID string, node map[string]interface{}) (map[string]interface{}, error) {
+	filename := nodeFileName("echo", prompt, nodeID, promptExt(prompt))
+	data, err := promptImage(prompt)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(filepath.Join(outputDir, filename), data); err != nil {
+		return nil, err
+	}
+
+	inputs := map[string]interface{}{}
+	nodeInputs, _ := node["inputs"].(map[string]interface{})
+	for name, value := range nodeInputs {
+		if link, ok := value.([]interface{}); ok && len(link) == 2 {
+			continue
+		}
+		inputs[name] = value
+	}
+	return map[string]interface{}{
+		"images": []map[string]interface{}{imageRecord(prompt, filename, "", "output")},
+		"echo":   []map[string]interface{}{{"class_type": node["class_type"], "inputs": inputs}},
+	}, nil
+}
+
+// lenientOutputsToExecute 在 outputsToExecute 的基础上加入所有终端节点
+func lenientOutputsToExecute(graph map[string]interface{}, outputs []string) []string {
+	seen := map[string]bool{}
+	for _, id := range outputs {
+		seen[id] = true
+	}
+	for _, id := range terminalNodes(graph) {
+		if !seen[id] {
+			outputs = append(outputs, id)
+		}
+	}
+	sort.Strings(outputs)
+	return outputs
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bodyLimitMiddleware 与 ComfyUI 的 --max-upload-size 一致，限制所有请求体的大小
+func bodyLimitMiddleware(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, tooLargeResponse(limit, c.Request.ContentLength))
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+func tooLargeResponse(limit, actual int64) gin.H {
+	message := fmt.Sprintf("Maximum request body size %d exceeded", limit)
+	if actual > 0 {
+		message += fmt.Sprintf(", actual body size %d", actual)
+	}
+	return gin.H{"error": message}
+}
+
+// abortTooLarge 请求体在读取过程中超过限制时返回 413，用于没有 Content-Length 的分块上传
+func abortTooLarge(c *gin.Context, err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return false
+	}
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, tooLargeResponse(maxBytesErr.Limit, 0))
+	return true
+}
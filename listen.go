@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemd 传递的第一个 socket 的文件描述符，见 sd_listen_fds(3)
+const listenFDsStart = 3
+
+// listen 按 --addr 创建监听：host:port 监听 TCP，unix:/path 监听 Unix socket，
+// fd:N 使用继承的文件描述符，systemd 使用 socket activation 传入的第一个 socket
+func listen(addr string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		path := strings.TrimPrefix(addr, "unix:")
+		// 上次异常退出留下的 socket 文件会导致监听失败
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("监听 Unix socket 失败: %w", err)
+		}
+		return listener, nil
+
+	case strings.HasPrefix(addr, "fd:"):
+		fd, err := strconv.Atoi(strings.TrimPrefix(addr, "fd:"))
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("文件描述符格式错误: %s", addr)
+		}
+		return fileListener(fd)
+
+	case addr == "systemd":
+		pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+		count, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		if pid != os.Getpid() || count < 1 {
+			return nil, fmt.Errorf("没有 systemd 传入的 socket (LISTEN_PID=%s, LISTEN_FDS=%s)", os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"))
+		}
+		// 子进程不应再使用这些 socket
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+		return fileListener(listenFDsStart)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("监听地址 %s 失败: %w", addr, err)
+	}
+	return listener, nil
+}
+
+func fileListener(fd int) (net.Listener, error) {
+	file := os.NewFile(uintptr(fd), "listener-"+strconv.Itoa(fd))
+	if file == nil {
+		return nil, fmt.Errorf("文件描述符 %d 无效", fd)
+	}
+	defer file.Close()
+
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("文件描述符 %d 不是可用的 socket: %w", fd, err)
+	}
+	return listener, nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type loadgenResult struct {
+	submit   time.Duration
+	complete time.Duration
+	// failed 表示 prompt 已经进入 history，但执行失败
+	failed bool
+	err    error
+}
+
+// runLoadgen 按固定速率向目标服务提交 prompt，并统计延迟分位数
+func runLoadgen(args []string) error {
+	fs := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	target := fs.String("target", "http://localhost:8188", "目标 ComfyUI 地址")
+	rps := fs.Float64("rps", 1, "每秒提交的 prompt 数")
+	workflowPath := fs.String("workflow", "", "API 格式的 workflow JSON 文件")
+	duration := fs.Duration("duration", 30*time.Second, "压测持续时间")
+	wait := fs.Bool("wait", false, "轮询 /history 直到 prompt 完成，并统计完成延迟")
+	pollInterval := fs.Duration("poll-interval", 500*time.Millisecond, "轮询 /history 的间隔")
+	timeout := fs.Duration("timeout", 5*time.Minute, "等待单个 prompt 完成的最长时间")
+	fs.Parse(args)
+
+	if *workflowPath == "" {
+		return fmt.Errorf("必须指定 --workflow")
+	}
+	if *rps <= 0 || math.IsNaN(*rps) || math.IsInf(*rps, 0) {
+		return fmt.Errorf("--rps 必须是大于 0 的有限数")
+	}
+
+	prompt, err := loadWorkflow(*workflowPath)
+	if err != nil {
+		return err
+	}
+
+	baseURL := strings.TrimRight(*target, "/")
+	client := &http.Client{Timeout: 30 * time.Second}
+	clientID := strings.ReplaceAll(uuid.New().String(), "-", "")
+
+	var (
+		mu      sync.Mutex
+		results []loadgenResult
+		wg      sync.WaitGroup
+	)
+
+	// rps 很大时间隔会小于 1ns，time.NewTicker 不接受非正数的间隔
+	ticker := time.NewTicker(max(time.Duration(float64(time.Second) / *rps), time.Nanosecond))
+	defer ticker.Stop()
+	deadline := time.After(*duration)
+
+	fmt.Printf("开始压测 %s，速率 %.2f rps，持续 %s\n", baseURL, *rps, *duration)
+
+loop:
+	for {
+		select {
+		case <-deadline:
+			break loop
+		case <-ticker.C:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res := loadgenOnce(client, baseURL, clientID, prompt, *wait, *pollInterval, *timeout)
+				mu.Lock()
+				results = append(results, res)
+				mu.Unlock()
+			}()
+		}
+	}
+
+	wg.Wait()
+	printLoadgenReport(results, *wait)
+	return nil
+}
+
+// loadWorkflow 读取 workflow 文件，兼容裸 prompt 和 {"prompt": ...} 两种格式
+func loadWorkflow(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 workflow 文件失败: %w", err)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("解析 workflow 文件失败: %w", err)
+	}
+
+	if prompt, ok := body["prompt"].(map[string]interface{}); ok {
+		return prompt, nil
+	}
+	return body, nil
+}
+
+func loadgenOnce(client *http.Client, baseURL, clientID string, prompt map[string]interface{}, wait bool, pollInterval, timeout time.Duration) loadgenResult {
+	payload, err := json.Marshal(map[string]interface{}{
+		"client_id": clientID,
+		"prompt":    prompt,
+	})
+	if err != nil {
+		return loadgenResult{err: err}
+	}
+
+	start := time.Now()
+	resp, err := client.Post(baseURL+"/prompt", "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return loadgenResult{err: err}
+	}
+	defer resp.Body.Close()
+
+	var submitResp struct {
+		PromptID string `json:"prompt_id"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		return loadgenResult{err: fmt.Errorf("提交失败，状态码 %d", resp.StatusCode)}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&submitResp); err != nil {
+		return loadgenResult{err: fmt.Errorf("解析提交响应失败: %w", err)}
+	}
+
+	res := loadgenResult{submit: time.Since(start)}
+	if !wait {
+		return res
+	}
+
+	for time.Since(start) < timeout {
+		time.Sleep(pollInterval)
+
+		done, failed, err := historyCompleted(client, baseURL, submitResp.PromptID)
+		if err != nil {
+			res.err = err
+			return res
+		}
+		if done {
+			res.complete = time.Since(start)
+			res.failed = failed
+			return res
+		}
+	}
+
+	res.err = fmt.Errorf("等待 prompt %s 完成超时", submitResp.PromptID)
+	return res
+}
+
+// historyCompleted 查询 prompt 是否已经进入 history，failed 表示 status_str 为 error
+func historyCompleted(client *http.Client, baseURL, promptID string) (done, failed bool, err error) {
+	resp, err := client.Get(baseURL + "/history/" + promptID)
+	if err != nil {
+		return false, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, false, fmt.Errorf("查询 history 失败，状态码 %d", resp.StatusCode)
+	}
+
+	var history map[string]struct {
+		Status struct {
+			StatusStr string `json:"status_str"`
+		} `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		return false, false, fmt.Errorf("解析 history 响应失败: %w", err)
+	}
+
+	entry, ok := history[promptID]
+	return ok, ok && entry.Status.StatusStr == "error", nil
+}
+
+func printLoadgenReport(results []loadgenResult, wait bool) {
+	var submits, completes []time.Duration
+	failed, executionFailed := 0, 0
+	for _, res := range results {
+		if res.err != nil {
+			failed++
+			continue
+		}
+		submits = append(submits, res.submit)
+		if res.failed {
+			executionFailed++
+			continue
+		}
+		if wait {
+			completes = append(completes, res.complete)
+		}
+	}
+
+	fmt.Printf("总请求数: %d，成功: %d，失败: %d\n", len(results), len(results)-failed-executionFailed, failed)
+	if wait {
+		fmt.Printf("执行失败: %d\n", executionFailed)
+	}
+	printPercentiles("提交延迟", submits)
+	if wait {
+		printPercentiles("完成延迟", completes)
+	}
+}
+
+func printPercentiles(name string, samples []time.Duration) {
+	if len(samples) == 0 {
+		fmt.Printf("%s: 无数据\n", name)
+		return
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	fmt.Printf("%s: p50=%s p90=%s p99=%s max=%s\n",
+		name,
+		percentile(samples, 0.50),
+		percentile(samples, 0.90),
+		percentile(samples, 0.99),
+		samples[len(samples)-1],
+	)
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(float64(len(sorted)-1) * p)
+	return sorted[idx]
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 与 ComfyUI 的日志缓冲区一致，只保留最近 300 条
+const maxLogEntries = 300
+
+// logEntry 与 ComfyUI /internal/logs/raw 的格式一致，t 为 Python isoformat 时间
+type logEntry struct {
+	T string `json:"t"`
+	M string `json:"m"`
+}
+
+// logBuffer 保存模拟的服务端日志，并推送给通过 /internal/logs/subscribe 订阅的 client
+type logBuffer struct {
+	clock       *mockClock
+	mu          sync.Mutex
+	entries     []logEntry
+	subscribers map[string]bool
+}
+
+func newLogBuffer(cfg Config, clock *mockClock) *logBuffer {
+	b := &logBuffer{clock: clock, subscribers: map[string]bool{}}
+	for _, line := range []string{
+		fmt.Sprintf("Total VRAM %d MB, total RAM 32768 MB", cfg.VRAMTotalMB),
+		"pytorch version: 2.3.1+cu121",
+		"Set vram state to: NORMAL_VRAM",
+		"Device: cuda:0 NVIDIA GeForce RTX 4090 : cudaMallocAsync",
+		"Using pytorch attention",
+		"Starting server",
+	} {
+		b.append(line)
+	}
+	return b
+}
+
+func (b *logBuffer) append(message string) logEntry {
+	entry := logEntry{T: b.clock.report(time.Now()).Format("2006-01-02T15:04:05.000000"), M: message + "\n"}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = append(b.entries, entry)
+	if len(b.entries) > maxLogEntries {
+		b.entries = b.entries[len(b.entries)-maxLogEntries:]
+	}
+	return entry
+}
+
+// logTerminalSize 是 logs 消息中的终端大小，前端据此换行
+var logTerminalSize = gin.H{"cols": 120, "rows": 40}
+
+// logf 记录一行日志并以 logs 消息发送给订阅的 client
+func (m *ComfyUIMock) logf(format string, args ...interface{}) {
+	entry := m.logs.append(fmt.Sprintf(format, args...))
+
+	m.logs.mu.Lock()
+	subscribers := make([]string, 0, len(m.logs.subscribers))
+	for sid := range m.logs.subscribers {
+		subscribers = append(subscribers, sid)
+	}
+	m.logs.mu.Unlock()
+
+	for _, sid := range subscribers {
+		m.ws.send(sid, "logs", gin.H{"entries": []logEntry{entry}, "size": logTerminalSize})
+	}
+}
+
+// handleLogs 返回拼接后的日志文本
+func (m *ComfyUIMock) handleLogs(c *gin.Context) {
+	m.logs.mu.Lock()
+	var text strings.Builder
+	for _, entry := range m.logs.entries {
+		text.WriteString(entry.M)
+	}
+	m.logs.mu.Unlock()
+	c.JSON(http.StatusOK, text.String())
+}
+
+func (m *ComfyUIMock) handleLogsRaw(c *gin.Context) {
+	m.logs.mu.Lock()
+	entries := append([]logEntry{}, m.logs.entries...)
+	m.logs.mu.Unlock()
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "size": logTerminalSize})
+}
+
+// handleLogsSubscribe 开启或关闭 client 的 logs 消息
+func (m *ComfyUIMock) handleLogsSubscribe(c *gin.Context) {
+	var request struct {
+		ClientID string `json:"clientId"`
+		Enabled  bool   `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.ClientID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "clientId is required"})
+		return
+	}
+
+	m.logs.mu.Lock()
+	if request.Enabled {
+		m.logs.subscribers[request.ClientID] = true
+	} else {
+		delete(m.logs.subscribers, request.ClientID)
+	}
+	m.logs.mu.Unlock()
+	c.Status(http.StatusOK)
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"math/rand"
 	"net/http"
 	"sync"
 	"time"
@@ -11,208 +10,1307 @@ import (
 	"os"
 	"io"
 	"path/filepath"
+	"sort"
+	"context"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"encoding/json"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type PromptInfo struct {
-	Prompt   map[string]interface{}
-	ClientID string
-	Status   string
-	Output   map[string]interface{}
-	ID       int
-	PromptID string // 新增字段
+	Prompt   map[string]interface{} `json:"prompt"`
+	ClientID string                 `json:"client_id"`
+	Status   string                 `json:"status"`
+	Output   map[string]interface{} `json:"outputs,omitempty"`
+	Error    map[string]interface{} `json:"error,omitempty"`
+	ID       int                    `json:"number"`
+	PromptID string                 `json:"prompt_id"` // 新增字段
+	// QueuedAt 和 FinishedAt 用于 /history 按时间过滤
+	QueuedAt   time.Time `json:"queued_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Priority 越大越先执行，相同优先级按提交顺序
+	Priority int `json:"priority,omitempty"`
+	// Pinned 是 /__mock/queue/reorder 调整的位置，大于 0 时排在所有未调整的 prompt 之前，小于 0 时排在之后，不受优先级影响。
+	// 绝对值越大调整得越晚：最后移到队首的最先执行，最后移到队尾的最后执行
+	Pinned int `json:"pinned,omitempty"`
+	// ExtraData 是 /prompt 请求中的 extra_data，与 ComfyUI 一致带上 client_id
+	ExtraData map[string]interface{} `json:"extra_data"`
+	// Labels 是 extra_data 中的任务标签，用于按标签过滤 /queue 和 /history
+	Labels map[string]string `json:"labels,omitempty"`
+	// Attempts 是 --max-retries 下已经重试的次数
+	Attempts int `json:"attempts,omitempty"`
+	// OrphanedAt 是 --orphaned-jobs 为 mark 或 cancel 时，提交 prompt 的 client 断开连接的时间
+	OrphanedAt time.Time `json:"orphaned_at"`
+
+	trace   *promptTrace
+	started time.Time
+	script  scriptOverrides
+	// progress 是本次执行中已开始节点的状态，用于 progress_state 消息
+	progress map[string]*nodeProgress
+	// stuck 为 true 时是 /__mock/stuck 安装的永不结束的 prompt
+	stuck bool
+	// scripting 为 true 时 on_submit 还没有返回，prompt 暂不执行
+	scripting bool
+	// vram 是本次执行分配的显存，执行结束后释放
+	vram int64
+	// node 是最近一次 executing 的节点，expected 和 processingAt 是模拟处理的总时长和开始时间，用于 /__mock/progress
+	node         string
+	expected     time.Duration
+	processingAt time.Time
+	// savedSeq 是最近一次写入共享存储的序号，用于 reconcileShared
+	savedSeq uint64
 }
 
 type ComfyUIMock struct {
-	prompts     map[string]*PromptInfo
-	queueID     int
-	runningTask *PromptInfo
-	mu          sync.Mutex
+	cfg            Config
+	store          StateStore
+	storeOps       *storeQueue
+	ws             *wsHub
+	recorder       *recorder
+	clock          *mockClock
+	logs           *logBuffer
+	polls          *pollTracker
+	contract       *contractTracker
+	publisher      eventPublisher
+	objects        ObjectStore
+	scripts        *scriptHooks
+	compat         compatProfile
+	prompts        map[string]*PromptInfo
+	pending        []*PromptInfo
+	queueID        int
+	clientQueueIDs map[string]int
+	runningTask    *PromptInfo
+	vramUsed       int64
+	modelsLoaded   bool
+	cancelTask     context.CancelCauseFunc
+	crashedUntil   time.Time
+	models         map[string][]string
+	modelMetadata  map[string]map[string]interface{}
+	objectInfo     map[string]interface{}
+	nodeWeights    map[string]float64
+	startedAt      time.Time
+	launchedAt     time.Time
+	stats          mockStats
+	wake           chan struct{}
+	reorderSeq     int
+	resumed        chan struct{}
+	deadLetters    []deadLetter
+	artifacts      []artifact
+	stuck          *PromptInfo
+	quotas         *clientQuotas
+	audit          *auditLog
+	drain          *drainState
+	unknown        *unknownRoutes
+	stubs          *routeStubs
+	disconnected   map[string]time.Time
+	forceFail      atomic.Bool
+	mu             sync.Mutex
 }
 
-func NewComfyUIMock() *ComfyUIMock {
-	return &ComfyUIMock{
-		prompts: make(map[string]*PromptInfo),
-		queueID: 0,
+func NewComfyUIMock(cfg Config) *ComfyUIMock {
+	clock := newMockClock(cfg.ClockSkew)
+	m := &ComfyUIMock{
+		cfg:            cfg,
+		ws:             newWSHub(),
+		clock:          clock,
+		logs:           newLogBuffer(cfg, clock),
+		polls:          newPollTracker(),
+		contract:       newContractTracker(),
+		audit:          &auditLog{},
+		unknown:        newUnknownRoutes(),
+		stubs:          newRouteStubs(),
+		compat:         compatProfiles["latest"],
+		prompts:        make(map[string]*PromptInfo),
+		queueID:        0,
+		clientQueueIDs: make(map[string]int),
+		disconnected:   make(map[string]time.Time),
+		models:         defaultModels(),
+		modelMetadata:  defaultModelMetadata(),
+		startedAt:      time.Now(),
+		launchedAt:     time.Now(),
+		wake:           make(chan struct{}, 1),
 	}
+	go m.runWorker()
+	return m
 }
 
 func main() {
-	mock := NewComfyUIMock()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "loadgen":
+			if err := runLoadgen(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "压测失败: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "validate":
+			if err := runValidate(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "校验失败: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "convert":
+			if err := runConvert(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "转换失败: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "replay":
+			if err := runReplay(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "回放失败: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	cfg := parseConfig(os.Args[1:])
+	if err := setupDirs(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	deterministicOutputs = cfg.Deterministic
+	seededOutputs = cfg.SeedImages
+	imageDimensions = cfg.ImageDims
+
+	shutdownTracing, err := initTracing(cfg.OTLPEndpoint)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
+	if cfg.Instances > 1 {
+		err = runCluster(cfg, os.Args[1:])
+	} else {
+		err = runInstance(cfg)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runInstance 按 cfg 启动一个 mock 实例，直到 HTTP 服务退出
+func runInstance(cfg Config) error {
+	mock := NewComfyUIMock(cfg)
+	mock.ws.broadcastAll = cfg.WSBroadcastAll
+	mock.ws.multiSocket = cfg.WSMultiSocket
+	mock.ws.backpressure = wsBackpressure{delay: cfg.WSSendDelay, batch: cfg.WSBatch, buffer: cfg.WSBuffer, overflow: cfg.WSOverflow}
+	faults, err := newWSFaults(cfg.WSDuplicate, cfg.WSReorder, cfg.WSFaultRate)
+	if err != nil {
+		return err
+	}
+	mock.ws.faults = faults
+	if mock.quotas, err = newClientQuotas(cfg.ClientMaxQueued, cfg.ClientMaxHourly, cfg.ClientQuotas); err != nil {
+		return err
+	}
+	if mock.audit, err = newAuditLog(cfg.AuditLog); err != nil {
+		return err
+	}
+	if cfg.Stubs != "" {
+		if mock.stubs.stubs, err = loadRouteStubs(cfg.Stubs); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Strict && cfg.Lenient {
+		return fmt.Errorf("--strict 和 --lenient 不能同时使用")
+	}
+	if err := parsePassthrough(cfg.Passthrough); err != nil {
+		return err
+	}
+
+	compat, err := parseCompat(cfg.Compat)
+	if err != nil {
+		return err
+	}
+	mock.compat = compat
+	mock.ws.compat = compat
+
+	if err := selectOutputGenerator(cfg.OutputGen); err != nil {
+		return err
+	}
+
+	if err := mock.loadFixtures(); err != nil {
+		return err
+	}
+	if cfg.DiskQuotaMB > 0 {
+		// 启动时统计一次目录大小，之后检查配额不需要遍历目录
+		disk.usage()
+	}
+
+	if cfg.RedisAddr != "" {
+		store, err := newRedisStore(cfg.RedisAddr, cfg.RedisPrefix)
+		if err != nil {
+			return err
+		}
+		mock.useStore(store)
+	}
+
+	nodeWeights, err := parseNodeWeights(cfg.NodeWeights)
+	if err != nil {
+		return err
+	}
+	mock.nodeWeights = nodeWeights
+
+	if cfg.S3Bucket != "" {
+		objects, err := newS3Store(cfg.S3Endpoint, cfg.S3Bucket, cfg.S3Region, cfg.S3Prefix)
+		if err != nil {
+			return err
+		}
+		mock.objects = objects
+	}
+
+	if cfg.EventsURL != "" {
+		publisher, err := newEventPublisher(cfg.EventsURL, cfg.EventsTopic)
+		if err != nil {
+			return err
+		}
+		defer publisher.Close()
+		mock.publisher = publisher
+	}
+
+	if cfg.SeedState != "" {
+		state, err := loadStateFile(cfg.SeedState)
+		if err != nil {
+			return err
+		}
+		mock.mu.Lock()
+		mock.importState(state)
+		mock.mu.Unlock()
+		mock.notifyQueue()
+	}
+
+	go mock.handleSignals()
+
+	if cfg.TUI {
+		gin.DefaultWriter = io.Discard
+		go mock.runTUI()
+	}
 
 	r := gin.Default()
+	r.Use(tracingMiddleware())
+	r.Use(mock.auditMiddleware())
+	r.Use(mock.crashMiddleware())
+	r.Use(mock.clockMiddleware())
+	r.Use(bodyLimitMiddleware(int64(cfg.MaxUploadMB * mib)))
+	if cfg.Instances > 1 {
+		r.Use(instanceMiddleware(cfg.InstanceID))
+		mock.ws.instance = &cfg.InstanceID
+	}
+	if cfg.Latency > 0 || cfg.ErrorRate > 0 {
+		r.Use(faultMiddleware(cfg.Latency, cfg.ErrorRate))
+	}
+	r.Use(mock.pollingMiddleware())
+	r.Use(mock.contractMiddleware())
+	if len(cfg.EndpointLatency) > 0 {
+		latencies := make([]endpointLatency, 0, len(cfg.EndpointLatency))
+		for _, spec := range cfg.EndpointLatency {
+			latency, err := parseEndpointLatency(spec)
+			if err != nil {
+				return err
+			}
+			latencies = append(latencies, latency)
+		}
+		r.Use(endpointLatencyMiddleware(latencies))
+	}
+	if cfg.CORSOrigins != "" {
+		r.Use(corsMiddleware(cfg.CORSOrigins, cfg.CORSCredentials))
+	}
+	if cfg.CompressBody {
+		r.Use(gzipMiddleware())
+	}
+
+	if cfg.RecordDir != "" {
+		rec, err := newRecorder(cfg.RecordDir)
+		if err != nil {
+			return err
+		}
+		mock.recorder = rec
+		mock.ws.recorder = rec
+		r.Use(rec.middleware())
+	}
 
+	if cfg.RespTemplates != "" {
+		templates, err := loadResponseTemplates(cfg.RespTemplates)
+		if err != nil {
+			return err
+		}
+		r.Use(mock.templateMiddleware(templates))
+	}
+
+	r.GET("/ws", mock.handleWebSocket)
+	r.GET("/events", mock.handleEvents)
 	r.POST("/prompt", mock.handlePrompt)
+	r.POST("/prompt/batch", mock.handlePromptBatch)
+	r.GET("/history", mock.handleHistoryList)
 	r.GET("/history/:prompt_id", mock.handleHistory)
+	r.POST("/history", mock.handleHistoryUpdate)
+	r.POST("/interrupt", mock.handleInterrupt)
 	r.GET("/queue", mock.handleQueue)
+	r.POST("/queue", mock.handleQueueUpdate)
+	r.DELETE("/queue/:prompt_id", mock.handleQueueDelete)
+	r.GET("/system_stats", mock.handleSystemStats)
+	r.POST("/free", mock.handleFree)
+	r.GET("/models", mock.handleModels)
+	r.GET("/models/:folder", mock.handleModelFolder)
+	r.GET("/embeddings", mock.handleEmbeddings)
+	r.GET("/view_metadata/:folder", mock.handleViewMetadata)
+	r.POST("/upload/image", mock.handleUploadImage)
+	r.POST("/upload/mask", mock.handleUploadMask)
+	r.GET("/view", mock.handleView)
+	r.GET("/object_info", mock.handleObjectInfo)
+	r.GET("/object_info/:node_class", mock.handleObjectInfoNode)
+	r.POST("/validate", mock.handleValidate)
+	r.GET("/extensions", mock.handleExtensions)
+	r.GET("/users", mock.handleUsers)
+	r.POST("/users", mock.handleUserCreate)
+	r.GET("/userdata", mock.handleUserdataList)
+	r.GET("/userdata/*file", mock.handleUserdata)
+	r.POST("/userdata/*file", mock.handleUserdata)
+	r.DELETE("/userdata/*file", mock.handleUserdata)
+	r.GET("/settings", mock.handleSettings)
+	r.POST("/settings", mock.handleSettingsUpdate)
+	r.GET("/settings/:id", mock.handleSetting)
+	r.POST("/settings/:id", mock.handleSettingUpdate)
+	r.GET("/internal/folder_paths", mock.handleFolderPaths)
+	r.GET("/internal/logs", mock.handleLogs)
+	r.GET("/internal/logs/raw", mock.handleLogsRaw)
+	r.PATCH("/internal/logs/subscribe", mock.handleLogsSubscribe)
+	r.GET("/healthz", mock.handleHealthz)
+	r.GET("/readyz", mock.handleReadyz)
+
+	admin := r.Group("/__mock")
+	admin.POST("/queue/reorder", mock.handleQueueReorder)
+	admin.GET("/queue/eta", mock.handleQueueETA)
+	admin.POST("/queue/pause", mock.handleQueuePause)
+	admin.POST("/queue/resume", mock.handleQueueResume)
+	admin.POST("/crash", mock.handleCrash)
+	admin.GET("/stuck", mock.handleStuckStatus)
+	admin.POST("/stuck", mock.handleStuck)
+	admin.DELETE("/stuck", mock.handleStuckRelease)
+	admin.GET("/clock", mock.handleClock)
+	admin.PUT("/clock", mock.handleClockUpdate)
+	admin.GET("/ws/partition", mock.handleWSPartitionStatus)
+	admin.POST("/ws/partition", mock.handleWSPartition)
+	admin.DELETE("/ws/partition", mock.handleWSHeal)
+	admin.GET("/stats", mock.handleStats)
+	admin.GET("/dead-letter", mock.handleDeadLetters)
+	admin.DELETE("/dead-letter", mock.handleDeadLettersClear)
+	admin.GET("/orphans", mock.handleOrphans)
+	admin.GET("/progress/:prompt_id", mock.handleProgress)
+	admin.GET("/contract", mock.handleContract)
+	admin.DELETE("/contract", mock.handleContractReset)
+	admin.GET("/manifest", mock.handleManifest)
+	admin.DELETE("/manifest", mock.handleManifestReset)
+	admin.GET("/polling", mock.handlePolling)
+	admin.DELETE("/polling", mock.handlePollingReset)
+	admin.POST("/dedupe", mock.handleDedupe)
+	admin.POST("/convert", mock.handleConvert)
+	admin.GET("/affinity", mock.handleAffinity)
+	admin.DELETE("/affinity", mock.handleAffinityReset)
+	admin.GET("/state", mock.handleStateExport)
+	admin.POST("/state", mock.handleStateImport)
+	admin.POST("/files/wipe", mock.handleFilesWipe)
+	admin.GET("/audit", mock.handleAudit)
+	admin.GET("/stubs", mock.handleStubs)
+	admin.POST("/stubs", mock.handleStubsRegister)
+	admin.DELETE("/stubs", mock.handleStubsRemove)
+	admin.GET("/unknown-routes", mock.handleUnknownRoutes)
+	admin.DELETE("/unknown-routes", mock.handleUnknownRoutesReset)
+	admin.GET("/drain", mock.handleDrainStatus)
+	admin.POST("/drain", mock.handleDrain)
+	admin.DELETE("/drain", mock.handleDrainCancel)
+	admin.POST("/object_info", mock.handleObjectInfoInject)
+	admin.DELETE("/object_info/:node_class", mock.handleObjectInfoRemove)
+
+	// 未实现的路由先查找注册的桩，没有时与 ComfyUI 一致返回 aiohttp 格式的 404 和 405
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(mock.handleNotFound)
+	r.NoMethod(mock.handleMethodNotAllowed)
 
-	r.Run(":8188")
+	if cfg.CleanupMaxAge > 0 || cfg.CleanupSizeMB > 0 {
+		go mock.runJanitor()
+	}
+
+	if cfg.MonitorInterval > 0 {
+		go mock.runMonitor(cfg.MonitorInterval)
+	}
+
+	if cfg.GRPCAddr != "" {
+		if err := mock.serveGRPC(cfg.GRPCAddr); err != nil {
+			return err
+		}
+	}
+
+	listener, err := listen(cfg.Addr)
+	if err != nil {
+		return err
+	}
+	r.UseH2C = cfg.H2C
+	server := &http.Server{
+		Handler:           r.Handler(),
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.HeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	server.SetKeepAlivesEnabled(cfg.KeepAlive)
+	return server.Serve(listener)
 }
 
 func (m *ComfyUIMock) handlePrompt(c *gin.Context) {
+	if m.rejectDraining(c) {
+		return
+	}
 	var request struct {
-		ClientID string                 `json:"client_id"`
-		Prompt   map[string]interface{} `json:"prompt"`
+		ClientID  string                 `json:"client_id"`
+		Prompt    map[string]interface{} `json:"prompt"`
+		ExtraData map[string]interface{} `json:"extra_data"`
+		// 直接提交界面保存的 workflow 文件时 nodes 和 links 在顶层
+		Nodes []interface{} `json:"nodes"`
+		Links []interface{} `json:"links"`
 	}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
+	body, err := c.GetRawData()
+	if err != nil {
+		if abortTooLarge(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var schemaErrs []schemaError
+	if m.cfg.PromptSchema != "off" {
+		schemaErrs, _ = validatePromptSchema(body)
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		if len(schemaErrs) > 0 && m.cfg.PromptSchema == "reject" {
+			rejectSchema(c, schemaErrs)
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	promptID := generatePromptID()
+	auditDetail(c, "client_id", request.ClientID)
+	workflow := request.Prompt
+	if workflow == nil && request.Nodes != nil {
+		workflow = map[string]interface{}{"nodes": request.Nodes, "links": request.Links}
+	}
+	// 界面格式的 workflow 由 mock 转换，不按 API 格式的 schema 检查
+	uiFormat := workflow != nil && isUIWorkflow(workflow)
+	if len(schemaErrs) > 0 && !uiFormat {
+		if m.cfg.PromptSchema == "reject" {
+			rejectSchema(c, schemaErrs)
+			return
+		}
+		c.Writer.Header().Add("X-Mock-Warning", "request does not match the /prompt schema: "+schemaErrorDetails(schemaErrs))
+	}
+	if uiFormat {
+		converted, err := convertWorkflow(workflow, m.currentObjectInfo())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		request.Prompt = converted
+		c.Header("X-Mock-Warning", "UI-format workflow converted to API format; real ComfyUI rejects this request")
+	}
+
+	// --strict 时与 ComfyUI 一致拒绝没有 prompt、节点类型不存在或输入不合法的请求
+	if m.cfg.Strict {
+		if request.Prompt == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationError("no_prompt", "No prompt provided", "No prompt provided"), "node_errors": []interface{}{}})
+			return
+		}
+		if validationErr, nodeErrors := validatePrompt(request.Prompt, m.currentObjectInfo()); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr, "node_errors": nodeErrors})
+			return
+		}
+	}
+
+	if m.cfg.Instances > 1 {
+		affinity.record(request.ClientID, m.cfg.InstanceID)
+	}
+	priority, err := requestPriority(c, request.ExtraData)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := m.checkDependencies(request.ExtraData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := promptLabels(request.ExtraData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	promptInfo, quotaErr := m.enqueuePrompt(c.Request.Context(), request.ClientID, request.Prompt, request.ExtraData, priority)
+	if quotaErr != nil {
+		rejectQuota(c, quotaErr)
+		return
+	}
+	auditDetail(c, "prompt_id", promptInfo.PromptID)
+
+	c.JSON(http.StatusOK, gin.H{"prompt_id": promptInfo.PromptID, "number": promptInfo.ID, "node_errors": gin.H{}})
+}
 
+// enqueuePrompt 检查 client 配额后将 prompt 加入队列并开始处理，REST 和 gRPC 接口共用。
+// 配额检查和入队在同一次持锁中完成，并发提交不会超过 max_queued
+func (m *ComfyUIMock) enqueuePrompt(ctx context.Context, clientID string, graph, extraData map[string]interface{}, priority int) (*PromptInfo, *quotaError) {
+	promptInfo, err := m.addPrompt(ctx, clientID, graph, extraData, priority, true, nil)
+	if err != nil {
+		return nil, err.(*quotaError)
+	}
+	return promptInfo, nil
+}
+
+// enqueuePromptWith 将 prompt 加入队列，不检查 client 配额。setup 不为 nil 时在 prompt 进入队列前持锁调用，
+// 返回错误时 prompt 不入队
+func (m *ComfyUIMock) enqueuePromptWith(ctx context.Context, clientID string, graph, extraData map[string]interface{}, priority int, setup func(*PromptInfo) error) (*PromptInfo, error) {
+	return m.addPrompt(ctx, clientID, graph, extraData, priority, false, setup)
+}
+
+// addPrompt 是 enqueuePrompt 和 enqueuePromptWith 的实现，admit 为 true 时超过配额返回 *quotaError，prompt 不入队
+func (m *ComfyUIMock) addPrompt(ctx context.Context, clientID string, graph, extraData map[string]interface{}, priority int, admit bool, setup func(*PromptInfo) error) (*PromptInfo, error) {
+	id := m.sharedQueueID(clientID)
 	m.mu.Lock()
-	m.queueID++
-	promptInfo := &PromptInfo{
-		Prompt:   request.Prompt,
-		ClientID: request.ClientID,
-		Status:   "pending",
-		ID:       m.queueID,
-		PromptID: promptID, // 设置 PromptID
+	if admit {
+		if err := m.admitClients(map[string]int{clientID: 1}); err != nil {
+			m.mu.Unlock()
+			return nil, err
+		}
 	}
-	m.prompts[promptID] = promptInfo
+	promptInfo, err := m.newPrompt(ctx, clientID, graph, extraData, priority, id, setup)
 	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	m.flushStore()
+	m.runSubmitHook(promptInfo)
 
-	go m.processQueue()
+	m.announcePrompt(promptInfo)
+	m.broadcastStatus()
+	m.notifyQueue()
 
-	c.JSON(http.StatusOK, gin.H{"prompt_id": promptID})
+	return promptInfo, nil
+}
+
+// newPrompt 创建 prompt 并加入队列，id 是 sharedQueueID 分配的队列编号，为 0 时在本地分配。
+// setup 返回错误时 prompt 不入队，调用方需持有锁
+func (m *ComfyUIMock) newPrompt(ctx context.Context, clientID string, graph, extraData map[string]interface{}, priority, id int, setup func(*PromptInfo) error) (*PromptInfo, error) {
+	promptID := generatePromptID()
+	if id == 0 {
+		id = m.nextQueueID(clientID)
+	}
+	if extraData == nil {
+		extraData = map[string]interface{}{}
+	}
+	if clientID != "" {
+		extraData["client_id"] = clientID
+	}
+
+	promptInfo := &PromptInfo{
+		Prompt:    graph,
+		ClientID:  clientID,
+		Status:    "pending",
+		ID:        id,
+		PromptID:  promptID, // 设置 PromptID
+		QueuedAt:  time.Now(),
+		Priority:  priority,
+		ExtraData: extraData,
+	}
+	promptInfo.Labels, _ = promptLabels(extraData)
+	promptInfo.scripting = m.scripts.hasSubmit()
+	if setup != nil {
+		if err := setup(promptInfo); err != nil {
+			return nil, err
+		}
+	}
+	promptInfo.trace = startPromptTrace(ctx, promptInfo)
+	m.prompts[promptID] = promptInfo
+	m.pending = append(m.pending, promptInfo)
+	m.persist(promptInfo)
+	return promptInfo, nil
+}
+
+// announcePrompt 记录新加入队列的 prompt 并发布 queued 事件
+func (m *ComfyUIMock) announcePrompt(promptInfo *PromptInfo) {
+	m.contract.submitted(promptInfo)
+	m.logf("got prompt")
+	m.publishEvent("queued", promptInfo, nil)
 }
 
 func (m *ComfyUIMock) handleHistory(c *gin.Context) {
 	promptID := c.Param("prompt_id")
 
-	m.mu.Lock()
-	prompt, exists := m.prompts[promptID]
-	m.mu.Unlock()
+	prompt, exists := m.lookupPrompt(promptID)
 
-	if !exists {
+	if !exists || !m.visibleTo(prompt, c.Query("client_id")) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Prompt not found"})
 		return
 	}
 
-	if prompt.Status != "completed" {
-		c.JSON(http.StatusOK, gin.H{})
-		return
+	c.JSON(http.StatusOK, m.historyResponse(prompt))
+}
+
+// historyResponse 构造 /history/:prompt_id 的响应体，未执行完时为空
+func (m *ComfyUIMock) historyResponse(prompt *PromptInfo) gin.H {
+	entry := m.historyEntry(prompt)
+	if entry == nil {
+		return gin.H{}
+	}
+	return gin.H{prompt.PromptID: entry}
+}
+
+// historyEntry 构造单个 prompt 的 history 记录，未执行完时返回 nil，messages 的格式由 --compat 决定
+func (m *ComfyUIMock) historyEntry(prompt *PromptInfo) gin.H {
+	promptID := prompt.PromptID
+	startedAt := prompt.started
+	if startedAt.IsZero() {
+		startedAt = prompt.QueuedAt
 	}
+	started := m.compat.historyMessage("execution_start", gin.H{"prompt_id": promptID}, m.clock.millis(startedAt))
 
-	c.JSON(http.StatusOK, gin.H{
-		promptID: gin.H{
+	if prompt.Status == "failed" {
+		return gin.H{
 			"prompt":  prompt.Prompt,
-			"outputs": prompt.Output,
+			"outputs": gin.H{},
 			"status": gin.H{
-				"status_str": "success",
-				"completed":  true,
+				"status_str": "error",
+				"completed":  false,
 				"messages": []interface{}{
-					[]interface{}{"execution_start", gin.H{"prompt_id": promptID}},
-					[]interface{}{"execution_cached", gin.H{"nodes": []string{"4", "7", "5", "6"}, "prompt_id": promptID}},
+					started,
+					m.compat.historyMessage("execution_error", gin.H(prompt.Error), m.clock.millis(prompt.FinishedAt)),
 				},
 			},
+		}
+	}
+
+	if prompt.Status != "completed" {
+		return nil
+	}
+
+	messages := []interface{}{
+		started,
+		m.compat.historyMessage("execution_cached", gin.H{"nodes": []string{"4", "7", "5", "6"}, "prompt_id": promptID}, m.clock.millis(startedAt)),
+	}
+	if m.compat.historyTimestamps {
+		messages = append(messages, m.compat.historyMessage("execution_success", gin.H{"prompt_id": promptID}, m.clock.millis(prompt.FinishedAt)))
+	}
+	return gin.H{
+		"prompt":  prompt.Prompt,
+		"outputs": prompt.Output,
+		"status": gin.H{
+			"status_str": "success",
+			"completed":  true,
+			"messages":   messages,
 		},
+	}
+}
+
+// queueTuple 与 ComfyUI 一致返回 [number, prompt_id, prompt, extra_data, outputs_to_execute]，调用方需持有锁
+func (m *ComfyUIMock) queueTuple(prompt *PromptInfo) []interface{} {
+	extraData := prompt.ExtraData
+	if extraData == nil {
+		extraData = map[string]interface{}{}
+	}
+	outputs := outputsToExecute(prompt.Prompt, m.objectInfo)
+	if m.cfg.Lenient {
+		outputs = lenientOutputsToExecute(prompt.Prompt, outputs)
+	}
+	return []interface{}{prompt.ID, prompt.PromptID, prompt.Prompt, extraData, outputs}
+}
+
+// outputsToExecute 返回图中的输出节点，object_info 中没有定义的节点按 mock 能生成输出的节点判断
+func outputsToExecute(graph, objectInfo map[string]interface{}) []string {
+	return findNodesFunc(graph, func(classType string) bool {
+		if info, ok := objectInfo[classType].(map[string]interface{}); ok {
+			isOutput, _ := info["output_node"].(bool)
+			return isOutput
+		}
+		return isOutputNode(map[string]interface{}{"class_type": classType})
 	})
 }
 
 func (m *ComfyUIMock) handleQueue(c *gin.Context) {
+	labels, err := parseLabelSelector(c.QueryArray("label"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	listed, seq := m.sharedPrompts()
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	clientID := c.Query("client_id")
 	queueRunning := []interface{}{}
 	queuePending := []interface{}{}
 
-	if m.runningTask != nil {
-		queueRunning = append(queueRunning, []interface{}{
-			m.runningTask.ID,
-			m.runningTask.PromptID,
-			m.runningTask.Prompt,
-			[]string{"9"},
-		})
+	// 先移除已被其他实例删除或领取的本地 prompt
+	shared := m.reconcileShared(listed, seq)
+	if m.runningTask != nil && m.visibleTo(m.runningTask, clientID) && labels.match(m.runningTask) {
+		queueRunning = append(queueRunning, m.queueTuple(m.runningTask))
 	}
 
-	for _, prompt := range m.prompts {
-		if prompt.Status == "pending" {
-			queuePending = append(queuePending, []interface{}{
-				prompt.ID,
-				prompt.PromptID,
-				prompt.Prompt,
-				[]string{"9"},
-			})
+	pending := m.pendingPrompts()
+	remote := false
+	for _, prompt := range shared {
+		switch prompt.Status {
+		case "processing":
+			if m.visibleTo(prompt, clientID) && labels.match(prompt) {
+				queueRunning = append(queueRunning, m.queueTuple(prompt))
+			}
+		case "pending":
+			pending = append(pending, prompt)
+			remote = true
 		}
 	}
+	// 其他实例的 prompt 按队列编号合并，本地队列本身已经是执行顺序
+	if remote {
+		sort.SliceStable(pending, func(i, j int) bool { return pending[i].ID < pending[j].ID })
+	}
 
-	c.JSON(http.StatusOK, gin.H{
+	now := time.Now()
+	priorities := gin.H{}
+	for _, prompt := range pending {
+		if !m.visibleTo(prompt, clientID) || !labels.match(prompt) {
+			continue
+		}
+		queuePending = append(queuePending, m.queueTuple(prompt))
+		priorities[prompt.PromptID] = gin.H{"priority": prompt.Priority, "effective_priority": m.effectivePriority(prompt, now)}
+	}
+
+	response := gin.H{
 		"queue_running": queueRunning,
 		"queue_pending": queuePending,
+	}
+	if m.usesPriority() {
+		response["priorities"] = priorities
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (m *ComfyUIMock) handleQueueUpdate(c *gin.Context) {
+	var request struct {
+		Clear  bool     `json:"clear"`
+		Delete []string `json:"delete"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	promptIDs := request.Delete
+	if request.Clear {
+		c.Set(auditActionKey, "queue_clear")
+		listed, seq := m.sharedPrompts()
+		m.mu.Lock()
+		cleared := []string{}
+		for _, prompt := range m.pendingPrompts() {
+			cleared = append(cleared, prompt.PromptID)
+		}
+		for _, prompt := range m.reconcileShared(listed, seq) {
+			if prompt.Status == "pending" {
+				cleared = append(cleared, prompt.PromptID)
+			}
+		}
+		m.mu.Unlock()
+		promptIDs = append(cleared, promptIDs...)
+	}
+	deleted := m.deleteQueued(promptIDs)
+	auditDetail(c, "deleted", deleted)
+
+	c.Status(http.StatusOK)
+}
+
+func (m *ComfyUIMock) handleQueueDelete(c *gin.Context) {
+	promptID := c.Param("prompt_id")
+
+	if len(m.deleteQueued([]string{promptID})) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prompt not found in queue"})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// nextQueueID 分配队列编号，隔离模式下每个 client_id 独立计数，调用方需持有锁
+func (m *ComfyUIMock) nextQueueID(clientID string) int {
+	if m.cfg.TenantIsolation {
+		m.clientQueueIDs[clientID]++
+		return m.clientQueueIDs[clientID]
+	}
+	m.queueID++
+	return m.queueID
+}
+
+// visibleTo 判断 prompt 对请求方是否可见：指定了 client_id 时只返回该 client 的 prompt，
+// 隔离模式下必须指定 client_id
+func (m *ComfyUIMock) visibleTo(prompt *PromptInfo, clientID string) bool {
+	if clientID == "" {
+		return !m.cfg.TenantIsolation
+	}
+	return prompt.ClientID == clientID
+}
+
+// deletePending 从本地队列中删除一个等待中的 prompt，共享存储中的记录由 deleteQueued 删除，调用方需持有锁
+func (m *ComfyUIMock) deletePending(promptID string) bool {
+	prompt, exists := m.prompts[promptID]
+	if !exists || prompt.Status != "pending" {
+		return false
+	}
+	delete(m.prompts, promptID)
+	m.removePending(prompt)
+	prompt.trace.finish("deleted", nil)
+	return true
+}
+
+// pendingPrompts 按执行顺序返回所有等待中的 prompt：先按 reorder 调整的位置，再按优先级从高到低，相同时按提交顺序，调用方需持有锁
+func (m *ComfyUIMock) pendingPrompts() []*PromptInfo {
+	pending := append([]*PromptInfo(nil), m.pending...)
+	now := time.Now()
+	sort.SliceStable(pending, func(i, j int) bool {
+		if pending[i].Pinned != pending[j].Pinned {
+			return pending[i].Pinned > pending[j].Pinned
+		}
+		return m.effectivePriority(pending[i], now) > m.effectivePriority(pending[j], now)
 	})
+	return pending
 }
 
-func (m *ComfyUIMock) processQueue() {
+// removePending 将 prompt 移出等待队列，调用方需持有锁
+func (m *ComfyUIMock) removePending(prompt *PromptInfo) bool {
+	for i, pending := range m.pending {
+		if pending == prompt {
+			m.pending = append(m.pending[:i], m.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// notifyQueue 唤醒 worker 检查队列，worker 正忙时合并为一次通知
+func (m *ComfyUIMock) notifyQueue() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runWorker 是唯一执行 prompt 的 goroutine，与 ComfyUI 一样同一时间只执行一个 prompt
+func (m *ComfyUIMock) runWorker() {
+	for range m.wake {
+		for m.runNext() {
+		}
+		m.logDrained()
+	}
+}
+
+// runNext 取出队首的 prompt 并执行，队列为空、等待中的 prompt 都在等前置 prompt 或模拟崩溃期间返回 false
+func (m *ComfyUIMock) runNext() bool {
 	m.mu.Lock()
-	if m.runningTask != nil {
+	if m.crashed() || m.resumed != nil {
 		m.mu.Unlock()
-		return
+		return false
+	}
+	if len(m.pending) == 0 {
+		// 共享队列中其他实例等待中的 prompt 由空闲的实例领取执行，排空期间不再领取
+		shared := m.store != nil && m.drain == nil
+		m.mu.Unlock()
+		return shared && m.claimShared()
 	}
 
-	for _, prompt := range m.prompts {
-		if prompt.Status == "pending" {
-			m.runningTask = prompt
-			prompt.Status = "processing"
-			break
+	task, abandoned := m.nextRunnable()
+	if task == nil {
+		m.mu.Unlock()
+		for _, prompt := range abandoned {
+			m.reportFailure(prompt, false)
+		}
+		if len(abandoned) > 0 {
+			m.broadcastStatus()
 		}
+		// 失败的 prompt 可能是其他等待中 prompt 的前置，需要再检查一次
+		return len(abandoned) > 0
 	}
+	task.Status = "processing"
+	task.started = time.Now()
+	task.trace.dequeued()
+	m.runningTask = task
+	ctx, cancel := context.WithCancelCause(context.Background())
+	m.cancelTask = cancel
 	m.mu.Unlock()
+	for _, prompt := range abandoned {
+		m.reportFailure(prompt, false)
+	}
 
-	if m.runningTask != nil {
-		m.processPrompt(m.runningTask)
-		m.mu.Lock()
-		m.runningTask = nil
+	// 共享队列中的 prompt 可能已被其他实例删除或领取，这时只从本地移除
+	claimed := m.claimPrompt(task)
+	m.mu.Lock()
+	if !claimed {
+		if m.runningTask == task {
+			m.runningTask = nil
+			m.cancelTask = nil
+		}
+		delete(m.prompts, task.PromptID)
 		m.mu.Unlock()
-		go m.processQueue()
+		cancel(nil)
+		task.trace.finish("deleted", nil)
+		m.broadcastStatus()
+		return true
+	}
+	if m.runningTask == task {
+		m.persist(task)
+	}
+	m.mu.Unlock()
+
+	execCtx := ctx
+	if m.cfg.PromptTimeout > 0 && !task.stuck {
+		var cancelTimeout context.CancelFunc
+		execCtx, cancelTimeout = context.WithTimeoutCause(ctx, m.cfg.PromptTimeout, errPromptTimeout)
+		defer cancelTimeout()
+	}
+	m.processPrompt(execCtx, task)
+
+	m.mu.Lock()
+	m.releaseVRAM(task)
+	// 被取消时 runningTask 已由取消方处理
+	if m.runningTask == task {
+		m.runningTask = nil
+		m.cancelTask = nil
+		m.stats.record(task, task.Status, time.Now())
+	}
+	m.mu.Unlock()
+	cancel(nil)
+	m.broadcastStatus()
+	return true
+}
+
+// cancelRunning 取消正在执行的 prompt，cause 说明取消原因，调用方需持有锁
+func (m *ComfyUIMock) cancelRunning(cause error) *PromptInfo {
+	running := m.runningTask
+	if m.cancelTask != nil {
+		m.cancelTask(cause)
+	}
+	m.runningTask = nil
+	m.cancelTask = nil
+	return running
+}
+
+// errPromptTimeout 是 prompt 执行超过 --prompt-timeout 时的取消原因
+var errPromptTimeout = errors.New("prompt execution timed out")
+
+// sleepCtx 等待 d，ctx 被取消时立即返回 false
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
 
-func (m *ComfyUIMock) processPrompt(prompt *PromptInfo) {
-	// 模拟处理时间，随机 10-20 秒
-	processingTime := 10 + rand.Intn(11)
-	time.Sleep(time.Duration(processingTime) * time.Second)
+// processPrompt 模拟执行 prompt，ctx 被取消时放弃执行，prompt 状态由取消方负责
+func (m *ComfyUIMock) processPrompt(ctx context.Context, prompt *PromptInfo) {
+	_, span := prompt.trace.startExecute()
+	defer span.End()
 
+	prompt.progress = nil
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	prompt.node = ""
+	prompt.expected = 0
+	m.mu.Unlock()
+	m.ws.send(prompt.ClientID, "execution_start", gin.H{"prompt_id": prompt.PromptID, "timestamp": m.clock.millis(time.Now())})
+	m.publishEvent("started", prompt, nil)
+	if prompt.stuck {
+		m.hang(ctx, prompt)
+		return
+	}
+
+	m.mu.Lock()
+	if err := m.allocateVRAM(prompt); err != nil {
+		retried := m.failPrompt(prompt, "torch.cuda.OutOfMemoryError", err.Error())
+		m.mu.Unlock()
+		span.SetStatus(codes.Error, err.Error())
+		m.reportFailure(prompt, retried)
+		return
+	}
+	coldStart := !m.modelsLoaded
+	m.modelsLoaded = true
+	m.mu.Unlock()
 
+	if coldStart {
+		m.loadModels(ctx, prompt)
+	}
+
+	// 模拟处理时间，默认随机 10-20 秒，配置了节点权重时按权重分配到各节点
+	processingTime := m.processingTime(prompt)
+	m.mu.Lock()
+	prompt.expected = processingTime
+	prompt.processingAt = time.Now()
+	m.mu.Unlock()
+	durations := m.nodeDurations(prompt.Prompt, processingTime)
+	if durations == nil && sleepCtx(ctx, processingTime) {
+		m.waitResumed(ctx)
+	}
+	for _, nodeID := range executionOrder(prompt.Prompt) {
+		if ctx.Err() != nil || !m.waitResumed(ctx) {
+			break
+		}
+		if durations == nil || m.producesOutput(prompt.Prompt, nodeID) {
+			continue
+		}
+		m.sendExecuting(prompt, nodeID)
+		m.publishEvent("progress", prompt, gin.H{"node": nodeID})
+		if !sleepCtx(ctx, durations[nodeID]) {
+			break
+		}
+	}
+
+	// SaveImageWebsocket 节点的图片直接通过 WebSocket 发送
+	wsNodes := findNodes(prompt.Prompt, "SaveImageWebsocket")
+	for _, nodeID := range wsNodes {
+		if ctx.Err() != nil || !m.waitResumed(ctx) {
+			break
+		}
+		m.sendExecuting(prompt, nodeID)
+		m.publishEvent("progress", prompt, gin.H{"node": nodeID})
+		if !sleepCtx(ctx, durations[nodeID]) {
+			break
+		}
+		m.sendWebsocketImage(prompt.ClientID)
+	}
+
+	// 取消方持有锁调用 cancel，这里持锁检查可以保证不会与取消方同时修改 prompt。
+	// cancelled 在 ctx 已结束时处理取消或超时并释放锁，调用方需持有锁
+	cancelled := func() bool {
+		if ctx.Err() == nil {
+			return false
+		}
+		cause := context.Cause(ctx)
+		span.SetStatus(codes.Error, cause.Error())
+		if !errors.Is(cause, errPromptTimeout) {
+			m.mu.Unlock()
+			return true
+		}
+		// 超时由执行方自己处理：标记失败后继续执行队列中的下一个 prompt
+		retried := m.failPrompt(prompt, "TimeoutError", fmt.Sprintf("Prompt execution exceeded the time limit of %s", m.cfg.PromptTimeout))
+		m.mu.Unlock()
+		m.reportFailure(prompt, retried)
+		return true
+	}
+	m.mu.Lock()
+	if cancelled() {
+		return
+	}
+	if exceptionType, message := m.injectedFailure(prompt); message != "" {
+		retried := m.failPrompt(prompt, exceptionType, message)
+		m.mu.Unlock()
+		span.SetStatus(codes.Error, message)
+		m.reportFailure(prompt, retried)
+		return
+	}
+	if nodeID, path := m.diskFullNode(prompt); nodeID != "" {
+		message := noSpaceError(path)
+		retried := m.failPromptAt(prompt, nodeID, "OSError", message)
+		m.mu.Unlock()
+		span.SetStatus(codes.Error, message)
+		m.reportFailure(prompt, retried)
+		return
+	}
+	m.mu.Unlock()
+
+	// 编码 GIF、MP4 等输出和写文件可能很慢，不持有锁，期间 prompt 可能被取消
+	outputs := m.buildOutputs(prompt)
+	m.mu.Lock()
+	if cancelled() {
+		return
+	}
+	arg := scriptArg(prompt, map[string]interface{}{"status": "completed", "outputs": outputs})
+	m.mu.Unlock()
+
+	// on_complete 可能执行很久，不能持有锁，期间 prompt 可能被取消
+	outputs, message := m.scripts.complete(ctx, arg)
+	m.mu.Lock()
+	if cancelled() {
+		return
+	}
+	if message != "" {
+		retried := m.failPrompt(prompt, "ScriptError", message)
+		m.mu.Unlock()
+		span.SetStatus(codes.Error, message)
+		m.reportFailure(prompt, retried)
+		return
+	}
 	prompt.Status = "completed"
-	prompt.Output = generateMockOutput(prompt.PromptID)
+	prompt.Error = nil
+	prompt.FinishedAt = time.Now()
+	prompt.Output = outputs
+	m.recordArtifacts(prompt)
+	m.persist(prompt)
+	m.mu.Unlock()
 
-	// 复制图片文件并重命名
-	err := copyAndRenameImage(prompt.PromptID)
-	if err != nil {
-		fmt.Printf("复制和重命名图片时出错: %v\n", err)
+	m.uploadOutputs(outputs)
+
+	for nodeID, output := range outputs {
+		span.AddEvent("executed", trace.WithAttributes(attribute.String("comfyui.node_id", nodeID)))
+		m.sendExecuting(prompt, nodeID)
+		m.publishEvent("progress", prompt, gin.H{"node": nodeID})
+		sleepCtx(ctx, durations[nodeID])
+		m.ws.send(prompt.ClientID, "executed", gin.H{"node": nodeID, "display_node": nodeID, "output": output, "prompt_id": prompt.PromptID})
 	}
+	m.updateProgressState(prompt, "", "finished")
+	m.ws.send(prompt.ClientID, "execution_success", gin.H{"prompt_id": prompt.PromptID, "timestamp": m.clock.millis(time.Now())})
+	m.logf("Prompt executed in %.2f seconds", time.Since(prompt.started).Seconds())
+	m.publishEvent("completed", prompt, gin.H{"outputs": outputs})
+	m.ws.send(prompt.ClientID, "executing", gin.H{"node": nil, "prompt_id": prompt.PromptID})
+	prompt.trace.finish(prompt.Status, nil)
 }
 
-func generateMockOutput(promptID string) map[string]interface{} {
-	return map[string]interface{}{
-		"9": map[string]interface{}{
-			"images": []map[string]interface{}{
-				{
-					"filename":  fmt.Sprintf("%s.png", promptID[:8]),
-					"subfolder": "",
-					"type":      "output",
-				},
-			},
-		},
+// injectedFailure 返回 on_submit 脚本指定、SIGUSR1 开启或 --fail-rate 随机注入的失败，没有时 message 为空
+func (m *ComfyUIMock) injectedFailure(prompt *PromptInfo) (exceptionType, message string) {
+	if prompt.script.failure != "" {
+		return "ScriptError", prompt.script.failure
+	}
+	if m.forceFail.Load() {
+		return "RuntimeError", "Injected failure (SIGUSR1)"
+	}
+	if m.cfg.FailRate > 0 && rand.Float64() < m.cfg.FailRate {
+		return "RuntimeError", "Injected failure (--fail-rate)"
+	}
+	return "", ""
+}
+
+// failPrompt 将 prompt 标记为执行失败，错误归到采样节点上。还有重试次数时重新排队并返回 true，调用方需持有锁
+func (m *ComfyUIMock) failPrompt(prompt *PromptInfo, exceptionType, message string) bool {
+	return m.failPromptAt(prompt, "", exceptionType, message)
+}
+
+// failPromptAt 与 failPrompt 相同，nodeID 不为空时错误归到该节点上，调用方需持有锁
+func (m *ComfyUIMock) failPromptAt(prompt *PromptInfo, nodeID, exceptionType, message string) bool {
+	markFailed(prompt, exceptionType, message)
+	if node, ok := prompt.Prompt[nodeID].(map[string]interface{}); ok {
+		prompt.Error["node_id"] = nodeID
+		prompt.Error["node_type"] = node["class_type"]
 	}
+	if m.retryPrompt(prompt) {
+		return true
+	}
+	m.addDeadLetter(prompt)
+	m.persist(prompt)
+	return false
+}
+
+// markFailed 设置失败状态和 ComfyUI 格式的 execution_error 内容
+func markFailed(prompt *PromptInfo, exceptionType, message string) {
+	nodeID, nodeType := findNode(prompt.Prompt, "KSampler", "KSamplerAdvanced", "SamplerCustom")
+
+	prompt.Status = "failed"
+	prompt.FinishedAt = time.Now()
+	prompt.Error = map[string]interface{}{
+		"prompt_id":         prompt.PromptID,
+		"node_id":           nodeID,
+		"node_type":         nodeType,
+		"executed":          []string{},
+		"exception_message": message,
+		"exception_type":    exceptionType,
+		"traceback":         []string{},
+		"current_inputs":    map[string]interface{}{},
+		"current_outputs":   map[string]interface{}{},
+	}
+}
+
+// reportFailure 通知客户端 prompt 执行失败。重新排队的 prompt 对客户端来说仍在队列中，只发布 retrying 事件
+func (m *ComfyUIMock) reportFailure(prompt *PromptInfo, retried bool) {
+	if retried {
+		m.publishEvent("retrying", prompt, gin.H{"attempt": prompt.Attempts, "error": prompt.Error})
+		return
+	}
+	prompt.trace.finish(prompt.Status, prompt.Error)
+	if nodeID, _ := prompt.Error["node_id"].(string); nodeID != "" {
+		m.updateProgressState(prompt, nodeID, "error")
+	}
+	m.logf("!!! Exception during processing !!! %v", prompt.Error["exception_message"])
+	m.ws.send(prompt.ClientID, "execution_error", prompt.Error)
+	m.publishEvent("failed", prompt, gin.H{"error": prompt.Error})
+	m.ws.send(prompt.ClientID, "executing", gin.H{"node": nil, "prompt_id": prompt.PromptID})
+}
+
+// findNode 返回图中第一个 class_type 匹配的节点
+func findNode(graph map[string]interface{}, classTypes ...string) (string, string) {
+	ids := findNodes(graph, classTypes...)
+	if len(ids) == 0 {
+		return "", ""
+	}
+	classType, _ := graph[ids[0]].(map[string]interface{})["class_type"].(string)
+	return ids[0], classType
+}
+
+// findNodes 按节点 ID 排序返回所有 class_type 匹配的节点
+func findNodes(graph map[string]interface{}, classTypes ...string) []string {
+	return findNodesFunc(graph, func(classType string) bool {
+		for _, want := range classTypes {
+			if classType == want {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// findNodesFunc 按节点 ID 排序返回所有 class_type 满足条件的节点
+func findNodesFunc(graph map[string]interface{}, match func(classType string) bool) []string {
+	ids := make([]string, 0, len(graph))
+	for id := range graph {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	matched := []string{}
+	for _, id := range ids {
+		node, ok := graph[id].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		classType, _ := node["class_type"].(string)
+		if match(classType) {
+			matched = append(matched, id)
+		}
+	}
+	return matched
+}
+
+// generateMockOutput 为每个 SaveImage 节点生成以节点 ID 为键的输出
+func generateMockOutput(prompt *PromptInfo, nodeIDs []string) map[string]interface{} {
+	outputs := map[string]interface{}{}
+	for i, nodeID := range nodeIDs {
+		outputs[nodeID] = map[string]interface{}{
+			"images": []map[string]interface{}{imageRecord(prompt, saveImageName(prompt, i, nodeID), "", "output")},
+		}
+	}
+	return outputs
 }
 
 func generatePromptID() string {
 	return uuid.New().String()
 }
 
-func copyAndRenameImage(promptID string) error {
-	sourcePath := "resources/image.jpg"
-	outputDir := "outputs"
-	newFileName := "output_" + promptID[:8] + ".jpg"
-	destPath := filepath.Join(outputDir, newFileName)
-
+func copyFile(sourcePath, destPath string) error {
 	// 确保输出目录存在
-	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+	if err := os.MkdirAll(filepath.Dir(destPath), os.ModePerm); err != nil {
 		return fmt.Errorf("创建输出目录失败: %w", err)
 	}
 
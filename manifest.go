@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// artifact 是 mock 生成的一个输出文件，删除 history 后仍然保留，用于检查 client 的清理逻辑
+type artifact struct {
+	promptID  string
+	nodeID    string
+	fileType  string
+	subfolder string
+	filename  string
+	createdAt time.Time
+}
+
+// recordArtifacts 记录 prompt 输出中引用的所有文件，调用方需持有锁
+func (m *ComfyUIMock) recordArtifacts(prompt *PromptInfo) {
+	for _, nodeID := range sortedKeys(prompt.Output) {
+		for _, record := range fileRecords(prompt.Output[nodeID]) {
+			filename, _ := record["filename"].(string)
+			subfolder, _ := record["subfolder"].(string)
+			fileType, _ := record["type"].(string)
+			m.artifacts = append(m.artifacts, artifact{
+				promptID:  prompt.PromptID,
+				nodeID:    nodeID,
+				fileType:  fileType,
+				subfolder: subfolder,
+				filename:  filename,
+				createdAt: prompt.FinishedAt,
+			})
+		}
+	}
+}
+
+// handleManifest 返回 mock 生成的所有文件及其大小和 sha256，已被删除的文件 exists 为 false。
+// prompt_id 参数只返回一个 prompt 的文件
+func (m *ComfyUIMock) handleManifest(c *gin.Context) {
+	m.mu.Lock()
+	artifacts := append([]artifact{}, m.artifacts...)
+	m.mu.Unlock()
+
+	only, filtered := c.GetQuery("prompt_id")
+	files := []gin.H{}
+	var totalSize int64
+	for _, a := range artifacts {
+		if filtered && a.promptID != only {
+			continue
+		}
+		entry := gin.H{
+			"path":       path.Join(a.fileType, a.subfolder, a.filename),
+			"type":       a.fileType,
+			"subfolder":  a.subfolder,
+			"filename":   a.filename,
+			"prompt_id":  a.promptID,
+			"node_id":    a.nodeID,
+			"created_at": a.createdAt.Format(time.RFC3339Nano),
+			"exists":     false,
+			"size":       nil,
+			"sha256":     nil,
+		}
+		if filePath, err := resolveFilePath(a.fileType, a.subfolder, a.filename); err == nil {
+			if data, err := readOutputFile(filePath); err == nil {
+				sum := sha256.Sum256(data)
+				entry["exists"] = true
+				entry["size"] = len(data)
+				entry["sha256"] = hex.EncodeToString(sum[:])
+				totalSize += int64(len(data))
+			}
+		}
+		files = append(files, entry)
+	}
+
+	remaining := 0
+	for _, file := range files {
+		if file["exists"].(bool) {
+			remaining++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"files": files, "total": len(files), "remaining": remaining, "total_size": totalSize})
+}
+
+// handleManifestReset 清空文件记录，不删除文件本身
+func (m *ComfyUIMock) handleManifestReset(c *gin.Context) {
+	m.mu.Lock()
+	m.artifacts = nil
+	m.mu.Unlock()
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// inMemoryOutputs 由 --in-memory 配置，开启后输出文件不写入磁盘，压测时 mock 不会受限于磁盘 I/O
+var inMemoryOutputs bool
+
+// memFilesMax 由 --in-memory-max-files 配置，内存文件超过这个数量时淘汰最早写入的文件，0 表示不限制
+var memFilesMax int
+
+// memFiles 保存 in-memory 模式下的输出文件，键为本地路径
+var memFiles = &memStore{entries: map[string]*list.Element{}, order: list.New()}
+
+// memFile 在 /view 读取时才生成文件内容
+type memFile func() ([]byte, error)
+
+// memEntry 记录生成函数和写入时间，写入时间作为 /view 的 Last-Modified
+type memEntry struct {
+	path     string
+	generate memFile
+	modTime  time.Time
+}
+
+// memStore 按写入顺序保存内存文件，order 的队首是最早写入的文件
+type memStore struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+func (s *memStore) load(path string) (memEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	element, ok := s.entries[filepath.Clean(path)]
+	if !ok {
+		return memEntry{}, false
+	}
+	return element.Value.(memEntry), true
+}
+
+func storeMemFile(path string, generate memFile) {
+	entry := memEntry{path: filepath.Clean(path), generate: generate, modTime: time.Now()}
+
+	memFiles.mu.Lock()
+	defer memFiles.mu.Unlock()
+	if element, ok := memFiles.entries[entry.path]; ok {
+		memFiles.order.Remove(element)
+	}
+	memFiles.entries[entry.path] = memFiles.order.PushBack(entry)
+	for memFilesMax > 0 && memFiles.order.Len() > memFilesMax {
+		oldest := memFiles.order.Remove(memFiles.order.Front()).(memEntry)
+		delete(memFiles.entries, oldest.path)
+	}
+}
+
+// readOutputFile 读取输出文件，in-memory 模式下的文件按需生成
+func readOutputFile(path string) ([]byte, error) {
+	if entry, ok := memFiles.load(path); ok {
+		return entry.generate()
+	}
+	return os.ReadFile(path)
+}
+
+// outputFileExists 判断文件是否存在，包括 in-memory 模式下的文件
+func outputFileExists(path string) bool {
+	if _, ok := memFiles.load(path); ok {
+		return true
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// wipeMemFiles 删除 dir 下的所有内存文件
+func wipeMemFiles(dir string) int {
+	prefix := filepath.Clean(dir) + string(filepath.Separator)
+	removed := 0
+	memFiles.mu.Lock()
+	defer memFiles.mu.Unlock()
+	for path, element := range memFiles.entries {
+		if strings.HasPrefix(path, prefix) {
+			memFiles.order.Remove(element)
+			delete(memFiles.entries, path)
+			removed++
+		}
+	}
+	return removed
+}
+
+// serveMemFile 直接返回内存中的文件，不存在时返回 false
+func serveMemFile(c *gin.Context, path string, etag bool) bool {
+	entry, ok := memFiles.load(path)
+	if !ok {
+		return false
+	}
+	data, err := entry.generate()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+
+	serveContent(c, path, entry.modTime, bytes.NewReader(data), etag)
+	return true
+}
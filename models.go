@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 与 ComfyUI folder_paths 中 supported_pt_extensions 保持一致
+var modelExtensions = map[string]bool{
+	".ckpt":        true,
+	".pt":          true,
+	".pt2":         true,
+	".bin":         true,
+	".pth":         true,
+	".safetensors": true,
+	".pkl":         true,
+	".sft":         true,
+}
+
+func defaultModels() map[string][]string {
+	return map[string][]string{
+		"checkpoints":    {"v1-5-pruned-emaonly.ckpt"},
+		"configs":        {},
+		"loras":          {},
+		"vae":            {},
+		"clip":           {},
+		"unet":           {},
+		"clip_vision":    {},
+		"style_models":   {},
+		"embeddings":     {},
+		"diffusers":      {},
+		"vae_approx":     {},
+		"controlnet":     {},
+		"gligen":         {},
+		"upscale_models": {},
+		"hypernetworks":  {},
+		"photomaker":     {},
+		"classifiers":    {},
+	}
+}
+
+func loadModelsFixture(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取模型列表文件失败: %w", err)
+	}
+
+	var models map[string][]string
+	if err := json.Unmarshal(data, &models); err != nil {
+		return nil, fmt.Errorf("解析模型列表文件失败: %w", err)
+	}
+	return models, nil
+}
+
+// scanModelsDir 按 ComfyUI models 目录结构扫描，每个一级子目录是一个模型类别
+func scanModelsDir(root string) (map[string][]string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("读取模型目录失败: %w", err)
+	}
+
+	models := make(map[string][]string)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		folder := filepath.Join(root, entry.Name())
+		files := []string{}
+		err := filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if !modelExtensions[strings.ToLower(filepath.Ext(path))] {
+				return nil
+			}
+			rel, err := filepath.Rel(folder, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("扫描模型目录失败: %w", err)
+		}
+
+		sort.Strings(files)
+		models[entry.Name()] = files
+	}
+	return models, nil
+}
+
+// modelFolders 返回当前的模型列表，配置了模型目录时每次请求都重新扫描
+func (m *ComfyUIMock) modelFolders() (map[string][]string, error) {
+	if m.cfg.ModelsDir != "" {
+		return scanModelsDir(m.cfg.ModelsDir)
+	}
+	return m.models, nil
+}
+
+func (m *ComfyUIMock) handleModels(c *gin.Context) {
+	models, err := m.modelFolders()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	folders := make([]string, 0, len(models))
+	for folder := range models {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
+
+	c.JSON(http.StatusOK, folders)
+}
+
+func (m *ComfyUIMock) handleModelFolder(c *gin.Context) {
+	models, err := m.modelFolders()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	files, exists := models[c.Param("folder")]
+	if !exists {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, files)
+}
+
+// handleFolderPaths 与 ComfyUI 的 /internal/folder_paths 一致返回每个类别的绝对路径列表，
+// 另外带上 input、output 和 temp 目录。没有配置 --models-dir 时模型路径是不存在的 models 目录
+func (m *ComfyUIMock) handleFolderPaths(c *gin.Context) {
+	models, err := m.modelFolders()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	modelsRoot := m.cfg.ModelsDir
+	if modelsRoot == "" {
+		modelsRoot = "models"
+	}
+	paths := map[string][]string{}
+	for folder := range models {
+		paths[folder] = []string{absPath(filepath.Join(modelsRoot, folder))}
+	}
+	paths["input"] = []string{absPath(inputDir)}
+	paths["output"] = []string{absPath(outputDir)}
+	paths["temp"] = []string{absPath(tempDir)}
+
+	c.JSON(http.StatusOK, paths)
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+func (m *ComfyUIMock) handleEmbeddings(c *gin.Context) {
+	models, err := m.modelFolders()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// ComfyUI 返回去掉扩展名的 embedding 名称
+	embeddings := []string{}
+	for _, file := range models["embeddings"] {
+		embeddings = append(embeddings, strings.TrimSuffix(file, filepath.Ext(file)))
+	}
+
+	c.JSON(http.StatusOK, embeddings)
+}
+
+func defaultModelMetadata() map[string]map[string]interface{} {
+	return map[string]map[string]interface{}{
+		"*": {
+			"modelspec.sai_model_spec": "1.0.0",
+			"modelspec.architecture":   "stable-diffusion-v1",
+			"modelspec.implementation": "https://github.com/Stability-AI/generative-models",
+			"modelspec.title":          "Mock Model",
+			"format":                   "pt",
+		},
+	}
+}
+
+// loadModelMetadataFixture 读取 safetensors 元数据，键为文件名，"*" 作为默认值
+func loadModelMetadataFixture(path string) (map[string]map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取模型元数据文件失败: %w", err)
+	}
+
+	var metadata map[string]map[string]interface{}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("解析模型元数据文件失败: %w", err)
+	}
+	return metadata, nil
+}
+
+func (m *ComfyUIMock) handleViewMetadata(c *gin.Context) {
+	filename := c.Query("filename")
+	if !strings.HasSuffix(filename, ".safetensors") {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	models, err := m.modelFolders()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	found := false
+	for _, file := range models[c.Param("folder")] {
+		if file == filename {
+			found = true
+			break
+		}
+	}
+	if !found {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	metadata, exists := m.modelMetadata[filename]
+	if !exists {
+		metadata, exists = m.modelMetadata["*"]
+	}
+	if !exists {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, metadata)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runMonitor 按 ComfyUI-Crystools 的格式定期广播 crystools.monitor 消息，执行 prompt 时 GPU 占用接近满载
+func (m *ComfyUIMock) runMonitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.mu.Lock()
+		busy := m.runningTask != nil
+		vramUsed := m.vramUsed
+		m.mu.Unlock()
+
+		m.ws.broadcast("crystools.monitor", monitorData(busy, vramUsed, m.cfg.VRAMTotalMB*mib))
+	}
+}
+
+func monitorData(busy bool, vramUsed, vramTotal int64) gin.H {
+	gpuUtilization := rand.Float64() * 3
+	temperature := 38 + rand.Float64()*4
+	cpuUtilization := 2 + rand.Float64()*8
+	if busy {
+		gpuUtilization = 94 + rand.Float64()*6
+		temperature = 68 + rand.Float64()*8
+		cpuUtilization = 10 + rand.Float64()*15
+	}
+
+	// 与 /system_stats 一致：32 GiB 内存，约一半已使用
+	ramTotal := int64(32768) * mib
+	ramUsed := int64(16384)*mib + rand.Int63n(1024*mib)
+	hddTotal := int64(1024*1024) * mib
+	hddUsed := hddTotal * 2 / 5
+
+	vramPercent := 0.0
+	if vramTotal > 0 {
+		vramPercent = float64(vramUsed) * 100 / float64(vramTotal)
+	}
+
+	return gin.H{
+		"cpu_utilization":  cpuUtilization,
+		"ram_total":        ramTotal,
+		"ram_used":         ramUsed,
+		"ram_used_percent": float64(ramUsed) * 100 / float64(ramTotal),
+		"hdd_total":        hddTotal,
+		"hdd_used":         hddUsed,
+		"hdd_used_percent": float64(hddUsed) * 100 / float64(hddTotal),
+		"device_type":      "cuda",
+		"gpus": []gin.H{
+			{
+				"gpu_utilization":   gpuUtilization,
+				"gpu_temperature":   temperature,
+				"vram_total":        vramTotal,
+				"vram_used":         vramUsed,
+				"vram_used_percent": vramPercent,
+			},
+		},
+	}
+}
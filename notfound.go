@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxUnknownRoutes 限制统计的未实现路由数量，避免扫描器请求时无限增长
+const maxUnknownRoutes = 1000
+
+type unknownRouteKey struct {
+	method string
+	path   string
+}
+
+type unknownRouteHit struct {
+	status int
+	count  int
+	first  time.Time
+	last   time.Time
+	client string
+}
+
+// unknownRoutes 统计 mock 没有实现的路由，用于发现 client 调用了哪些 mock 不支持的接口
+type unknownRoutes struct {
+	mu   sync.Mutex
+	hits map[unknownRouteKey]*unknownRouteHit
+}
+
+func newUnknownRoutes() *unknownRoutes {
+	return &unknownRoutes{hits: map[unknownRouteKey]*unknownRouteHit{}}
+}
+
+// record 记录一次请求，返回是否是第一次请求这个路由
+func (u *unknownRoutes) record(c *gin.Context, status int) bool {
+	key := unknownRouteKey{method: c.Request.Method, path: c.Request.URL.Path}
+	client := c.Query("client_id")
+	if client == "" {
+		client = c.ClientIP()
+	}
+	now := time.Now()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	hit, ok := u.hits[key]
+	if !ok {
+		if len(u.hits) >= maxUnknownRoutes {
+			return false
+		}
+		hit = &unknownRouteHit{first: now}
+		u.hits[key] = hit
+	}
+	hit.status = status
+	hit.count++
+	hit.last = now
+	hit.client = client
+	return !ok
+}
+
+// handleNotFound 与 ComfyUI (aiohttp) 一致返回纯文本的 "404: Not Found"
+func (m *ComfyUIMock) handleNotFound(c *gin.Context) {
+	m.unknownRoute(c, http.StatusNotFound)
+}
+
+// handleMethodNotAllowed 与 aiohttp 一致返回纯文本的 "405: Method Not Allowed"，Allow 头由 gin 设置
+func (m *ComfyUIMock) handleMethodNotAllowed(c *gin.Context) {
+	m.unknownRoute(c, http.StatusMethodNotAllowed)
+}
+
+// unknownRoute 用注册的桩响应未实现的路由，没有桩时记录路由并返回 aiohttp 格式的错误，开启 --log-unknown-routes 时醒目地输出到日志和标准错误
+func (m *ComfyUIMock) unknownRoute(c *gin.Context, status int) {
+	if m.serveStub(c) {
+		return
+	}
+	first := m.unknown.record(c, status)
+	if m.cfg.LogUnknown {
+		message := fmt.Sprintf("!!! Unknown route: %s %s -> %d (not implemented by mock-comfy)", c.Request.Method, c.Request.URL.Path, status)
+		if first {
+			fmt.Fprintf(os.Stderr, "\n%s\n\n", message)
+		}
+		m.logf("%s", message)
+	}
+
+	c.Header("X-Mock-Warning", "route not implemented by mock: "+c.Request.Method+" "+c.Request.URL.Path)
+	c.Data(status, "text/plain; charset=utf-8", []byte(fmt.Sprintf("%d: %s", status, http.StatusText(status))))
+}
+
+// handleUnknownRoutes 返回 client 请求过的未实现路由，按请求次数从多到少排序
+func (m *ComfyUIMock) handleUnknownRoutes(c *gin.Context) {
+	m.unknown.mu.Lock()
+	routes := make([]gin.H, 0, len(m.unknown.hits))
+	for key, hit := range m.unknown.hits {
+		routes = append(routes, gin.H{
+			"method":      key.method,
+			"path":        key.path,
+			"status":      hit.status,
+			"count":       hit.count,
+			"first_at":    hit.first.Format(time.RFC3339Nano),
+			"last_at":     hit.last.Format(time.RFC3339Nano),
+			"last_client": hit.client,
+		})
+	}
+	m.unknown.mu.Unlock()
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i]["count"] != routes[j]["count"] {
+			return routes[i]["count"].(int) > routes[j]["count"].(int)
+		}
+		if routes[i]["path"] != routes[j]["path"] {
+			return routes[i]["path"].(string) < routes[j]["path"].(string)
+		}
+		return routes[i]["method"].(string) < routes[j]["method"].(string)
+	})
+	c.JSON(http.StatusOK, gin.H{"routes": routes})
+}
+
+func (m *ComfyUIMock) handleUnknownRoutesReset(c *gin.Context) {
+	m.unknown.mu.Lock()
+	m.unknown.hits = map[unknownRouteKey]*unknownRouteHit{}
+	m.unknown.mu.Unlock()
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadObjectInfo 读取内置节点定义，并合并自定义节点片段
+func loadObjectInfo(path, customNodes string) (map[string]interface{}, error) {
+	var objectInfo map[string]interface{}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		// 没有 object_info 文件时使用内置的核心节点定义
+		if err := json.Unmarshal(defaultObjectInfo, &objectInfo); err != nil {
+			return nil, fmt.Errorf("解析内置 object_info 失败: %w", err)
+		}
+	} else {
+		objectInfo, err = readObjectInfoFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	files, err := customNodeFiles(customNodes)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		fragment, err := readObjectInfoFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for nodeClass, info := range fragment {
+			objectInfo[nodeClass] = info
+		}
+	}
+	return objectInfo, nil
+}
+
+func readObjectInfoFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 object_info 文件失败: %w", err)
+	}
+
+	var objectInfo map[string]interface{}
+	if err := json.Unmarshal(data, &objectInfo); err != nil {
+		return nil, fmt.Errorf("解析 object_info 文件 %s 失败: %w", path, err)
+	}
+	return objectInfo, nil
+}
+
+// customNodeFiles 展开逗号分隔的文件和目录列表，目录中按文件名顺序读取所有 .json 文件
+func customNodeFiles(paths string) ([]string, error) {
+	files := []string{}
+	for _, path := range strings.Split(paths, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取自定义节点定义失败: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+func (m *ComfyUIMock) currentObjectInfo() map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.objectInfo
+}
+
+func (m *ComfyUIMock) handleObjectInfo(c *gin.Context) {
+	c.JSON(http.StatusOK, m.currentObjectInfo())
+}
+
+func (m *ComfyUIMock) handleObjectInfoNode(c *gin.Context) {
+	nodeClass := c.Param("node_class")
+	info, exists := m.currentObjectInfo()[nodeClass]
+	if !exists {
+		c.JSON(http.StatusOK, gin.H{})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{nodeClass: info})
+}
+
+// handleObjectInfoInject 运行时合并自定义节点定义，请求体格式与 /object_info 相同
+func (m *ComfyUIMock) handleObjectInfoInject(c *gin.Context) {
+	var fragment map[string]interface{}
+	if err := c.ShouldBindJSON(&fragment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	m.mu.Lock()
+	// 替换整个 map，避免与正在序列化的响应发生竞争
+	objectInfo := make(map[string]interface{}, len(m.objectInfo)+len(fragment))
+	for nodeClass, info := range m.objectInfo {
+		objectInfo[nodeClass] = info
+	}
+	for nodeClass, info := range fragment {
+		objectInfo[nodeClass] = info
+	}
+	m.objectInfo = objectInfo
+	m.mu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"injected": sortedKeys(fragment)})
+}
+
+func (m *ComfyUIMock) handleObjectInfoRemove(c *gin.Context) {
+	nodeClass := c.Param("node_class")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.objectInfo[nodeClass]; !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node class not found"})
+		return
+	}
+
+	objectInfo := make(map[string]interface{}, len(m.objectInfo))
+	for name, info := range m.objectInfo {
+		if name != nodeClass {
+			objectInfo[name] = info
+		}
+	}
+	m.objectInfo = objectInfo
+
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ObjectStore 保存生成的输出文件，供 /view 重定向或代理读取
+type ObjectStore interface {
+	Put(key string, data []byte) error
+	Get(key string) (*http.Response, error)
+	PresignGet(key string, expires time.Duration) (string, error)
+}
+
+// s3Store 使用 path-style 访问 S3 兼容存储，兼容 MinIO，签名为 AWS SigV4
+type s3Store struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	prefix    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// newS3Store 凭证从 AWS_ACCESS_KEY_ID 和 AWS_SECRET_ACCESS_KEY 读取
+func newS3Store(endpoint, bucket, region, prefix string) (*s3Store, error) {
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("S3 地址格式错误: %s", endpoint)
+	}
+
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("使用 S3 存储时必须设置 AWS_ACCESS_KEY_ID 和 AWS_SECRET_ACCESS_KEY")
+	}
+
+	return &s3Store{
+		endpoint:  u,
+		bucket:    bucket,
+		region:    region,
+		prefix:    prefix,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (s *s3Store) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	u.Path = "/" + s.bucket + "/" + path.Join(s.prefix, key)
+	u.RawPath = s3EscapePath(u.Path)
+	return &u
+}
+
+func (s *s3Store) Put(key string, data []byte) error {
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(key).String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	sum := sha256.Sum256(data)
+	s.sign(req, hex.EncodeToString(sum[:]), time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("上传到 S3 失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("上传到 S3 失败: %s %s", resp.Status, body)
+	}
+	return nil
+}
+
+func (s *s3Store) Get(key string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, s.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, "UNSIGNED-PAYLOAD", time.Now().UTC())
+	return s.client.Do(req)
+}
+
+func (s *s3Store) PresignGet(key string, expires time.Duration) (string, error) {
+	now := time.Now().UTC()
+	u := s.objectURL(key)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", fmt.Sprint(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		s3EscapeQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	query.Set("X-Amz-Signature", s.signature(now, canonical))
+	u.RawQuery = s3EscapeQuery(query)
+	return u.String(), nil
+}
+
+// sign 为请求添加 SigV4 Authorization 头
+func (s *s3Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3EscapeQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, s.scope(now), signedHeaders, s.signature(now, canonical)))
+}
+
+func (s *s3Store) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+func (s *s3Store) signature(now time.Time, canonical string) string {
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format("20060102T150405Z"),
+		s.scope(now),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath 按 SigV4 要求编码路径，保留 "/"
+func s3EscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func s3EscapeQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := []string{}
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, s3Escape(key)+"="+s3Escape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape 只保留 RFC 3986 中的非保留字符
+func s3Escape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// objectKey 与本地目录结构一致：type/subfolder/filename
+func objectKey(fileType, subfolder, filename string) string {
+	return path.Join(fileType, filepath.ToSlash(subfolder), path.Base(filename))
+}
+
+// uploadOutputs 将 history outputs 中引用的文件上传到对象存储
+func (m *ComfyUIMock) uploadOutputs(outputs map[string]interface{}) {
+	if m.objects == nil {
+		return
+	}
+
+	for _, output := range outputs {
+		for _, record := range fileRecords(output) {
+			filename, _ := record["filename"].(string)
+			subfolder, _ := record["subfolder"].(string)
+			fileType, _ := record["type"].(string)
+
+			localPath, err := resolveFilePath(fileType, subfolder, filename)
+			if err != nil {
+				continue
+			}
+			data, err := readOutputFile(localPath)
+			if err != nil {
+				fmt.Printf("读取输出文件失败: %v\n", err)
+				continue
+			}
+			if err := m.objects.Put(objectKey(fileType, subfolder, filename), data); err != nil {
+				fmt.Printf("%v\n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errOrphaned 是 --orphaned-jobs=cancel 时取消执行中 prompt 的原因
+var errOrphaned = errors.New("client disconnected")
+
+// clientDisconnected 在 sid 的最后一个 WebSocket 连接断开时调用，按 --orphaned-jobs 处理该 client 未完成的 prompt
+func (m *ComfyUIMock) clientDisconnected(sid string) {
+	m.mu.Lock()
+	now := time.Now()
+	m.disconnected[sid] = now
+	policy := m.cfg.OrphanedJobs
+	if policy != "mark" && policy != "cancel" {
+		m.mu.Unlock()
+		return
+	}
+
+	orphans := []*PromptInfo{}
+	for _, prompt := range m.pending {
+		if prompt.ClientID == sid {
+			orphans = append(orphans, prompt)
+		}
+	}
+	if m.runningTask != nil && m.runningTask.ClientID == sid {
+		orphans = append(orphans, m.runningTask)
+	}
+
+	for _, prompt := range orphans {
+		prompt.OrphanedAt = now
+		if policy == "cancel" {
+			if prompt == m.runningTask {
+				m.cancelRunning(errOrphaned)
+			} else {
+				m.removePending(prompt)
+			}
+			// 与 ComfyUI 中断执行时的异常一致
+			markFailed(prompt, "comfy.model_management.InterruptProcessingException", "Client disconnected, prompt cancelled")
+		}
+		m.persist(prompt)
+	}
+	m.mu.Unlock()
+
+	if len(orphans) == 0 {
+		return
+	}
+	for _, prompt := range orphans {
+		if policy == "mark" {
+			m.publishEvent("orphaned", prompt, nil)
+			continue
+		}
+		prompt.trace.finish(prompt.Status, prompt.Error)
+		m.publishEvent("failed", prompt, gin.H{"error": prompt.Error})
+	}
+	if policy == "cancel" {
+		m.broadcastStatus()
+	}
+}
+
+// handleOrphans 返回断开连接的 client 提交的 prompt：keep 模式下是仍未完成的 prompt，
+// mark 和 cancel 模式下还包括已经标记或取消的 prompt
+func (m *ComfyUIMock) handleOrphans(c *gin.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	orphans := []gin.H{}
+	for _, prompt := range m.prompts {
+		disconnectedAt, disconnected := m.disconnected[prompt.ClientID]
+		active := prompt.Status == "pending" || prompt.Status == "processing"
+		if prompt.OrphanedAt.IsZero() && !(disconnected && active) {
+			continue
+		}
+		orphanedAt := prompt.OrphanedAt
+		if orphanedAt.IsZero() {
+			orphanedAt = disconnectedAt
+		}
+		orphans = append(orphans, gin.H{
+			"prompt_id":           prompt.PromptID,
+			"client_id":           prompt.ClientID,
+			"number":              prompt.ID,
+			"status":              prompt.Status,
+			"orphaned_at":         orphanedAt,
+			"client_disconnected": disconnected,
+		})
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i]["number"].(int) < orphans[j]["number"].(int) })
+
+	c.JSON(http.StatusOK, gin.H{
+		"policy":               m.cfg.OrphanedJobs,
+		"disconnected_clients": m.disconnected,
+		"orphans":              orphans,
+	})
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// outputGenerator 为单个输出节点生成 history 中的 output，并写入对应的文件
+type outputGenerator func(prompt *PromptInfo, nodeID string, node map[string]interface{}) (map[string]interface{}, error)
+
+// outputGenerators 按 class_type 选择输出类型
+var outputGenerators = map[string]outputGenerator{
+	"PreviewImage":           previewImageOutput,
+	"SaveLatent":             latentOutput,
+	"ShowText|pysssss":       textOutput,
+	"PreviewAny":             textOutput,
+	"SaveAudio":              audioOutput("output"),
+	"PreviewAudio":           audioOutput("temp"),
+	"ADE_AnimateDiffCombine": animateDiffOutput,
+	"VHS_VideoCombine":       videoCombineOutput,
+}
+
+// buildOutputs 按图中的输出节点生成 history outputs，并写入对应的文件，选择了 --output-generator 时优先使用。
+// 只读取 prompt 的图，调用方不能持有锁
+func (m *ComfyUIMock) buildOutputs(prompt *PromptInfo) map[string]interface{} {
+	if outputs, ok, err := pluginOutputs(prompt); err != nil {
+		fmt.Printf("输出生成器出错，使用内置的输出: %v\n", err)
+	} else if ok {
+		return outputs
+	}
+
+	outputs := map[string]interface{}{}
+
+	saveNodes := findNodes(prompt.Prompt, "SaveImage")
+	wsNodes := findNodes(prompt.Prompt, "SaveImageWebsocket")
+
+	generated := 0
+	for _, nodeID := range sortedNodeIDs(prompt.Prompt) {
+		node, _ := prompt.Prompt[nodeID].(map[string]interface{})
+		classType, _ := node["class_type"].(string)
+		generate, ok := outputGenerators[classType]
+		if !ok {
+			continue
+		}
+
+		output, err := generate(prompt, nodeID, node)
+		if err != nil {
+			fmt.Printf("生成节点 %s 的输出时出错: %v\n", nodeID, err)
+			continue
+		}
+		outputs[nodeID] = output
+		generated++
+	}
+	if m.cfg.Lenient {
+		generated += lenientOutputs(prompt, outputs)
+	}
+
+	// 没有其他可识别的输出节点时保持原有行为，固定输出节点 9
+	if len(saveNodes) == 0 && generated == 0 && len(wsNodes) == 0 {
+		saveNodes = []string{"9"}
+	}
+	for nodeID, output := range generateMockOutput(prompt, saveNodes) {
+		outputs[nodeID] = output
+	}
+	for i, nodeID := range saveNodes {
+		// 复制图片文件并重命名
+		if err := m.writeOutputImage(prompt, saveImageName(prompt, i, nodeID)); err != nil {
+			fmt.Printf("复制和重命名图片时出错: %v\n", err)
+		}
+	}
+
+	return outputs
+}
+
+func sortedNodeIDs(graph map[string]interface{}) []string {
+	return findNodesFunc(graph, func(string) bool { return true })
+}
+
+// nodeFileName 返回输出节点写入的文件名，如 preview_<prompt_id 前 8 位>_<节点>.png
+func nodeFileName(kind string, prompt *PromptInfo, nodeID, ext string) string {
+	return fmt.Sprintf("%s_%s_%s%s", kind, shortPromptID(prompt), nodeID, ext)
+}
+
+func fileRecord(filename, subfolder, fileType string) map[string]interface{} {
+	return map[string]interface{}{
+		"filename":  filename,
+		"subfolder": subfolder,
+		"type":      fileType,
+	}
+}
+
+// previewImageOutput PreviewImage 节点的结果写入 temp 目录
+func previewImageOutput(prompt *PromptInfo, nodeID string, node map[string]interface{}) (map[string]interface{}, error) {
+	filename := nodeFileName("preview", prompt, nodeID, promptExt(prompt))
+	data, err := promptImage(prompt)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(filepath.Join(tempDir, filename), data); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"images": []map[string]interface{}{imageRecord(prompt, filename, "", "temp")},
+	}, nil
+}
+
+// textOutput 文本节点原样回显输入的 text，没有时返回固定文本
+func textOutput(prompt *PromptInfo, nodeID string, node map[string]interface{}) (map[string]interface{}, error) {
+	text := fmt.Sprintf("mock text output for node %s", nodeID)
+	if inputs, ok := node["inputs"].(map[string]interface{}); ok {
+		if value, ok := inputs["text"].(string); ok {
+			text = value
+		}
+	}
+	return map[string]interface{}{"text": []string{text}}, nil
+}
+
+// latentOutput 写入一个最小的 safetensors 格式 .latent 文件
+func latentOutput(prompt *PromptInfo, nodeID string, node map[string]interface{}) (map[string]interface{}, error) {
+	filename := nodeFileName("latent", prompt, nodeID, ".latent")
+	shape := []int{1, 4, 8, 8}
+	size := 4 * shape[0] * shape[1] * shape[2] * shape[3]
+
+	header, err := json.Marshal(map[string]interface{}{
+		"latent_tensor": map[string]interface{}{
+			"dtype":        "F32",
+			"shape":        shape,
+			"data_offsets": []int{0, size},
+		},
+		"latent_format_version_0": map[string]interface{}{
+			"dtype":        "F32",
+			"shape":        []int{0},
+			"data_offsets": []int{size, size},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint64(len(header)))
+	buf.Write(header)
+	buf.Write(make([]byte, size))
+
+	if err := writeFile(filepath.Join(outputDir, "latents", filename), buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"latents": []map[string]interface{}{fileRecord(filename, "latents", "output")},
+	}, nil
+}
+
+// audioOutput 写入一秒静音的 WAV 文件
+func audioOutput(fileType string) outputGenerator {
+	return func(prompt *PromptInfo, nodeID string, node map[string]interface{}) (map[string]interface{}, error) {
+		filename := nodeFileName("audio", prompt, nodeID, ".wav")
+		baseDir, _ := typeDir(fileType)
+
+		const sampleRate = 44100
+		dataSize := uint32(sampleRate * 2)
+		var buf bytes.Buffer
+		buf.WriteString("RIFF")
+		binary.Write(&buf, binary.LittleEndian, 36+dataSize)
+		buf.WriteString("WAVEfmt ")
+		binary.Write(&buf, binary.LittleEndian, uint32(16))
+		binary.Write(&buf, binary.LittleEndian, uint16(1))
+		binary.Write(&buf, binary.LittleEndian, uint16(1))
+		binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+		binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*2))
+		binary.Write(&buf, binary.LittleEndian, uint16(2))
+		binary.Write(&buf, binary.LittleEndian, uint16(16))
+		buf.WriteString("data")
+		binary.Write(&buf, binary.LittleEndian, dataSize)
+		buf.Write(make([]byte, dataSize))
+
+		if err := writeFile(filepath.Join(baseDir, "audio", filename), buf.Bytes()); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"audio": []map[string]interface{}{fileRecord(filename, "audio", fileType)},
+		}, nil
+	}
+}
+
+// animateDiffOutput 生成 GIF 动画，输出到 AnimateDiff 使用的 gifs 字段
+func animateDiffOutput(prompt *PromptInfo, nodeID string, node map[string]interface{}) (map[string]interface{}, error) {
+	filename := nodeFileName("animatediff", prompt, nodeID, ".gif")
+
+	frames, err := videoFrames()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := encodeGIF(frames, 8)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeFile(filepath.Join(outputDir, filename), data); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"gifs": []map[string]interface{}{fileRecord(filename, "", "output")},
+	}, nil
+}
+
+// writeFile 写入输出文件，in-memory 模式下只保存在内存中
+func writeFile(path string, data []byte) error {
+	if inMemoryOutputs {
+		storeMemFile(path, func() ([]byte, error) { return data, nil })
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("创建输出目录失败: %w", err)
+	}
+	return disk.track(path, func() error {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("写入文件失败: %w", err)
+		}
+		return nil
+	})
+}
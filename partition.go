@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// wsPartition 模拟只影响 WebSocket 的网络分区：HTTP 接口正常，推送消息被丢弃或冻结，
+// 连接本身保持打开，客户端只能通过轮询发现执行状态
+type wsPartition struct {
+	// mode 为 drop 时丢弃消息，为 freeze 时暂存消息，分区恢复后按顺序发出
+	mode     string
+	clientID string
+	until    time.Time
+	held     []func() error
+	dropped  int
+}
+
+// deliver 写出一条消息，分区中的 WebSocket 连接的消息被丢弃或暂存
+func (h *wsHub) deliver(sid string, client eventClient, write func() error) {
+	if _, ok := client.(*wsClient); ok {
+		h.mu.Lock()
+		p := h.partition
+		if p != nil && (p.clientID == "" || p.clientID == sid) {
+			if p.mode == "freeze" {
+				p.held = append(p.held, write)
+			} else {
+				p.dropped++
+			}
+			h.mu.Unlock()
+			return
+		}
+		h.mu.Unlock()
+	}
+	if err := write(); err != nil {
+		fmt.Printf("发送 WebSocket 消息失败: %v\n", err)
+	}
+}
+
+// partitionWS 开始分区，duration 为 0 时直到调用 heal 才恢复
+func (h *wsHub) partitionWS(mode, clientID string, duration time.Duration) *wsPartition {
+	h.heal()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	p := &wsPartition{mode: mode, clientID: clientID}
+	if duration > 0 {
+		p.until = time.Now().Add(duration)
+		// 分区已被手动恢复或替换时不再处理
+		time.AfterFunc(duration, func() {
+			h.mu.Lock()
+			current := h.partition == p
+			h.mu.Unlock()
+			if current {
+				h.heal()
+			}
+		})
+	}
+	h.partition = p
+	return p
+}
+
+// heal 结束分区并按顺序发出冻结的消息，返回发出和丢弃的消息数
+func (h *wsHub) heal() (released, dropped int) {
+	h.mu.Lock()
+	p := h.partition
+	h.partition = nil
+	h.mu.Unlock()
+	if p == nil {
+		return 0, 0
+	}
+	for _, write := range p.held {
+		if err := write(); err != nil {
+			fmt.Printf("发送 WebSocket 消息失败: %v\n", err)
+		}
+	}
+	return len(p.held), p.dropped
+}
+
+// handleWSPartition 开始只影响 WebSocket 的分区，mode 为 drop 或 freeze，seconds 为 0 时直到 DELETE 才恢复
+func (m *ComfyUIMock) handleWSPartition(c *gin.Context) {
+	var request struct {
+		Mode     string  `json:"mode"`
+		Seconds  float64 `json:"seconds"`
+		ClientID string  `json:"client_id"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Mode == "" {
+		request.Mode = "drop"
+	}
+	if request.Mode != "drop" && request.Mode != "freeze" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown mode: %s", request.Mode)})
+		return
+	}
+
+	p := m.ws.partitionWS(request.Mode, request.ClientID, time.Duration(request.Seconds*float64(time.Second)))
+	response := gin.H{"mode": p.mode, "client_id": p.clientID, "until": nil}
+	if !p.until.IsZero() {
+		response["until"] = p.until.Format(time.RFC3339Nano)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleWSPartitionStatus 返回当前的分区状态，没有分区时 mode 为空
+func (m *ComfyUIMock) handleWSPartitionStatus(c *gin.Context) {
+	m.ws.mu.Lock()
+	defer m.ws.mu.Unlock()
+	p := m.ws.partition
+	if p == nil {
+		c.JSON(http.StatusOK, gin.H{"mode": ""})
+		return
+	}
+	response := gin.H{"mode": p.mode, "client_id": p.clientID, "until": nil, "held": len(p.held), "dropped": p.dropped}
+	if !p.until.IsZero() {
+		response["until"] = p.until.Format(time.RFC3339Nano)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleWSHeal 结束分区，冻结的消息按顺序发出
+func (m *ComfyUIMock) handleWSHeal(c *gin.Context) {
+	released, dropped := m.ws.heal()
+	c.JSON(http.StatusOK, gin.H{"released": released, "dropped": dropped})
+}
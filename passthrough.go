@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"path/filepath"
+)
+
+// parsePassthrough 检查 --passthrough 的值
+func parsePassthrough(value string) error {
+	switch value {
+	case "", "copy", "grayscale":
+		return nil
+	}
+	return fmt.Errorf("不支持的 passthrough 模式: %s，可选 copy 或 grayscale", value)
+}
+
+// passthroughSource 返回 LoadImage 节点引用的输入图片路径
+func passthroughSource(graph map[string]interface{}) (string, bool) {
+	nodeID, _ := findNode(graph, "LoadImage", "LoadImageMask")
+	if nodeID == "" {
+		return "", false
+	}
+
+	node := graph[nodeID].(map[string]interface{})
+	inputs, _ := node["inputs"].(map[string]interface{})
+	name, _ := inputs["image"].(string)
+	return resolveImageInput(name)
+}
+
+// writeOutputImage 根据 passthrough 配置生成输出图片并写入 filename，in-memory 模式下推迟到 /view 读取时才生成
+func (m *ComfyUIMock) writeOutputImage(prompt *PromptInfo, filename string) error {
+	destPath := filepath.Join(outputDir, filename)
+	if inMemoryOutputs {
+		storeMemFile(destPath, func() ([]byte, error) { return m.outputImage(prompt) })
+		return nil
+	}
+
+	data, err := m.outputImage(prompt)
+	if err != nil {
+		return err
+	}
+	return writeFile(destPath, data)
+}
+
+// outputImage 返回 SaveImage 节点输出图片的内容
+func (m *ComfyUIMock) outputImage(prompt *PromptInfo) ([]byte, error) {
+	sourcePath, ok := passthroughSource(prompt.Prompt)
+
+	switch {
+	case m.cfg.Passthrough == "grayscale":
+		var src image.Image
+		var err error
+		if ok {
+			src, err = decodeImageFile(sourcePath)
+		} else {
+			src, err = decodeImageFixture()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if width, height, ok := renderSize(prompt.Prompt); ok {
+			src = resizeImage(src, width, height)
+		}
+		format, _ := promptImageFormat(prompt.Prompt)
+		return grayscaleImage(src, format)
+	case m.cfg.Passthrough != "" && ok:
+		data, err := readOutputFile(sourcePath)
+		if err != nil {
+			return nil, fmt.Errorf("读取源文件失败: %w", err)
+		}
+		format, chosen := promptImageFormat(prompt.Prompt)
+		if width, height, ok := renderSize(prompt.Prompt); ok {
+			return resizeImageData(data, width, height, format, chosen)
+		}
+		// 没有指定格式时输出文件名的扩展名仍按 --image-fixture 决定，源图片格式不同时需要重新编码
+		if chosen || !matchesFormat(data, format) {
+			return convertImage(data, format)
+		}
+		return data, nil
+	}
+
+	return promptImage(prompt)
+}
+
+func grayscaleImage(src image.Image, format imageFormat) ([]byte, error) {
+	gray := image.NewGray(src.Bounds())
+	draw.Draw(gray, gray.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	var buf bytes.Buffer
+	if err := encodeImage(&buf, gray, format); err != nil {
+		return nil, fmt.Errorf("保存输出图片失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pollWindow 是计算轮询频率时使用的最近请求数
+const pollWindow = 10
+
+// maxPollEntries 限制统计的 (client, 接口, prompt) 组合数量，避免压测时无限增长
+const maxPollEntries = 10000
+
+// polledEndpoints 是统计轮询的接口
+var polledEndpoints = map[string]bool{
+	"/history":            true,
+	"/history/:prompt_id": true,
+	"/queue":              true,
+}
+
+type pollKey struct {
+	client   string
+	endpoint string
+	promptID string
+}
+
+type pollStats struct {
+	count       int
+	first       time.Time
+	last        time.Time
+	minInterval time.Duration
+	peakRate    float64
+	warnings    int
+	recent      []time.Time
+}
+
+// pollTracker 统计每个 client 对 /history 和 /queue 的轮询频率
+type pollTracker struct {
+	mu      sync.Mutex
+	entries map[pollKey]*pollStats
+}
+
+func newPollTracker() *pollTracker {
+	return &pollTracker{entries: map[pollKey]*pollStats{}}
+}
+
+// record 记录一次轮询并返回最近 pollWindow 次请求的频率 (次/秒)
+func (t *pollTracker) record(key pollKey, now time.Time) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats, ok := t.entries[key]
+	if !ok {
+		if len(t.entries) >= maxPollEntries {
+			return 0
+		}
+		stats = &pollStats{first: now}
+		t.entries[key] = stats
+	}
+	if stats.count > 0 {
+		interval := now.Sub(stats.last)
+		if stats.count == 1 || interval < stats.minInterval {
+			stats.minInterval = interval
+		}
+	}
+	stats.count++
+	stats.last = now
+	stats.recent = append(stats.recent, now)
+	if len(stats.recent) > pollWindow {
+		stats.recent = stats.recent[1:]
+	}
+
+	// 至少 3 次请求才计算频率，避免偶尔连续两次请求被当成高频轮询
+	if len(stats.recent) < 3 {
+		return 0
+	}
+	span := now.Sub(stats.recent[0]).Seconds()
+	if span <= 0 {
+		return 0
+	}
+	rate := float64(len(stats.recent)-1) / span
+	stats.peakRate = max(stats.peakRate, rate)
+	return rate
+}
+
+func (t *pollTracker) warn(key pollKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if stats, ok := t.entries[key]; ok {
+		stats.warnings++
+	}
+}
+
+// pollingMiddleware 统计轮询，超过 --poll-max-rate 时在响应中加上 X-Mock-Warning 并写入日志。
+// client 由 client_id 参数识别，没有时使用客户端 IP
+func (m *ComfyUIMock) pollingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet || !polledEndpoints[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		client := c.Query("client_id")
+		if client == "" {
+			client = c.ClientIP()
+		}
+		key := pollKey{client: client, endpoint: c.FullPath(), promptID: c.Param("prompt_id")}
+		rate := m.polls.record(key, time.Now())
+		if m.cfg.PollMaxRate > 0 && rate > m.cfg.PollMaxRate {
+			m.polls.warn(key)
+			c.Header("X-Mock-Warning", "polling too fast")
+			m.logf("Client %s polls %s at %.1f req/s, limit is %.1f req/s", client, c.Request.URL.Path, rate, m.cfg.PollMaxRate)
+		}
+		c.Next()
+	}
+}
+
+// handlePolling 返回每个 client 的轮询统计，abusive 表示有 client 超过了 --poll-max-rate
+func (m *ComfyUIMock) handlePolling(c *gin.Context) {
+	m.polls.mu.Lock()
+	clients := map[string][]gin.H{}
+	abusive := false
+	for key, stats := range m.polls.entries {
+		var avgInterval float64
+		if stats.count > 1 {
+			avgInterval = float64(stats.last.Sub(stats.first).Milliseconds()) / float64(stats.count-1)
+		}
+		clients[key.client] = append(clients[key.client], gin.H{
+			"endpoint":        key.endpoint,
+			"prompt_id":       key.promptID,
+			"polls":           stats.count,
+			"first_at":        stats.first.Format(time.RFC3339Nano),
+			"last_at":         stats.last.Format(time.RFC3339Nano),
+			"avg_interval_ms": avgInterval,
+			"min_interval_ms": stats.minInterval.Milliseconds(),
+			"peak_rate":       stats.peakRate,
+			"warnings":        stats.warnings,
+		})
+		abusive = abusive || stats.warnings > 0
+	}
+	m.polls.mu.Unlock()
+
+	for _, entries := range clients {
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i]["endpoint"] != entries[j]["endpoint"] {
+				return entries[i]["endpoint"].(string) < entries[j]["endpoint"].(string)
+			}
+			return entries[i]["prompt_id"].(string) < entries[j]["prompt_id"].(string)
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"max_rate": m.cfg.PollMaxRate, "abusive": abusive, "clients": clients})
+}
+
+func (m *ComfyUIMock) handlePollingReset(c *gin.Context) {
+	m.polls.mu.Lock()
+	m.polls.entries = map[pollKey]*pollStats{}
+	m.polls.mu.Unlock()
+	c.Status(http.StatusNoContent)
+}
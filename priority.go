@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestPriority 从 extra_data.priority 或 X-Priority 请求头读取优先级，extra_data 优先
+func requestPriority(c *gin.Context, extraData map[string]interface{}) (int, error) {
+	switch value := extraData["priority"].(type) {
+	case nil:
+	case float64:
+		return int(value), nil
+	case string:
+		return parsePriority(value)
+	default:
+		return 0, fmt.Errorf("invalid priority: %v", value)
+	}
+
+	if header := c.GetHeader("X-Priority"); header != "" {
+		return parsePriority(header)
+	}
+	return 0, nil
+}
+
+func parsePriority(value string) (int, error) {
+	priority, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid priority: %s", value)
+	}
+	return priority, nil
+}
+
+// effectivePriority 是加上等待时间老化后的优先级
+func (m *ComfyUIMock) effectivePriority(prompt *PromptInfo, now time.Time) int {
+	if m.cfg.PriorityAging <= 0 {
+		return prompt.Priority
+	}
+	return prompt.Priority + int(now.Sub(prompt.QueuedAt)/m.cfg.PriorityAging)
+}
+
+// usesPriority 只有使用了优先级时 /queue 才返回 priorities，默认响应与 ComfyUI 保持一致，调用方需持有锁
+func (m *ComfyUIMock) usesPriority() bool {
+	if m.cfg.PriorityAging > 0 {
+		return true
+	}
+	for _, prompt := range m.pending {
+		if prompt.Priority != 0 {
+			return true
+		}
+	}
+	return false
+}
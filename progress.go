@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// nodeProgress 是 progress_state 消息中单个节点的状态
+type nodeProgress struct {
+	value float64
+	max   float64
+	state string
+}
+
+// sendExecuting 发送 executing 消息，新版本同时发送汇总所有已开始节点状态的 progress_state。
+// 只由执行 prompt 的 goroutine 调用
+func (m *ComfyUIMock) sendExecuting(prompt *PromptInfo, nodeID string) {
+	m.mu.Lock()
+	prompt.node = nodeID
+	m.mu.Unlock()
+	m.ws.send(prompt.ClientID, "executing", gin.H{"node": nodeID, "display_node": nodeID, "prompt_id": prompt.PromptID})
+	m.updateProgressState(prompt, nodeID, "running")
+}
+
+// updateProgressState 更新节点状态并发送 progress_state，之前运行中的节点视为完成，nodeID 为空时只结束运行中的节点
+func (m *ComfyUIMock) updateProgressState(prompt *PromptInfo, nodeID, state string) {
+	if !m.compat.progressState {
+		return
+	}
+	if prompt.progress == nil {
+		prompt.progress = map[string]*nodeProgress{}
+	}
+	for _, node := range prompt.progress {
+		if node.state == "running" {
+			node.state = "finished"
+			node.value = node.max
+		}
+	}
+	if nodeID != "" {
+		prompt.progress[nodeID] = &nodeProgress{max: 1, state: state}
+	}
+
+	nodes := gin.H{}
+	for id, node := range prompt.progress {
+		nodes[id] = gin.H{
+			"value":           node.value,
+			"max":             node.max,
+			"state":           node.state,
+			"node_id":         id,
+			"prompt_id":       prompt.PromptID,
+			"display_node_id": id,
+			"parent_node_id":  nil,
+			"real_node_id":    id,
+		}
+	}
+	m.ws.send(prompt.ClientID, "progress_state", gin.H{"prompt_id": prompt.PromptID, "nodes": nodes})
+}
+
+// handleProgress 返回 prompt 的完成百分比和当前节点，供测试在执行到某个进度时同步操作。
+// 百分比按已经过的模拟处理时间计算，加载模型期间为 0
+func (m *ComfyUIMock) handleProgress(c *gin.Context) {
+	prompt, exists := m.lookupPrompt(c.Param("prompt_id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prompt not found"})
+		return
+	}
+
+	percent := 0.0
+	var elapsed time.Duration
+	switch {
+	case prompt.Status == "completed":
+		percent = 100
+		elapsed = prompt.expected
+	case prompt.expected > 0 && !prompt.processingAt.IsZero():
+		end := time.Now()
+		if prompt.Status == "failed" {
+			end = prompt.FinishedAt
+		}
+		elapsed = min(end.Sub(prompt.processingAt), prompt.expected)
+		percent = math.Round(1000*elapsed.Seconds()/prompt.expected.Seconds()) / 10
+	}
+
+	response := gin.H{
+		"prompt_id":  prompt.PromptID,
+		"status":     prompt.Status,
+		"percent":    percent,
+		"node":       nil,
+		"node_type":  nil,
+		"elapsed_ms": elapsed.Milliseconds(),
+		"total_ms":   prompt.expected.Milliseconds(),
+	}
+	if prompt.node != "" && prompt.Status == "processing" {
+		node, _ := prompt.Prompt[prompt.node].(map[string]interface{})
+		response["node"] = prompt.node
+		response["node_type"] = node["class_type"]
+	}
+	c.JSON(http.StatusOK, response)
+}
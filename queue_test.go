@@ -0,0 +1,1103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testGraph 是只有一个 SaveImage 节点的最小 workflow
+var testGraph = map[string]interface{}{
+	"9": map[string]interface{}{"class_type": "SaveImage", "inputs": map[string]interface{}{"filename_prefix": "ComfyUI"}},
+}
+
+// newTestMock 按命令行参数创建 mock 并启动 HTTP 服务，目录都在测试的临时目录中，默认处理时间为 0
+func newTestMock(tb testing.TB, args ...string) (*ComfyUIMock, *httptest.Server) {
+	tb.Helper()
+	gin.SetMode(gin.TestMode)
+
+	dir := tb.TempDir()
+	defaults := []string{
+		"--min-processing", "0", "--max-processing", "0",
+		"--input-dir", dir + "/input", "--output-dir", dir + "/output",
+		"--temp-dir", dir + "/temp", "--user-dir", dir + "/user",
+	}
+	cfg := parseConfig(append(defaults, args...))
+	if err := setupDirs(cfg); err != nil {
+		tb.Fatal(err)
+	}
+	m := NewComfyUIMock(cfg)
+	if err := m.loadFixtures(); err != nil {
+		tb.Fatal(err)
+	}
+
+	r := gin.New()
+	r.Use(m.auditMiddleware())
+	r.Use(m.crashMiddleware())
+	r.POST("/prompt", m.handlePrompt)
+	r.POST("/prompt/batch", m.handlePromptBatch)
+	r.GET("/queue", m.handleQueue)
+	r.POST("/queue", m.handleQueueUpdate)
+	r.DELETE("/queue/:prompt_id", m.handleQueueDelete)
+	r.GET("/history", m.handleHistoryList)
+	r.GET("/history/:prompt_id", m.handleHistory)
+	r.POST("/history", m.handleHistoryUpdate)
+	r.POST("/interrupt", m.handleInterrupt)
+	admin := r.Group("/__mock")
+	admin.GET("/audit", m.handleAudit)
+	admin.POST("/drain", m.handleDrain)
+	admin.POST("/queue/reorder", m.handleQueueReorder)
+	admin.POST("/queue/pause", m.handleQueuePause)
+	admin.POST("/queue/resume", m.handleQueueResume)
+	admin.POST("/crash", m.handleCrash)
+	admin.POST("/stuck", m.handleStuck)
+	admin.DELETE("/stuck", m.handleStuckRelease)
+
+	// 崩溃期间的请求需要断开连接，不能使用 httptest.ResponseRecorder
+	server := httptest.NewServer(r)
+	tb.Cleanup(server.Close)
+	return m, server
+}
+
+// doJSON 发送 JSON 请求，返回状态码和响应体，连接被断开时状态码为 0，可以在其他 goroutine 中调用
+func doJSON(server *httptest.Server, method, path string, body interface{}) (int, []byte) {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	req, err := http.NewRequest(method, server.URL+path, bytes.NewReader(data))
+	if err != nil {
+		return 0, nil
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		return 0, nil
+	}
+	defer resp.Body.Close()
+	data, _ = io.ReadAll(resp.Body)
+	return resp.StatusCode, data
+}
+
+// submitPrompt 通过 /prompt 提交 testGraph，返回 prompt_id，可以在其他 goroutine 中调用
+func submitPrompt(server *httptest.Server, extraData map[string]interface{}) (string, error) {
+	status, body := doJSON(server, http.MethodPost, "/prompt", gin.H{"client_id": "test", "prompt": testGraph, "extra_data": extraData})
+	if status != http.StatusOK {
+		return "", fmt.Errorf("POST /prompt: %d %s", status, body)
+	}
+	var response struct {
+		PromptID string `json:"prompt_id"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", err
+	}
+	return response.PromptID, nil
+}
+
+func submit(tb testing.TB, server *httptest.Server, extraData map[string]interface{}) string {
+	tb.Helper()
+	promptID, err := submitPrompt(server, extraData)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return promptID
+}
+
+// promptStatus 返回 prompt 的状态，prompt 不存在时为空
+func (m *ComfyUIMock) promptStatus(promptID string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if prompt, ok := m.prompts[promptID]; ok {
+		return prompt.Status
+	}
+	return ""
+}
+
+// waitFor 轮询 cond 直到返回 true，超时时测试失败
+func waitFor(tb testing.TB, what string, cond func() bool) {
+	tb.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			tb.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestQueueConcurrentSubmit(t *testing.T) {
+	m, server := newTestMock(t)
+
+	const clients, perClient = 8, 10
+	ids := make(chan string, clients*perClient)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perClient; j++ {
+				promptID, err := submitPrompt(server, nil)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				ids <- promptID
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	numbers := map[int]bool{}
+	for promptID := range ids {
+		waitFor(t, "prompt "+promptID, func() bool { return m.promptStatus(promptID) == "completed" })
+		m.mu.Lock()
+		number := m.prompts[promptID].ID
+		m.mu.Unlock()
+		if numbers[number] {
+			t.Fatalf("queue number %d assigned twice", number)
+		}
+		numbers[number] = true
+	}
+	if len(numbers) != clients*perClient {
+		t.Fatalf("got %d prompts, want %d", len(numbers), clients*perClient)
+	}
+}
+
+func TestQueueDeleteWhileRunning(t *testing.T) {
+	m, server := newTestMock(t, "--min-processing", "100ms", "--max-processing", "100ms")
+
+	running := submit(t, server, nil)
+	waitFor(t, "first prompt to start", func() bool { return m.promptStatus(running) == "processing" })
+	deleted := []string{submit(t, server, nil), submit(t, server, nil)}
+	kept := submit(t, server, nil)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if status, body := doJSON(server, http.MethodDelete, "/queue/"+deleted[0], nil); status != http.StatusOK {
+			t.Errorf("DELETE /queue: %d %s", status, body)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if status, body := doJSON(server, http.MethodPost, "/queue", gin.H{"delete": deleted[1:]}); status != http.StatusOK {
+			t.Errorf("POST /queue: %d %s", status, body)
+		}
+	}()
+	wg.Wait()
+
+	// 执行中的 prompt 不能通过 /queue 删除
+	if status, _ := doJSON(server, http.MethodDelete, "/queue/"+running, nil); status != http.StatusNotFound {
+		t.Fatalf("DELETE running prompt: got %d, want 404", status)
+	}
+	waitFor(t, "remaining prompt", func() bool { return m.promptStatus(kept) == "completed" })
+	if status := m.promptStatus(running); status != "completed" {
+		t.Fatalf("running prompt: got %q, want completed", status)
+	}
+	for _, promptID := range deleted {
+		if status := m.promptStatus(promptID); status != "" {
+			t.Fatalf("deleted prompt %s: got %q", promptID, status)
+		}
+	}
+}
+
+func TestQueueClearRacesWorker(t *testing.T) {
+	m, server := newTestMock(t, "--min-processing", "1ms", "--max-processing", "5ms")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := submitPrompt(server, nil); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				doJSON(server, http.MethodPost, "/queue", gin.H{"clear": true})
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 所有剩下的 prompt 都要执行完，不能卡在 pending 或 processing
+	waitFor(t, "queue to drain", func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return len(m.pending) == 0 && m.runningTask == nil
+	})
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for promptID, prompt := range m.prompts {
+		if prompt.Status != "completed" {
+			t.Errorf("prompt %s: got %q, want completed", promptID, prompt.Status)
+		}
+	}
+}
+
+func TestCrashRequeuesRunningPrompt(t *testing.T) {
+	m, server := newTestMock(t, "--min-processing", "200ms", "--max-processing", "200ms")
+
+	first := submit(t, server, nil)
+	second := submit(t, server, nil)
+	waitFor(t, "first prompt to start", func() bool { return m.promptStatus(first) == "processing" })
+
+	if status, body := doJSON(server, http.MethodPost, "/__mock/crash", gin.H{"seconds": 0.1, "keep_queue": true}); status != http.StatusOK {
+		t.Fatalf("POST /__mock/crash: %d %s", status, body)
+	}
+	m.mu.Lock()
+	if m.runningTask != nil || len(m.pending) != 2 || m.pending[0].PromptID != first {
+		t.Errorf("after crash: running %v, %d pending, want the interrupted prompt first", m.runningTask != nil, len(m.pending))
+	}
+	m.mu.Unlock()
+
+	for _, promptID := range []string{first, second} {
+		waitFor(t, "prompt "+promptID, func() bool { return m.promptStatus(promptID) == "completed" })
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.prompts[first].FinishedAt.After(m.prompts[second].FinishedAt) {
+		t.Fatal("interrupted prompt should run again before the rest of the queue")
+	}
+}
+
+func TestCrashDropsQueue(t *testing.T) {
+	m, server := newTestMock(t, "--min-processing", "200ms", "--max-processing", "200ms")
+
+	prompts := []string{submit(t, server, nil), submit(t, server, nil)}
+	waitFor(t, "first prompt to start", func() bool { return m.promptStatus(prompts[0]) == "processing" })
+
+	// 崩溃与提交同时发生，崩溃后队列为空或只有恢复后提交的 prompt
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		doJSON(server, http.MethodPost, "/__mock/crash", gin.H{"seconds": 0.1, "keep_queue": false})
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			doJSON(server, http.MethodPost, "/prompt", gin.H{"prompt": testGraph})
+		}
+	}()
+	wg.Wait()
+
+	for _, promptID := range prompts {
+		if status := m.promptStatus(promptID); status != "" {
+			t.Fatalf("prompt %s survived the crash: %q", promptID, status)
+		}
+	}
+	waitFor(t, "queue to drain", func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return len(m.pending) == 0 && m.runningTask == nil
+	})
+}
+
+func TestPauseHoldsRunningPrompt(t *testing.T) {
+	m, server := newTestMock(t, "--min-processing", "20ms", "--max-processing", "20ms")
+
+	doJSON(server, http.MethodPost, "/__mock/queue/pause", nil)
+	promptID := submit(t, server, nil)
+	time.Sleep(100 * time.Millisecond)
+	if status := m.promptStatus(promptID); status != "pending" {
+		t.Fatalf("paused queue: got %q, want pending", status)
+	}
+
+	doJSON(server, http.MethodPost, "/__mock/queue/resume", nil)
+	waitFor(t, fmt.Sprintf("prompt %s", promptID), func() bool { return m.promptStatus(promptID) == "completed" })
+}
+
+func TestVRAMReleasedAfterPrompt(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		t.Run(fmt.Sprintf("keep=%v", keep), func(t *testing.T) {
+			m, server := newTestMock(t, "--vram-total", "1000", "--vram-per-prompt", "600", fmt.Sprintf("--vram-keep-models=%v", keep))
+			first := submit(t, server, nil)
+			waitFor(t, "first prompt", func() bool { return m.promptStatus(first) == "completed" })
+			second := submit(t, server, nil)
+			waitFor(t, "second prompt", func() bool { status := m.promptStatus(second); return status == "completed" || status == "failed" })
+
+			want := "completed"
+			if keep {
+				want = "failed"
+			}
+			if status := m.promptStatus(second); status != want {
+				t.Fatalf("second prompt: got %q, want %q", status, want)
+			}
+		})
+	}
+}
+
+// pendingOrder 通过 GET /queue 返回等待中的 prompt_id 和队列编号，按执行顺序排列
+func pendingOrder(t *testing.T, server *httptest.Server) ([]string, []int) {
+	t.Helper()
+	status, body := doJSON(server, http.MethodGet, "/queue", nil)
+	if status != http.StatusOK {
+		t.Fatalf("GET /queue: %d %s", status, body)
+	}
+	var queue struct {
+		Pending [][]interface{} `json:"queue_pending"`
+	}
+	if err := json.Unmarshal(body, &queue); err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(queue.Pending))
+	numbers := make([]int, len(queue.Pending))
+	for i, item := range queue.Pending {
+		numbers[i] = int(item[0].(float64))
+		ids[i] = item[1].(string)
+	}
+	return ids, numbers
+}
+
+func TestReorderOverridesPriority(t *testing.T) {
+	_, server := newTestMock(t)
+	doJSON(server, http.MethodPost, "/__mock/queue/pause", nil)
+
+	high := submit(t, server, map[string]interface{}{"priority": 5})
+	low1 := submit(t, server, nil)
+	low2 := submit(t, server, nil)
+
+	steps := []struct {
+		promptID, position string
+		want               []string
+	}{
+		{"", "", []string{high, low1, low2}},
+		{low2, "front", []string{low2, high, low1}},
+		{high, "back", []string{low2, low1, high}},
+		{low1, "front", []string{low1, low2, high}},
+		{low2, "front", []string{low2, low1, high}},
+	}
+	for _, step := range steps {
+		if step.promptID != "" {
+			status, body := doJSON(server, http.MethodPost, "/__mock/queue/reorder", gin.H{"prompt_id": step.promptID, "position": step.position})
+			if status != http.StatusOK {
+				t.Fatalf("reorder %s: %d %s", step.position, status, body)
+			}
+		}
+		ids, numbers := pendingOrder(t, server)
+		if fmt.Sprint(ids) != fmt.Sprint(step.want) {
+			t.Fatalf("after moving %s to %s: got %v, want %v", step.promptID, step.position, ids, step.want)
+		}
+		for _, number := range numbers {
+			if number <= 0 {
+				t.Fatalf("queue number %d after reorder, want > 0", number)
+			}
+		}
+	}
+}
+
+// historyOrder 通过 GET /history 按响应中的顺序返回 prompt_id
+func historyOrder(t *testing.T, server *httptest.Server, query string) []string {
+	t.Helper()
+	status, body := doJSON(server, http.MethodGet, "/history"+query, nil)
+	if status != http.StatusOK {
+		t.Fatalf("GET /history%s: %d %s", query, status, body)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if _, err := decoder.Token(); err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, key.(string))
+		var entry json.RawMessage
+		if err := decoder.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ids
+}
+
+func TestHistoryListNewestFirst(t *testing.T) {
+	m, server := newTestMock(t)
+
+	var finished []string
+	for i := 0; i < 6; i++ {
+		promptID := submit(t, server, nil)
+		waitFor(t, "prompt "+promptID, func() bool { return m.promptStatus(promptID) == "completed" })
+		finished = append([]string{promptID}, finished...)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	if ids := historyOrder(t, server, ""); fmt.Sprint(ids) != fmt.Sprint(finished) {
+		t.Fatalf("GET /history: got %v, want %v", ids, finished)
+	}
+	if ids := historyOrder(t, server, "?offset=2&max_items=3"); fmt.Sprint(ids) != fmt.Sprint(finished[2:5]) {
+		t.Fatalf("GET /history page: got %v, want %v", ids, finished[2:5])
+	}
+}
+
+func TestSaveImageOutputsKeyedByNode(t *testing.T) {
+	m, server := newTestMock(t)
+
+	graph := map[string]interface{}{
+		"3":  map[string]interface{}{"class_type": "SaveImage", "inputs": map[string]interface{}{"filename_prefix": "a"}},
+		"12": map[string]interface{}{"class_type": "SaveImage", "inputs": map[string]interface{}{"filename_prefix": "b"}},
+	}
+	status, body := doJSON(server, http.MethodPost, "/prompt", gin.H{"prompt": graph})
+	if status != http.StatusOK {
+		t.Fatalf("POST /prompt: %d %s", status, body)
+	}
+	var response struct {
+		PromptID string `json:"prompt_id"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "prompt", func() bool { return m.promptStatus(response.PromptID) == "completed" })
+
+	m.mu.Lock()
+	outputs := m.prompts[response.PromptID].Output
+	m.mu.Unlock()
+	if len(outputs) != 2 || outputs["3"] == nil || outputs["12"] == nil {
+		t.Fatalf("outputs: got %v, want nodes 3 and 12", outputs)
+	}
+	filenames := map[string]bool{}
+	for _, nodeID := range []string{"3", "12"} {
+		record := outputs[nodeID].(map[string]interface{})["images"].([]map[string]interface{})[0]
+		filenames[record["filename"].(string)] = true
+	}
+	if len(filenames) != 2 {
+		t.Fatalf("SaveImage nodes share a filename: %v", filenames)
+	}
+}
+
+// memObjectStore 记录上传的对象
+type memObjectStore struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (s *memObjectStore) Put(key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, key)
+	return nil
+}
+
+func (s *memObjectStore) Get(key string) (*http.Response, error) { return nil, fmt.Errorf("not found") }
+
+func (s *memObjectStore) PresignGet(key string, expires time.Duration) (string, error) {
+	return "", fmt.Errorf("not supported")
+}
+
+func TestUploadOutputsAnyRecordShape(t *testing.T) {
+	m, _ := newTestMock(t)
+	store := &memObjectStore{}
+	m.objects = store
+
+	for _, name := range []string{"a.png", "b.png"} {
+		if err := writeFile(filepath.Join(outputDir, name), []byte("png")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 插件生成器、脚本和导入的状态中的记录是 []interface{}
+	m.uploadOutputs(map[string]interface{}{
+		"9":  map[string]interface{}{"images": []map[string]interface{}{fileRecord("a.png", "", "output")}},
+		"12": map[string]interface{}{"images": []interface{}{map[string]interface{}{"filename": "b.png", "subfolder": "", "type": "output"}}},
+	})
+	sort.Strings(store.keys)
+	if fmt.Sprint(store.keys) != "[output/a.png output/b.png]" {
+		t.Fatalf("uploaded %v, want both outputs", store.keys)
+	}
+}
+
+// memStateBackend 是多个实例共享的内存存储，语义与 redisStore 一致
+type memStateBackend struct {
+	mu       sync.Mutex
+	prompts  map[string][]byte
+	claims   map[string]string
+	counters map[string]int
+}
+
+// memStateStore 是一个实例对 memStateBackend 的连接
+type memStateStore struct {
+	backend *memStateBackend
+	owner   string
+}
+
+func newMemStateStores(n int) []*memStateStore {
+	backend := &memStateBackend{prompts: map[string][]byte{}, claims: map[string]string{}, counters: map[string]int{}}
+	stores := make([]*memStateStore, n)
+	for i := range stores {
+		stores[i] = &memStateStore{backend: backend, owner: strconv.Itoa(i)}
+	}
+	return stores
+}
+
+func (s *memStateStore) SavePrompt(promptID string, data []byte) error {
+	s.backend.mu.Lock()
+	defer s.backend.mu.Unlock()
+	s.backend.prompts[promptID] = data
+	return nil
+}
+
+func (s *memStateStore) decode(data []byte) (*PromptInfo, error) {
+	var prompt PromptInfo
+	if err := json.Unmarshal(data, &prompt); err != nil {
+		return nil, err
+	}
+	return &prompt, nil
+}
+
+func (s *memStateStore) LoadPrompt(promptID string) (*PromptInfo, error) {
+	s.backend.mu.Lock()
+	defer s.backend.mu.Unlock()
+	data, ok := s.backend.prompts[promptID]
+	if !ok {
+		return nil, nil
+	}
+	return s.decode(data)
+}
+
+func (s *memStateStore) ListPrompts() ([]*PromptInfo, error) {
+	s.backend.mu.Lock()
+	defer s.backend.mu.Unlock()
+	prompts := []*PromptInfo{}
+	for _, data := range s.backend.prompts {
+		prompt, err := s.decode(data)
+		if err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, prompt)
+	}
+	return prompts, nil
+}
+
+func (s *memStateStore) DeletePrompt(promptID string) error {
+	s.backend.mu.Lock()
+	defer s.backend.mu.Unlock()
+	delete(s.backend.prompts, promptID)
+	delete(s.backend.claims, promptID)
+	return nil
+}
+
+func (s *memStateStore) DeletePending(promptID string) (bool, error) {
+	s.backend.mu.Lock()
+	defer s.backend.mu.Unlock()
+	data, ok := s.backend.prompts[promptID]
+	if !ok {
+		return false, nil
+	}
+	if owner, claimed := s.backend.claims[promptID]; claimed && owner != s.owner {
+		return false, nil
+	}
+	prompt, err := s.decode(data)
+	if err != nil || prompt.Status != "pending" {
+		return false, err
+	}
+	delete(s.backend.prompts, promptID)
+	delete(s.backend.claims, promptID)
+	return true, nil
+}
+
+func (s *memStateStore) ClaimPrompt(promptID string) (bool, error) {
+	s.backend.mu.Lock()
+	defer s.backend.mu.Unlock()
+	if _, ok := s.backend.prompts[promptID]; !ok {
+		return false, nil
+	}
+	if owner, claimed := s.backend.claims[promptID]; claimed && owner != s.owner {
+		return false, nil
+	}
+	s.backend.claims[promptID] = s.owner
+	return true, nil
+}
+
+func (s *memStateStore) NextQueueID(clientID string) (int, error) {
+	s.backend.mu.Lock()
+	defer s.backend.mu.Unlock()
+	s.backend.counters[clientID]++
+	return s.backend.counters[clientID], nil
+}
+
+// sharedReplicas 创建 n 个共享同一个存储的实例
+func sharedReplicas(t *testing.T, n int, args ...string) ([]*ComfyUIMock, []*httptest.Server) {
+	mocks := make([]*ComfyUIMock, n)
+	servers := make([]*httptest.Server, n)
+	for i, store := range newMemStateStores(n) {
+		mocks[i], servers[i] = newTestMock(t, args...)
+		mocks[i].useStore(store)
+	}
+	return mocks, servers
+}
+
+func TestSharedQueueNumbersAcrossReplicas(t *testing.T) {
+	mocks, servers := sharedReplicas(t, 2)
+	for _, server := range servers {
+		doJSON(server, http.MethodPost, "/__mock/queue/pause", nil)
+	}
+
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if _, err := submitPrompt(server, nil); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	numbers := map[int]bool{}
+	for _, m := range mocks {
+		m.mu.Lock()
+		for _, prompt := range m.prompts {
+			if numbers[prompt.ID] {
+				t.Errorf("queue number %d assigned twice", prompt.ID)
+			}
+			numbers[prompt.ID] = true
+		}
+		m.mu.Unlock()
+	}
+	if len(numbers) != 40 {
+		t.Fatalf("got %d queue numbers, want 40", len(numbers))
+	}
+}
+
+func TestSharedQueueDeleteFromOtherReplica(t *testing.T) {
+	mocks, servers := sharedReplicas(t, 2)
+	doJSON(servers[0], http.MethodPost, "/__mock/queue/pause", nil)
+	doJSON(servers[1], http.MethodPost, "/__mock/queue/pause", nil)
+
+	deleted := submit(t, servers[0], nil)
+	cleared := submit(t, servers[0], nil)
+	if status, body := doJSON(servers[1], http.MethodDelete, "/queue/"+deleted, nil); status != http.StatusOK {
+		t.Fatalf("DELETE /queue on the other replica: %d %s", status, body)
+	}
+	if status, body := doJSON(servers[1], http.MethodPost, "/queue", gin.H{"clear": true}); status != http.StatusOK {
+		t.Fatalf("POST /queue clear on the other replica: %d %s", status, body)
+	}
+	if ids, _ := pendingOrder(t, servers[0]); len(ids) != 0 {
+		t.Fatalf("owner replica still lists %v", ids)
+	}
+
+	kept := submit(t, servers[0], nil)
+	doJSON(servers[0], http.MethodPost, "/__mock/queue/resume", nil)
+	waitFor(t, "remaining prompt", func() bool { return mocks[0].promptStatus(kept) == "completed" })
+	for _, promptID := range []string{deleted, cleared} {
+		if _, exists := mocks[0].lookupPrompt(promptID); exists {
+			t.Fatalf("deleted prompt %s still exists", promptID)
+		}
+	}
+}
+
+func TestSharedQueueRunsPromptsOfStoppedReplica(t *testing.T) {
+	mocks, servers := sharedReplicas(t, 2)
+	// 暂停的实例不再执行 prompt，与实例退出相同
+	doJSON(servers[0], http.MethodPost, "/__mock/queue/pause", nil)
+
+	promptID := submit(t, servers[0], nil)
+	waitFor(t, "other replica to run the prompt", func() bool { return mocks[1].promptStatus(promptID) == "completed" })
+
+	status, body := doJSON(servers[0], http.MethodGet, "/history/"+promptID, nil)
+	if status != http.StatusOK || !bytes.Contains(body, []byte(`"status_str":"success"`)) {
+		t.Fatalf("GET /history on the owner replica: %d %s", status, body)
+	}
+	doJSON(servers[0], http.MethodPost, "/__mock/queue/resume", nil)
+	waitFor(t, "owner replica to drop its copy", func() bool { return mocks[0].promptStatus(promptID) == "" })
+}
+
+func TestInterruptAndHistoryDeleteAudited(t *testing.T) {
+	m, server := newTestMock(t, "--min-processing", "10s", "--max-processing", "10s")
+
+	interrupted := submit(t, server, nil)
+	waitFor(t, "prompt to start", func() bool { return m.promptStatus(interrupted) == "processing" })
+	// prompt_id 不是执行中的 prompt 时不中断
+	doJSON(server, http.MethodPost, "/interrupt", gin.H{"prompt_id": "other"})
+	if status := m.promptStatus(interrupted); status != "processing" {
+		t.Fatalf("interrupt for another prompt: got %q, want processing", status)
+	}
+	if status, body := doJSON(server, http.MethodPost, "/interrupt", nil); status != http.StatusOK {
+		t.Fatalf("POST /interrupt: %d %s", status, body)
+	}
+	if status := m.promptStatus(interrupted); status != "failed" {
+		t.Fatalf("interrupted prompt: got %q, want failed", status)
+	}
+
+	if status, body := doJSON(server, http.MethodPost, "/history", gin.H{"delete": []string{interrupted}}); status != http.StatusOK {
+		t.Fatalf("POST /history: %d %s", status, body)
+	}
+	if status := m.promptStatus(interrupted); status != "" {
+		t.Fatalf("deleted history entry: got %q", status)
+	}
+	doJSON(server, http.MethodPost, "/history", gin.H{"clear": true})
+
+	status, body := doJSON(server, http.MethodGet, "/__mock/audit", nil)
+	if status != http.StatusOK {
+		t.Fatalf("GET /__mock/audit: %d %s", status, body)
+	}
+	var audit struct {
+		Entries []auditEntry `json:"entries"`
+	}
+	if err := json.Unmarshal(body, &audit); err != nil {
+		t.Fatal(err)
+	}
+	actions := []string{}
+	for _, entry := range audit.Entries {
+		actions = append(actions, entry.Action)
+	}
+	want := "[submit interrupt interrupt history_delete history_clear]"
+	if fmt.Sprint(actions) != want {
+		t.Fatalf("audit actions: got %v, want %s", actions, want)
+	}
+	if deleted := audit.Entries[3].Details["deleted"]; fmt.Sprint(deleted) != fmt.Sprintf("[%s]", interrupted) {
+		t.Fatalf("history_delete details: got %v", deleted)
+	}
+}
+
+func TestScriptHookStepLimit(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "hooks.star")
+	source := "def on_complete(prompt):\n    n = 0\n    for i in range(1000000000):\n        n += 1\n    return None\n"
+	if err := os.WriteFile(script, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, server := newTestMock(t, "--script", script)
+
+	promptID := submit(t, server, nil)
+	// 钩子执行期间其他请求不能被阻塞
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	if status, body := doJSON(server, http.MethodGet, "/queue", nil); status != http.StatusOK {
+		t.Fatalf("GET /queue: %d %s", status, body)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("GET /queue took %s while the hook was running", elapsed)
+	}
+
+	waitFor(t, "hook to be stopped", func() bool { return m.promptStatus(promptID) == "failed" })
+	m.mu.Lock()
+	message, _ := m.prompts[promptID].Error["exception_message"].(string)
+	m.mu.Unlock()
+	if !strings.Contains(message, "Starlark computation cancelled") {
+		t.Fatalf("exception_message: got %q, want the hook to be cancelled", message)
+	}
+}
+
+func TestClientQuotaConcurrentSubmit(t *testing.T) {
+	m, server := newTestMock(t)
+	quotas, err := newClientQuotas(3, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.quotas = quotas
+	doJSON(server, http.MethodPost, "/__mock/queue/pause", nil)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	counts := map[int]int{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, _ := doJSON(server, http.MethodPost, "/prompt", gin.H{"client_id": "quota", "prompt": testGraph})
+			mu.Lock()
+			counts[status]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if counts[http.StatusOK] != 3 || counts[http.StatusTooManyRequests] != 17 {
+		t.Fatalf("responses: got %v, want 3 accepted and 17 rejected", counts)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.pending) != 3 {
+		t.Fatalf("queued prompts: got %d, want 3", len(m.pending))
+	}
+}
+
+func TestDrainSettingsChangeWhileRejecting(t *testing.T) {
+	_, server := newTestMock(t)
+	doJSON(server, http.MethodPost, "/__mock/drain", gin.H{"status": 503})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			doJSON(server, http.MethodPost, "/__mock/drain", gin.H{"status": 503 - i%2*74, "retry_after": i})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if status, _ := doJSON(server, http.MethodPost, "/prompt", gin.H{"prompt": testGraph}); status != http.StatusServiceUnavailable && status != http.StatusTooManyRequests {
+				t.Errorf("POST /prompt while draining: got %d", status)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestStuckConcurrentInstall(t *testing.T) {
+	m, server := newTestMock(t)
+
+	statuses := make([]int, 10)
+	var wg sync.WaitGroup
+	for i := range statuses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i], _ = doJSON(server, http.MethodPost, "/__mock/stuck", gin.H{})
+		}()
+	}
+	wg.Wait()
+	t.Cleanup(func() { doJSON(server, http.MethodDelete, "/__mock/stuck", nil) })
+
+	installed := 0
+	for _, status := range statuses {
+		switch status {
+		case http.StatusOK:
+			installed++
+		case http.StatusConflict:
+		default:
+			t.Fatalf("POST /__mock/stuck: got %d", status)
+		}
+	}
+	if installed != 1 {
+		t.Fatalf("installed %d stuck tasks, want 1", installed)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stuck := 0
+	for _, prompt := range m.prompts {
+		if prompt.stuck {
+			stuck++
+		}
+	}
+	if stuck != 1 {
+		t.Fatalf("%d stuck prompts in the queue, want 1", stuck)
+	}
+}
+
+// pausedMock 返回暂停执行的 mock，队列中有 n 个 prompt，用于测量队列操作本身的开销
+func pausedMock(b *testing.B, n int) (*ComfyUIMock, http.Handler) {
+	m, server := newTestMock(b, "--in-memory")
+	m.mu.Lock()
+	m.resumed = make(chan struct{})
+	for i := 0; i < n; i++ {
+		m.newPrompt(context.Background(), "bench", testGraph, nil, i%5, 0, nil)
+	}
+	m.mu.Unlock()
+	return m, server.Config.Handler
+}
+
+func BenchmarkEnqueue(b *testing.B) {
+	m, _ := pausedMock(b, 0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.enqueuePrompt(context.Background(), "bench", testGraph, nil, 0)
+	}
+}
+
+func BenchmarkSubmitHTTP(b *testing.B) {
+	_, handler := pausedMock(b, 0)
+	data, _ := json.Marshal(gin.H{"client_id": "bench", "prompt": testGraph})
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req := httptest.NewRequest(http.MethodPost, "/prompt", bytes.NewReader(data))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				b.Errorf("POST /prompt: %d %s", w.Code, w.Body.String())
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkPendingPrompts(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			m, _ := pausedMock(b, n)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.mu.Lock()
+				m.pendingPrompts()
+				m.mu.Unlock()
+			}
+		})
+	}
+}
+
+func BenchmarkGetQueue(b *testing.B) {
+	for _, n := range []int{100, 1000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			_, handler := pausedMock(b, n)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/queue", nil))
+			}
+		})
+	}
+}
+
+// BenchmarkWorkerThroughput 测量处理时间为 0 时 worker 每秒能执行完的 prompt 数
+func BenchmarkWorkerThroughput(b *testing.B) {
+	m, _ := newTestMock(b, "--in-memory")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.enqueuePrompt(context.Background(), "bench", testGraph, nil, 0)
+	}
+	waitFor(b, "queue to drain", func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return len(m.pending) == 0 && m.runningTask == nil
+	})
+	b.StopTimer()
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "prompts/s")
+}
+
+func TestInstanceProfileRejectsProcessFlags(t *testing.T) {
+	cfg := parseConfig([]string{"--instances", "2", "--instance-profile", "1:--latency=10ms --output-format=jpeg"})
+	err := runCluster(cfg, nil)
+	if err == nil || !strings.Contains(err.Error(), "--output-format") {
+		t.Fatalf("runCluster: got %v, want an error naming --output-format", err)
+	}
+}
+
+func TestBuildOutputsWithoutLock(t *testing.T) {
+	building, release := make(chan struct{}), make(chan struct{})
+	RegisterOutputGenerator("test-blocking", OutputGeneratorFunc(func(graph map[string]interface{}, prompt *PromptInfo) (map[string]interface{}, []OutputFile, error) {
+		close(building)
+		<-release
+		return nil, nil, nil
+	}))
+	if err := selectOutputGenerator("test-blocking"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { selectOutputGenerator("") })
+
+	m, server := newTestMock(t)
+	promptID := submit(t, server, nil)
+	<-building
+
+	done := make(chan int)
+	go func() {
+		status, _ := doJSON(server, http.MethodGet, "/queue", nil)
+		done <- status
+	}()
+	select {
+	case status := <-done:
+		if status != http.StatusOK {
+			t.Fatalf("GET /queue: got %d", status)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("GET /queue blocked while outputs were being built")
+	}
+	close(release)
+	waitFor(t, "prompt to complete", func() bool { return m.promptStatus(promptID) == "completed" })
+}
+
+func TestDiskQuotaTracksWritesAndReportsNodePath(t *testing.T) {
+	m, _ := newTestMock(t, "--disk-quota", "1")
+	if m.diskFull(0) {
+		t.Fatal("empty directories reported as full")
+	}
+	if err := writeFile(filepath.Join(inputDir, "big.bin"), make([]byte, 2*mib)); err != nil {
+		t.Fatal(err)
+	}
+	if !m.diskFull(0) {
+		t.Fatal("quota not exceeded after writing 2 MiB")
+	}
+
+	prompt := &PromptInfo{PromptID: "0123456789abcdef", Prompt: map[string]interface{}{
+		"12": map[string]interface{}{"class_type": "PreviewImage", "inputs": map[string]interface{}{}},
+	}}
+	nodeID, path := m.diskFullNode(prompt)
+	if want := filepath.Join(tempDir, nodeFileName("preview", prompt, "12", promptExt(prompt))); nodeID != "12" || path != want {
+		t.Fatalf("diskFullNode: got %q %q, want %q %q", nodeID, path, "12", want)
+	}
+
+	if _, err := cleanupDir(inputDir, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if m.diskFull(0) {
+		t.Fatal("quota still exceeded after the janitor removed the file")
+	}
+}
+
+func TestRecorderSkipsStreamingBodies(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := newRecorder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(rec.middleware())
+	r.GET("/events", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		for i := 0; i < 100; i++ {
+			io.WriteString(c.Writer, "event: status\ndata: {}\n\n")
+		}
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/events", nil))
+	rec.file.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("got %d cassettes, want 1", len(files))
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entry["response_body"]; ok || entry["streaming"] != true {
+		t.Fatalf("SSE response recorded as %v", entry)
+	}
+}
+
+func TestImageScaleToTotalPixelsZeroArea(t *testing.T) {
+	graph := map[string]interface{}{
+		"1": map[string]interface{}{"class_type": "EmptyLatentImage", "inputs": map[string]interface{}{"width": 8.0, "height": 8.0}},
+		"2": map[string]interface{}{"class_type": "LatentUpscaleBy", "inputs": map[string]interface{}{"samples": []interface{}{"1", 0.0}, "scale_by": 0.1}},
+		"3": map[string]interface{}{"class_type": "ImageScaleToTotalPixels", "inputs": map[string]interface{}{"image": []interface{}{"2", 0.0}, "megapixels": 1.0}},
+	}
+	if width, height, ok := nodeDimensions(graph, "3", 0); ok {
+		t.Fatalf("nodeDimensions: got %dx%d from a zero-area input", width, height)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// errNoSpace 与 Python 的 OSError 格式一致
+const errNoSpace = "[Errno 28] No space left on device"
+
+// diskMeter 记录 input、output 和 temp 目录中文件的总大小，in-memory 模式下的文件不计入。
+// 第一次使用时遍历目录，之后随上传、输出和清理更新，检查配额时不需要遍历目录
+type diskMeter struct {
+	mu    sync.Mutex
+	used  int64
+	known bool
+}
+
+var disk = &diskMeter{}
+
+// usage 返回当前的总大小，还没有统计过时遍历目录
+func (d *diskMeter) usage() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.known {
+		d.used = walkDiskUsage()
+		d.known = true
+	}
+	return d.used
+}
+
+// add 记录文件大小的变化，还没有统计过时忽略，之后遍历目录时会计入
+func (d *diskMeter) add(delta int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.known {
+		d.used += delta
+	}
+}
+
+// reset 在目录变化无法逐个统计时丢弃记录，下次使用时重新遍历目录
+func (d *diskMeter) reset() {
+	d.mu.Lock()
+	d.known = false
+	d.mu.Unlock()
+}
+
+// track 调用 write 写入 path，并记录 path 大小的变化
+func (d *diskMeter) track(path string, write func() error) error {
+	before := fileSize(path)
+	err := write()
+	d.add(fileSize(path) - before)
+	return err
+}
+
+// fileSize 返回文件大小，文件不存在时为 0
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// walkDiskUsage 遍历 input、output 和 temp 目录，返回文件的总大小
+func walkDiskUsage() int64 {
+	var used int64
+	for _, dir := range []string{inputDir, outputDir, tempDir} {
+		filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return nil
+			}
+			if info, err := entry.Info(); err == nil {
+				used += info.Size()
+			}
+			return nil
+		})
+	}
+	return used
+}
+
+// diskFull 判断写入 size 字节后是否超过 --disk-quota
+func (m *ComfyUIMock) diskFull(size int64) bool {
+	if m.cfg.DiskQuotaMB <= 0 {
+		return false
+	}
+	return disk.usage()+size > int64(m.cfg.DiskQuotaMB*mib)
+}
+
+// noSpaceError 返回写入 path 时的 OSError 信息
+func noSpaceError(path string) string {
+	return fmt.Sprintf("%s: '%s'", errNoSpace, path)
+}
+
+// diskFullNode 在磁盘配额已用完时返回第一个会写入文件的输出节点，没有时 nodeID 为空
+func (m *ComfyUIMock) diskFullNode(prompt *PromptInfo) (nodeID, path string) {
+	if !m.diskFull(0) {
+		return "", ""
+	}
+	for _, id := range sortedNodeIDs(prompt.Prompt) {
+		node, _ := prompt.Prompt[id].(map[string]interface{})
+		classType, _ := node["class_type"].(string)
+		if classType == "SaveImageWebsocket" || !m.producesOutput(prompt.Prompt, id) {
+			continue
+		}
+		// 文本节点不写入文件
+		if classType == "ShowText|pysssss" || classType == "PreviewAny" {
+			continue
+		}
+		return id, nodeOutputPath(prompt, id, node)
+	}
+	return "", ""
+}
+
+// nodeOutputPath 返回输出节点会写入的文件路径，与各节点的输出生成器一致
+func nodeOutputPath(prompt *PromptInfo, nodeID string, node map[string]interface{}) string {
+	classType, _ := node["class_type"].(string)
+	switch classType {
+	case "SaveImage":
+		index := 0
+		for i, id := range findNodes(prompt.Prompt, "SaveImage") {
+			if id == nodeID {
+				index = i
+			}
+		}
+		return filepath.Join(outputDir, saveImageName(prompt, index, nodeID))
+	case "PreviewImage":
+		return filepath.Join(tempDir, nodeFileName("preview", prompt, nodeID, promptExt(prompt)))
+	case "SaveLatent":
+		return filepath.Join(outputDir, "latents", nodeFileName("latent", prompt, nodeID, ".latent"))
+	case "SaveAudio":
+		return filepath.Join(outputDir, "audio", nodeFileName("audio", prompt, nodeID, ".wav"))
+	case "PreviewAudio":
+		return filepath.Join(tempDir, "audio", nodeFileName("audio", prompt, nodeID, ".wav"))
+	case "ADE_AnimateDiffCombine":
+		return filepath.Join(outputDir, nodeFileName("animatediff", prompt, nodeID, ".gif"))
+	case "VHS_VideoCombine":
+		inputs, _ := node["inputs"].(map[string]interface{})
+		if _, _, _, path, err := videoCombineTarget(inputs); err == nil {
+			return path
+		}
+	}
+	// --lenient 下其他终端节点写入回显图片
+	return filepath.Join(outputDir, nodeFileName("echo", prompt, nodeID, promptExt(prompt)))
+}
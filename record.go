@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recorder 将每个会话的所有流量按时间顺序写入 JSON Lines 文件
+type recorder struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func newRecorder(dir string) (*recorder, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("创建录制目录失败: %w", err)
+	}
+
+	name := fmt.Sprintf("session-%s.jsonl", time.Now().Format("20060102-150405"))
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("创建录制文件失败: %w", err)
+	}
+
+	return &recorder{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (r *recorder) record(entry map[string]interface{}) {
+	if r == nil {
+		return
+	}
+
+	entry["time"] = time.Now().Format(time.RFC3339Nano)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(entry); err != nil {
+		fmt.Printf("写入录制文件失败: %v\n", err)
+	}
+}
+
+// setBody 文本内容直接记录，二进制内容以 base64 记录
+func setBody(entry map[string]interface{}, key string, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+	if utf8.Valid(body) {
+		entry[key] = string(body)
+		return
+	}
+	entry[key+"_base64"] = base64.StdEncoding.EncodeToString(body)
+}
+
+// recordingWriter 缓存响应体用于录制。/events 等流式响应不缓存，否则长连接的缓存会无限增长，
+// 其中的事件已经由 wsHub 以 ws_out 记录
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// streaming 判断响应是否为 SSE 流
+func (w *recordingWriter) streaming() bool {
+	return strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	if !w.streaming() {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	if !w.streaming() {
+		w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// middleware 记录每个 HTTP 请求和响应
+func (r *recorder) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		start := time.Now()
+
+		var requestBody []byte
+		tooLarge := false
+		if c.Request.Body != nil {
+			var err error
+			// 分块上传的请求体超过 --max-upload-size 时直接返回 413 并记录，不能把截断的请求体交给 handler
+			requestBody, err = io.ReadAll(c.Request.Body)
+			tooLarge = abortTooLarge(c, err)
+			c.Request.Body = io.NopCloser(bytes.NewReader(requestBody))
+		}
+
+		if !tooLarge {
+			c.Next()
+		}
+
+		entry := map[string]interface{}{
+			"kind":             "http",
+			"method":           c.Request.Method,
+			"path":             c.Request.URL.Path,
+			"query":            c.Request.URL.RawQuery,
+			"client_ip":        c.ClientIP(),
+			"request_headers":  c.Request.Header,
+			"status":           writer.Status(),
+			"response_headers": writer.Header(),
+			"duration_ms":      time.Since(start).Milliseconds(),
+		}
+		setBody(entry, "request_body", requestBody)
+		if writer.streaming() {
+			entry["streaming"] = true
+		}
+		setBody(entry, "response_body", writer.body.Bytes())
+		r.record(entry)
+	}
+}
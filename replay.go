@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+type recordedEntry struct {
+	Time               time.Time           `json:"time"`
+	Kind               string              `json:"kind"`
+	SID                string              `json:"sid"`
+	Method             string              `json:"method"`
+	Path               string              `json:"path"`
+	Query              string              `json:"query"`
+	Status             int                 `json:"status"`
+	ResponseHeaders    map[string][]string `json:"response_headers"`
+	ResponseBody       string              `json:"response_body"`
+	ResponseBodyBase64 string              `json:"response_body_base64"`
+	Message            json.RawMessage     `json:"message"`
+	DataBase64         string              `json:"data_base64"`
+	used               bool
+}
+
+func (e *recordedEntry) responseBody() []byte {
+	if e.ResponseBodyBase64 != "" {
+		data, _ := base64.StdEncoding.DecodeString(e.ResponseBodyBase64)
+		return data
+	}
+	return []byte(e.ResponseBody)
+}
+
+type replayMessage struct {
+	offset  time.Duration
+	binary  bool
+	payload []byte
+}
+
+// replayer 按录制文件回放 HTTP 响应和 WebSocket 事件时间线
+type replayer struct {
+	mu          sync.Mutex
+	speed       float64
+	httpEntries []*recordedEntry
+	wsSessions  [][]replayMessage
+	nextSession int
+}
+
+func loadSession(path string) ([]*recordedEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开录制文件失败: %w", err)
+	}
+	defer file.Close()
+
+	entries := []*recordedEntry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 256*1024*1024)
+	for scanner.Scan() {
+		var entry recordedEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("解析录制文件失败: %w", err)
+		}
+		entries = append(entries, &entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取录制文件失败: %w", err)
+	}
+	return entries, nil
+}
+
+func newReplayer(entries []*recordedEntry, speed float64) *replayer {
+	r := &replayer{speed: speed}
+
+	// 每个录制的 WebSocket 连接按连接顺序对应回放时的连接
+	connected := map[string]time.Time{}
+	sessionIndex := map[string]int{}
+	for _, entry := range entries {
+		switch entry.Kind {
+		case "http":
+			if entry.Path != "/ws" {
+				r.httpEntries = append(r.httpEntries, entry)
+			}
+		case "ws_connect":
+			connected[entry.SID] = entry.Time
+			sessionIndex[entry.SID] = len(r.wsSessions)
+			r.wsSessions = append(r.wsSessions, nil)
+		case "ws_out", "ws_binary_out":
+			index, ok := sessionIndex[entry.SID]
+			if !ok {
+				continue
+			}
+			message := replayMessage{offset: entry.Time.Sub(connected[entry.SID])}
+			if entry.Kind == "ws_binary_out" {
+				message.binary = true
+				message.payload, _ = base64.StdEncoding.DecodeString(entry.DataBase64)
+			} else {
+				message.payload = entry.Message
+			}
+			r.wsSessions[index] = append(r.wsSessions[index], message)
+		}
+	}
+	return r
+}
+
+// match 优先匹配完全相同的请求，其次匹配相同路径，录制的响应用完后重复最后一个
+func (r *replayer) match(method, path, query string) *recordedEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var samePath, last *recordedEntry
+	for _, entry := range r.httpEntries {
+		if entry.Method != method || entry.Path != path {
+			continue
+		}
+		if entry.used {
+			last = entry
+			continue
+		}
+		if entry.Query == query {
+			entry.used = true
+			return entry
+		}
+		if samePath == nil {
+			samePath = entry
+		}
+	}
+	if samePath != nil {
+		samePath.used = true
+		return samePath
+	}
+	return last
+}
+
+func (r *replayer) handleHTTP(c *gin.Context) {
+	entry := r.match(c.Request.Method, c.Request.URL.Path, c.Request.URL.RawQuery)
+	if entry == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No recorded response"})
+		return
+	}
+
+	for key, values := range entry.ResponseHeaders {
+		if key == "Content-Length" {
+			continue
+		}
+		for _, value := range values {
+			c.Writer.Header().Add(key, value)
+		}
+	}
+	c.Status(entry.Status)
+	c.Writer.Write(entry.responseBody())
+}
+
+func (r *replayer) handleWebSocket(c *gin.Context) {
+	r.mu.Lock()
+	if r.nextSession >= len(r.wsSessions) {
+		r.mu.Unlock()
+		c.JSON(http.StatusNotFound, gin.H{"error": "No recorded WebSocket session"})
+		return
+	}
+	messages := r.wsSessions[r.nextSession]
+	r.nextSession++
+	r.mu.Unlock()
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	for _, message := range messages {
+		wait := time.Duration(float64(message.offset)/r.speed) - time.Since(start)
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+
+		msgType := websocket.TextMessage
+		if message.binary {
+			msgType = websocket.BinaryMessage
+		}
+		if err := conn.WriteMessage(msgType, message.payload); err != nil {
+			return
+		}
+	}
+
+	// 时间线回放完后保持连接，直到客户端断开
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// runReplay 启动一个只回放录制内容的服务
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	sessionPath := fs.String("session", "", "--record-dir 生成的录制文件")
+	addr := fs.String("addr", ":8188", "HTTP 监听地址")
+	speed := fs.Float64("speed", 1, "回放速度倍数，2 表示两倍速")
+	fs.Parse(args)
+
+	if *sessionPath == "" {
+		return fmt.Errorf("必须指定 --session")
+	}
+	if *speed <= 0 {
+		return fmt.Errorf("--speed 必须大于 0")
+	}
+
+	entries, err := loadSession(*sessionPath)
+	if err != nil {
+		return err
+	}
+	rp := newReplayer(entries, *speed)
+
+	r := gin.Default()
+	r.GET("/ws", rp.handleWebSocket)
+	r.NoRoute(rp.handleHTTP)
+
+	fmt.Printf("回放 %s：%d 个 HTTP 响应，%d 个 WebSocket 会话\n", *sessionPath, len(rp.httpEntries), len(rp.wsSessions))
+	return r.Run(*addr)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxDeadLetters 是 dead-letter 列表保留的最大条数
+const maxDeadLetters = 1000
+
+// deadLetter 记录重试次数用完后仍然失败的 prompt
+type deadLetter struct {
+	PromptID string                 `json:"prompt_id"`
+	ClientID string                 `json:"client_id"`
+	Number   int                    `json:"number"`
+	Attempts int                    `json:"attempts"`
+	Error    map[string]interface{} `json:"error"`
+	FailedAt time.Time              `json:"failed_at"`
+}
+
+// retryPrompt 在还有重试次数时将失败的 prompt 放回队列末尾，模拟在 ComfyUI 外面包一层重试，调用方需持有锁
+func (m *ComfyUIMock) retryPrompt(prompt *PromptInfo) bool {
+	if prompt.Attempts >= m.cfg.MaxRetries {
+		return false
+	}
+	prompt.Attempts++
+	prompt.Status = "pending"
+	prompt.FinishedAt = time.Time{}
+	m.pending = append(m.pending, prompt)
+	m.persist(prompt)
+	return true
+}
+
+// addDeadLetter 将重试次数用完的 prompt 加入 dead-letter 列表，调用方需持有锁
+func (m *ComfyUIMock) addDeadLetter(prompt *PromptInfo) {
+	if m.cfg.MaxRetries <= 0 {
+		return
+	}
+	m.deadLetters = append(m.deadLetters, deadLetter{
+		PromptID: prompt.PromptID,
+		ClientID: prompt.ClientID,
+		Number:   prompt.ID,
+		Attempts: prompt.Attempts + 1,
+		Error:    prompt.Error,
+		FailedAt: prompt.FinishedAt,
+	})
+	if len(m.deadLetters) > maxDeadLetters {
+		m.deadLetters = m.deadLetters[len(m.deadLetters)-maxDeadLetters:]
+	}
+}
+
+// handleDeadLetters 返回重试后仍然失败的 prompt，按失败时间排序
+func (m *ComfyUIMock) handleDeadLetters(c *gin.Context) {
+	m.mu.Lock()
+	letters := append([]deadLetter{}, m.deadLetters...)
+	m.mu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"max_retries": m.cfg.MaxRetries, "dead_letters": letters})
+}
+
+func (m *ComfyUIMock) handleDeadLettersClear(c *gin.Context) {
+	m.mu.Lock()
+	cleared := len(m.deadLetters)
+	m.deadLetters = nil
+	m.mu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"cleared": cleared})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// promptSchemaData 是 POST /prompt 请求体的 JSON schema
+//
+//go:embed resources/prompt.schema.json
+var promptSchemaData []byte
+
+var promptSchema = jsonschema.MustCompileString("prompt.schema.json", string(promptSchemaData))
+
+// schemaError 是请求体中一个不符合 schema 的字段，path 为 JSON pointer
+type schemaError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// validatePromptSchema 按 schema 检查 /prompt 请求体，返回每个出错字段的错误，body 不是合法 JSON 时返回 error
+func validatePromptSchema(body []byte) ([]schemaError, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("请求体不是合法的 JSON: %w", err)
+	}
+
+	err := promptSchema.Validate(value)
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil, err
+	}
+
+	// 只保留最底层的错误，上层的 "doesn't validate with ..." 没有额外信息
+	errs := []schemaError{}
+	seen := map[schemaError]bool{}
+	var collect func(e *jsonschema.ValidationError)
+	collect = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) > 0 {
+			for _, cause := range e.Causes {
+				collect(cause)
+			}
+			return
+		}
+		path := e.InstanceLocation
+		if path == "" {
+			path = "/"
+		}
+		item := schemaError{Path: path, Message: e.Message}
+		if !seen[item] {
+			seen[item] = true
+			errs = append(errs, item)
+		}
+	}
+	collect(validationErr)
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+	return errs, nil
+}
+
+// schemaErrorDetails 把字段错误拼成一行，用于 X-Mock-Warning 和 ComfyUI 格式错误的 details
+func schemaErrorDetails(errs []schemaError) string {
+	parts := make([]string, 0, len(errs))
+	for _, err := range errs {
+		parts = append(parts, err.Path+": "+err.Message)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// rejectSchema 以 ComfyUI 的 invalid_prompt 格式返回 400，字段错误放在 extra_info.schema_errors 中
+func rejectSchema(c *gin.Context, errs []schemaError) {
+	details := schemaErrorDetails(errs)
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": map[string]interface{}{
+			"type":       "invalid_prompt",
+			"message":    "Request does not match the /prompt schema",
+			"details":    details,
+			"extra_info": map[string]interface{}{"schema_errors": errs},
+		},
+		"node_errors": gin.H{},
+	})
+}
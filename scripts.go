@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+)
+
+// scriptHooks 是 --script 加载的 Starlark 脚本中定义的钩子函数，未定义的钩子为 nil。
+//
+//	def on_submit(prompt):
+//	    # 返回 None 不做修改，可以覆盖 processing_time (秒) 和 priority，
+//	    # 返回 {"status": "failed", "error": "..."} 时执行到最后以 ScriptError 失败
+//	    return {"processing_time": 0.5}
+//
+//	def on_complete(prompt):
+//	    # prompt["outputs"] 是生成的 outputs，可以返回新的 outputs 或 {"status": "failed", ...}
+//	    return {"outputs": prompt["outputs"]}
+type scriptHooks struct {
+	onSubmit   starlark.Callable
+	onComplete starlark.Callable
+}
+
+// scriptMaxSteps 和 scriptTimeout 限制脚本的执行，死循环的钩子以 ScriptError 失败，不会卡住服务
+const (
+	scriptMaxSteps = 100_000_000
+	scriptTimeout  = 10 * time.Second
+)
+
+// scriptOverrides 保存 on_submit 返回的修改，只在内存中
+type scriptOverrides struct {
+	processing time.Duration
+	failure    string
+}
+
+// newScriptThread 返回有执行步数限制的线程，ctx 结束或超过 scriptTimeout 时中止执行，返回的函数释放计时器
+func newScriptThread(ctx context.Context, name string) (*starlark.Thread, func()) {
+	thread := &starlark.Thread{Name: name}
+	thread.SetMaxExecutionSteps(scriptMaxSteps)
+	ctx, cancel := context.WithTimeout(ctx, scriptTimeout)
+	stop := context.AfterFunc(ctx, func() {
+		thread.Cancel(fmt.Sprintf("%s: %v", name, context.Cause(ctx)))
+	})
+	return thread, func() {
+		stop()
+		cancel()
+	}
+}
+
+func loadScript(path string) (*scriptHooks, error) {
+	thread, done := newScriptThread(context.Background(), "load")
+	defer done()
+	predeclared := starlark.StringDict{"json": starlarkjson.Module}
+	globals, err := starlark.ExecFile(thread, path, nil, predeclared)
+	if err != nil {
+		return nil, fmt.Errorf("加载脚本失败: %w", err)
+	}
+
+	hooks := &scriptHooks{}
+	for name, target := range map[string]*starlark.Callable{"on_submit": &hooks.onSubmit, "on_complete": &hooks.onComplete} {
+		value, ok := globals[name]
+		if !ok {
+			continue
+		}
+		fn, ok := value.(starlark.Callable)
+		if !ok {
+			return nil, fmt.Errorf("脚本中的 %s 不是函数", name)
+		}
+		*target = fn
+	}
+	return hooks, nil
+}
+
+// scriptArg 返回传给钩子的 prompt 字典，只引用 prompt 中的数据，转换在 call 中进行，调用方需持有锁
+func scriptArg(prompt *PromptInfo, extra map[string]interface{}) map[string]interface{} {
+	arg := map[string]interface{}{
+		"prompt_id": prompt.PromptID,
+		"client_id": prompt.ClientID,
+		"number":    prompt.ID,
+		"priority":  prompt.Priority,
+		"attempts":  prompt.Attempts,
+		"status":    prompt.Status,
+		"prompt":    prompt.Prompt,
+	}
+	for key, value := range extra {
+		arg[key] = value
+	}
+	return arg
+}
+
+// call 调用钩子，参数是 scriptArg 返回的字典，返回值必须是 None 或字典
+func (h *scriptHooks) call(ctx context.Context, fn starlark.Callable, arg map[string]interface{}) (map[string]interface{}, error) {
+	value, err := toStarlark(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	thread, done := newScriptThread(ctx, fn.Name())
+	defer done()
+	result, err := starlark.Call(thread, fn, starlark.Tuple{value}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if result == starlark.None {
+		return nil, nil
+	}
+	converted, err := fromStarlark(result)
+	if err != nil {
+		return nil, err
+	}
+	changes, ok := converted.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s 必须返回 None 或字典，实际为 %s", fn.Name(), result.Type())
+	}
+	return changes, nil
+}
+
+// hasSubmit 判断是否定义了 on_submit，定义了时 prompt 在钩子返回前不会执行
+func (h *scriptHooks) hasSubmit() bool {
+	return h != nil && h.onSubmit != nil
+}
+
+// runSubmitHook 在 prompt 入队后调用 on_submit，脚本出错时 prompt 在执行时以 ScriptError 失败，不能在持有锁时调用
+func (m *ComfyUIMock) runSubmitHook(prompt *PromptInfo) {
+	if !m.scripts.hasSubmit() {
+		return
+	}
+	m.mu.Lock()
+	arg := scriptArg(prompt, nil)
+	m.mu.Unlock()
+
+	var overrides scriptOverrides
+	priority, setPriority := 0, false
+	changes, err := m.scripts.call(context.Background(), m.scripts.onSubmit, arg)
+	if err != nil {
+		overrides.failure = err.Error()
+	} else {
+		if seconds, ok := changes["processing_time"].(float64); ok {
+			overrides.processing = time.Duration(seconds * float64(time.Second))
+		} else if seconds, ok := changes["processing_time"].(int64); ok {
+			overrides.processing = time.Duration(seconds) * time.Second
+		}
+		if value, ok := changes["priority"].(int64); ok {
+			priority, setPriority = int(value), true
+		}
+		overrides.failure = scriptFailure(changes)
+	}
+
+	m.mu.Lock()
+	prompt.script = overrides
+	if setPriority {
+		prompt.Priority = priority
+	}
+	prompt.scripting = false
+	if _, exists := m.prompts[prompt.PromptID]; exists {
+		m.persist(prompt)
+	}
+	m.mu.Unlock()
+	m.notifyQueue()
+}
+
+// complete 调用 on_complete，arg 由 scriptArg 生成并带上 outputs。返回修改后的 outputs，
+// message 不为空时 prompt 以该错误失败，不能在持有锁时调用
+func (h *scriptHooks) complete(ctx context.Context, arg map[string]interface{}) (outputs map[string]interface{}, message string) {
+	outputs, _ = arg["outputs"].(map[string]interface{})
+	if h == nil || h.onComplete == nil {
+		return outputs, ""
+	}
+	changes, err := h.call(ctx, h.onComplete, arg)
+	if err != nil {
+		return outputs, err.Error()
+	}
+	if changed, ok := changes["outputs"].(map[string]interface{}); ok {
+		outputs = changed
+	}
+	return outputs, scriptFailure(changes)
+}
+
+func scriptFailure(changes map[string]interface{}) string {
+	if changes["status"] != "failed" {
+		return ""
+	}
+	if message, ok := changes["error"].(string); ok && message != "" {
+		return message
+	}
+	return "Failed by script"
+}
+
+// toStarlark 先经过 JSON 转换，gin.H 等具名类型也能统一处理
+func toStarlark(v interface{}) (starlark.Value, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("转换脚本参数失败: %w", err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("转换脚本参数失败: %w", err)
+	}
+	return jsonToStarlark(decoded), nil
+}
+
+func jsonToStarlark(v interface{}) starlark.Value {
+	switch v := v.(type) {
+	case bool:
+		return starlark.Bool(v)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return starlark.MakeInt64(int64(v))
+		}
+		return starlark.Float(v)
+	case string:
+		return starlark.String(v)
+	case []interface{}:
+		items := make([]starlark.Value, len(v))
+		for i, item := range v {
+			items[i] = jsonToStarlark(item)
+		}
+		return starlark.NewList(items)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		dict := starlark.NewDict(len(v))
+		for _, key := range keys {
+			dict.SetKey(starlark.String(key), jsonToStarlark(v[key]))
+		}
+		return dict
+	}
+	return starlark.None
+}
+
+func fromStarlark(v starlark.Value) (interface{}, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		if i, ok := v.Int64(); ok {
+			return i, nil
+		}
+		return nil, fmt.Errorf("整数超出范围: %s", v)
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Indexable:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			item, err := fromStarlark(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	case *starlark.Dict:
+		result := make(map[string]interface{}, v.Len())
+		for _, item := range v.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("字典的键必须是字符串: %s", item[0])
+			}
+			value, err := fromStarlark(item[1])
+			if err != nil {
+				return nil, err
+			}
+			result[key] = value
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("不支持的脚本返回值类型: %s", v.Type())
+}
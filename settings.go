@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// settingsMu 保证读取、合并和写回 comfy.settings.json 不会交错
+var settingsMu sync.Mutex
+
+// 与 ComfyUI 一致，设置保存在用户目录下的 comfy.settings.json
+const settingsFile = "comfy.settings.json"
+
+func loadSettings(path string) (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return settings, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取设置文件失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("解析设置文件失败: %w", err)
+	}
+	return settings, nil
+}
+
+func saveSettings(path string, settings map[string]interface{}) error {
+	data, err := json.MarshalIndent(settings, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("创建用户目录失败: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("写入设置文件失败: %w", err)
+	}
+	return nil
+}
+
+// handleSettings 返回当前用户的全部设置
+func (m *ComfyUIMock) handleSettings(c *gin.Context) {
+	path, ok := m.userFilePath(c, settingsFile)
+	if !ok {
+		return
+	}
+	settingsMu.Lock()
+	settings, err := loadSettings(path)
+	settingsMu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// handleSetting 返回单个设置，不存在时返回 null
+func (m *ComfyUIMock) handleSetting(c *gin.Context) {
+	path, ok := m.userFilePath(c, settingsFile)
+	if !ok {
+		return
+	}
+	settingsMu.Lock()
+	settings, err := loadSettings(path)
+	settingsMu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings[c.Param("id")])
+}
+
+// handleSettingsUpdate 将请求体中的设置合并到已有设置中
+func (m *ComfyUIMock) handleSettingsUpdate(c *gin.Context) {
+	var update map[string]interface{}
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	m.updateSettings(c, update)
+}
+
+// handleSettingUpdate 将请求体作为单个设置的值
+func (m *ComfyUIMock) handleSettingUpdate(c *gin.Context) {
+	var value interface{}
+	if err := c.ShouldBindJSON(&value); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	m.updateSettings(c, map[string]interface{}{c.Param("id"): value})
+}
+
+func (m *ComfyUIMock) updateSettings(c *gin.Context, update map[string]interface{}) {
+	path, ok := m.userFilePath(c, settingsFile)
+	if !ok {
+		return
+	}
+
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	settings, err := loadSettings(path)
+	if err == nil {
+		for key, value := range update {
+			settings[key] = value
+		}
+		err = saveSettings(path, settings)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusOK)
+}
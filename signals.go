@@ -0,0 +1,55 @@
+//go:build !windows
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleSignals 在不调用管理接口的情况下调整运行中的 mock：
+// SIGHUP 重新读取 fixture 和脚本文件，SIGUSR1 切换是否让所有 prompt 执行失败，SIGUSR2 将当前状态输出到标准输出
+func (m *ComfyUIMock) handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	for sig := range signals {
+		switch sig {
+		case syscall.SIGHUP:
+			if err := m.loadFixtures(); err != nil {
+				fmt.Printf("重新加载 fixture 失败: %v\n", err)
+				continue
+			}
+			m.logf("Reloaded fixtures (SIGHUP)")
+		case syscall.SIGUSR1:
+			if m.forceFail.Load() {
+				m.forceFail.Store(false)
+				m.logf("Failure injection disabled (SIGUSR1)")
+			} else {
+				m.forceFail.Store(true)
+				m.logf("Failure injection enabled, all prompts will fail (SIGUSR1)")
+			}
+		case syscall.SIGUSR2:
+			m.dumpState()
+		}
+	}
+}
+
+// dumpState 以 JSON 输出 prompt 和队列状态，不包含 object_info 等 fixture
+func (m *ComfyUIMock) dumpState() {
+	m.mu.Lock()
+	state := m.exportState()
+	state.Models = nil
+	state.ModelMetadata = nil
+	state.ObjectInfo = nil
+	data, err := json.MarshalIndent(state, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		fmt.Printf("导出状态失败: %v\n", err)
+		return
+	}
+	fmt.Printf("%s\n", data)
+}
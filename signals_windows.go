@@ -0,0 +1,4 @@
+package main
+
+// handleSignals 在 Windows 上没有 SIGHUP、SIGUSR1 和 SIGUSR2，不做任何处理
+func (m *ComfyUIMock) handleSignals() {}
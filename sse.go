@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// sseClient 通过 Server-Sent Events 推送与 WebSocket 相同的消息
+type sseClient struct {
+	events chan string
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newSSEClient() *sseClient {
+	return &sseClient{events: make(chan string, 256), done: make(chan struct{})}
+}
+
+func (c *sseClient) push(event string) error {
+	select {
+	case c.events <- event:
+		return nil
+	case <-c.done:
+		return fmt.Errorf("SSE 连接已关闭")
+	default:
+		return fmt.Errorf("SSE 发送缓冲区已满")
+	}
+}
+
+// writeJSON 消息体与 WebSocket 的 JSON 消息完全一致
+func (c *sseClient) writeJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.push(fmt.Sprintf("data: %s\n\n", data))
+}
+
+// writeBinary 二进制消息以 base64 编码，事件名为 binary
+func (c *sseClient) writeBinary(data []byte) error {
+	return c.push(fmt.Sprintf("event: binary\ndata: %s\n\n", base64.StdEncoding.EncodeToString(data)))
+}
+
+func (c *sseClient) close() {
+	c.once.Do(func() { close(c.done) })
+}
+
+// handleEvents 以 SSE 推送执行事件，用于无法保持 WebSocket 的环境
+func (m *ComfyUIMock) handleEvents(c *gin.Context) {
+	sid := c.Query("clientId")
+	if sid == "" {
+		sid = strings.ReplaceAll(uuid.New().String(), "-", "")
+	}
+
+	client := newSSEClient()
+	m.ws.add(sid, client)
+	defer m.ws.remove(sid, client)
+
+	m.recorder.record(map[string]interface{}{"kind": "sse_connect", "sid": sid, "client_ip": c.ClientIP()})
+	defer m.recorder.record(map[string]interface{}{"kind": "sse_disconnect", "sid": sid})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	m.mu.Lock()
+	status := m.statusData()
+	m.mu.Unlock()
+	status["sid"] = sid
+	m.ws.sendTo(sid, client, "status", status)
+
+	// 定时发送注释行，避免代理因空闲断开连接
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event := <-client.events:
+			io.WriteString(w, event)
+			return true
+		case <-keepalive.C:
+			io.WriteString(w, ": keepalive\n\n")
+			return true
+		case <-client.done:
+			return false
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mockState 是 /__mock/state 导出和导入的完整状态，prompts 按 history、执行中、等待队列的顺序排列
+type mockState struct {
+	Prompts        []*PromptInfo                     `json:"prompts"`
+	QueueID        int                               `json:"queue_id"`
+	ClientQueueIDs map[string]int                    `json:"client_queue_ids,omitempty"`
+	ModelsLoaded   bool                              `json:"models_loaded"`
+	VRAMUsed       int64                             `json:"vram_used"`
+	Models         map[string][]string               `json:"models,omitempty"`
+	ModelMetadata  map[string]map[string]interface{} `json:"model_metadata,omitempty"`
+	ObjectInfo     map[string]interface{}            `json:"object_info,omitempty"`
+}
+
+// errStateImported 是导入状态时取消执行中 prompt 的原因
+var errStateImported = errors.New("state replaced by import")
+
+// validateState 检查导入的 prompt，prompt_id 会用在输出文件名中，不能为空或包含路径分隔符
+func validateState(state mockState) error {
+	seen := make(map[string]bool, len(state.Prompts))
+	for i, prompt := range state.Prompts {
+		if prompt == nil {
+			return fmt.Errorf("prompts[%d] is null", i)
+		}
+		if prompt.PromptID == "" || prompt.PromptID == "." || prompt.PromptID == ".." || strings.ContainsAny(prompt.PromptID, `/\`) {
+			return fmt.Errorf("prompts[%d] has an invalid prompt_id: %q", i, prompt.PromptID)
+		}
+		if seen[prompt.PromptID] {
+			return fmt.Errorf("prompts[%d] has a duplicate prompt_id: %q", i, prompt.PromptID)
+		}
+		seen[prompt.PromptID] = true
+	}
+	return nil
+}
+
+// exportState 导出当前状态，调用方需持有锁
+func (m *ComfyUIMock) exportState() mockState {
+	finished := []*PromptInfo{}
+	for _, prompt := range m.prompts {
+		if prompt.Status == "completed" || prompt.Status == "failed" {
+			finished = append(finished, prompt)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		if !finished[i].FinishedAt.Equal(finished[j].FinishedAt) {
+			return finished[i].FinishedAt.Before(finished[j].FinishedAt)
+		}
+		return finished[i].PromptID < finished[j].PromptID
+	})
+
+	prompts := finished
+	if m.runningTask != nil {
+		prompts = append(prompts, m.runningTask)
+	}
+	prompts = append(prompts, m.pending...)
+
+	return mockState{
+		Prompts:        prompts,
+		QueueID:        m.queueID,
+		ClientQueueIDs: m.clientQueueIDs,
+		ModelsLoaded:   m.modelsLoaded,
+		VRAMUsed:       m.vramUsed,
+		Models:         m.models,
+		ModelMetadata:  m.modelMetadata,
+		ObjectInfo:     m.objectInfo,
+	}
+}
+
+// importState 用 state 替换当前的 prompt 和队列，执行中的 prompt 会重新排到队首，state 需先经过 validateState 检查，调用方需持有锁。
+// models、model_metadata 和 object_info 为空时保留当前的 fixture
+func (m *ComfyUIMock) importState(state mockState) {
+	m.cancelRunning(errStateImported)
+	for promptID, prompt := range m.prompts {
+		prompt.trace.finish("deleted", nil)
+		m.unpersist(promptID)
+	}
+
+	m.prompts = make(map[string]*PromptInfo)
+	m.pending = nil
+	running := []*PromptInfo{}
+	maxID := 0
+	for _, prompt := range state.Prompts {
+		if prompt.QueuedAt.IsZero() {
+			prompt.QueuedAt = time.Now()
+		}
+		switch prompt.Status {
+		case "completed", "failed":
+			if prompt.FinishedAt.IsZero() {
+				prompt.FinishedAt = prompt.QueuedAt
+			}
+		case "processing":
+			prompt.Status = "pending"
+			running = append(running, prompt)
+		default:
+			prompt.Status = "pending"
+			m.pending = append(m.pending, prompt)
+		}
+		if prompt.ID > maxID {
+			maxID = prompt.ID
+		}
+		m.reorderSeq = max(m.reorderSeq, prompt.Pinned, -prompt.Pinned)
+		m.prompts[prompt.PromptID] = prompt
+		m.persist(prompt)
+	}
+	m.pending = append(running, m.pending...)
+
+	m.queueID = max(state.QueueID, maxID)
+	m.clientQueueIDs = state.ClientQueueIDs
+	if m.clientQueueIDs == nil {
+		m.clientQueueIDs = make(map[string]int)
+	}
+	m.modelsLoaded = state.ModelsLoaded
+	m.vramUsed = state.VRAMUsed
+	if state.Models != nil {
+		m.models = state.Models
+	}
+	if state.ModelMetadata != nil {
+		m.modelMetadata = state.ModelMetadata
+	}
+	if state.ObjectInfo != nil {
+		m.objectInfo = state.ObjectInfo
+	}
+}
+
+// loadStateFile 读取 --seed-state 指定的状态文件
+func loadStateFile(path string) (mockState, error) {
+	var state mockState
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return state, fmt.Errorf("读取状态文件失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("解析状态文件失败: %w", err)
+	}
+	if err := validateState(state); err != nil {
+		return state, fmt.Errorf("状态文件不合法: %w", err)
+	}
+	return state, nil
+}
+
+func (m *ComfyUIMock) handleStateExport(c *gin.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c.JSON(http.StatusOK, m.exportState())
+}
+
+func (m *ComfyUIMock) handleStateImport(c *gin.Context) {
+	var state mockState
+	if err := c.ShouldBindJSON(&state); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateState(state); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	m.mu.Lock()
+	m.importState(state)
+	queued := len(m.pending)
+	total := len(m.prompts)
+	m.mu.Unlock()
+
+	m.broadcastStatus()
+	m.notifyQueue()
+
+	c.JSON(http.StatusOK, gin.H{"prompts": total, "queued": queued})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statsSamples 是计算延迟分位数时保留的最近执行记录数
+const statsSamples = 1024
+
+// statsWindow 是计算吞吐量的时间窗口
+const statsWindow = time.Minute
+
+type execSample struct {
+	finishedAt   time.Time
+	queueLatency time.Duration
+	execTime     time.Duration
+}
+
+// mockStats 统计 mock 自身的性能，用于确认压测时瓶颈不在 mock
+type mockStats struct {
+	mu        sync.Mutex
+	completed int64
+	failed    int64
+	samples   []execSample
+	next      int
+}
+
+// record 记录一个执行结束的 prompt
+func (s *mockStats) record(prompt *PromptInfo, status string, finishedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch status {
+	case "completed":
+		s.completed++
+	case "failed":
+		s.failed++
+	default:
+		return
+	}
+
+	sample := execSample{
+		finishedAt:   finishedAt,
+		queueLatency: prompt.started.Sub(prompt.QueuedAt),
+		execTime:     finishedAt.Sub(prompt.started),
+	}
+	if len(s.samples) < statsSamples {
+		s.samples = append(s.samples, sample)
+		return
+	}
+	s.samples[s.next] = sample
+	s.next = (s.next + 1) % statsSamples
+}
+
+// durationSummary 返回毫秒为单位的平均值和分位数
+func durationSummary(values []time.Duration) gin.H {
+	if len(values) == 0 {
+		return gin.H{"count": 0}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	var total time.Duration
+	for _, value := range values {
+		total += value
+	}
+	percentile := func(p float64) float64 {
+		return float64(values[int(p*float64(len(values)-1))]) / float64(time.Millisecond)
+	}
+	return gin.H{
+		"count":   len(values),
+		"mean_ms": float64(total) / float64(len(values)) / float64(time.Millisecond),
+		"p50_ms":  percentile(0.5),
+		"p95_ms":  percentile(0.95),
+		"p99_ms":  percentile(0.99),
+		"max_ms":  float64(values[len(values)-1]) / float64(time.Millisecond),
+	}
+}
+
+func (s *mockStats) snapshot(uptime time.Duration) gin.H {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	window := statsWindow
+	if uptime < window {
+		window = uptime
+	}
+	recent := 0
+	queueLatency := make([]time.Duration, 0, len(s.samples))
+	execTime := make([]time.Duration, 0, len(s.samples))
+	for _, sample := range s.samples {
+		if now.Sub(sample.finishedAt) <= window {
+			recent++
+		}
+		queueLatency = append(queueLatency, sample.queueLatency)
+		execTime = append(execTime, sample.execTime)
+	}
+
+	promptsPerSecond := 0.0
+	if window > 0 {
+		promptsPerSecond = float64(recent) / window.Seconds()
+	}
+
+	return gin.H{
+		"prompts_completed":  s.completed,
+		"prompts_failed":     s.failed,
+		"prompts_per_second": promptsPerSecond,
+		"queue_latency":      durationSummary(queueLatency),
+		"execution_time":     durationSummary(execTime),
+	}
+}
+
+// handleStats 返回 mock 自身的性能计数，延迟统计基于最近 1024 个执行完的 prompt
+func (m *ComfyUIMock) handleStats(c *gin.Context) {
+	m.mu.Lock()
+	queued := len(m.pending)
+	running := 0
+	if m.runningTask != nil {
+		running = 1
+	}
+	total := len(m.prompts)
+	paused := m.resumed != nil
+	m.mu.Unlock()
+
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+
+	uptime := time.Since(m.launchedAt)
+	stats := m.stats.snapshot(uptime)
+	stats["uptime_seconds"] = uptime.Seconds()
+	stats["queue_pending"] = queued
+	stats["queue_running"] = running
+	stats["paused"] = paused
+	stats["prompts_stored"] = total
+	stats["event_clients"] = m.ws.count()
+	stats["goroutines"] = runtime.NumGoroutine()
+	stats["heap_alloc_bytes"] = memory.HeapAlloc
+	stats["gc_cycles"] = memory.NumGC
+
+	c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// StateStore 在多个 mock 实例之间共享 prompt 状态和队列
+type StateStore interface {
+	SavePrompt(promptID string, data []byte) error
+	LoadPrompt(promptID string) (*PromptInfo, error)
+	ListPrompts() ([]*PromptInfo, error)
+	DeletePrompt(promptID string) error
+	// DeletePending 删除还在等待、没有被其他实例领取的 prompt，删除成功时返回 true
+	DeletePending(promptID string) (bool, error)
+	// ClaimPrompt 领取 prompt 的执行权，prompt 已被删除或已被其他实例领取时返回 false
+	ClaimPrompt(promptID string) (bool, error)
+	// NextQueueID 分配所有实例共享的队列编号，clientID 不为空时按 client 独立计数
+	NextQueueID(clientID string) (int, error)
+}
+
+type redisStore struct {
+	client *redis.Client
+	prefix string
+	key    string
+	claims string
+	// owner 标识当前实例，写入 claims 表示 prompt 由哪个实例执行
+	owner string
+}
+
+// claimScript 只有 prompt 存在且没有被其他实例领取时才写入领取记录
+var claimScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 0 then return 0 end
+local owner = redis.call('HGET', KEYS[2], ARGV[1])
+if owner and owner ~= ARGV[2] then return 0 end
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+return 1
+`)
+
+// deletePendingScript 只删除还在等待、没有被其他实例领取的 prompt
+var deletePendingScript = redis.NewScript(`
+local data = redis.call('HGET', KEYS[1], ARGV[1])
+if not data then return 0 end
+local owner = redis.call('HGET', KEYS[2], ARGV[1])
+if owner and owner ~= ARGV[2] then return 0 end
+if cjson.decode(data)['status'] ~= 'pending' then return 0 end
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+return 1
+`)
+
+func newRedisStore(addr, prefix string) (*redisStore, error) {
+	client := redis.NewClient(&redis.Options{Addr: addr})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("连接 Redis 失败: %w", err)
+	}
+
+	return &redisStore{
+		client: client,
+		prefix: prefix,
+		key:    prefix + "prompts",
+		claims: prefix + "claims",
+		owner:  uuid.New().String(),
+	}, nil
+}
+
+func (s *redisStore) SavePrompt(promptID string, data []byte) error {
+	return s.client.HSet(context.Background(), s.key, promptID, data).Err()
+}
+
+func (s *redisStore) LoadPrompt(promptID string) (*PromptInfo, error) {
+	data, err := s.client.HGet(context.Background(), s.key, promptID).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var prompt PromptInfo
+	if err := json.Unmarshal(data, &prompt); err != nil {
+		return nil, err
+	}
+	return &prompt, nil
+}
+
+func (s *redisStore) ListPrompts() ([]*PromptInfo, error) {
+	values, err := s.client.HGetAll(context.Background(), s.key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	prompts := make([]*PromptInfo, 0, len(values))
+	for _, data := range values {
+		var prompt PromptInfo
+		if err := json.Unmarshal([]byte(data), &prompt); err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, &prompt)
+	}
+	return prompts, nil
+}
+
+func (s *redisStore) DeletePrompt(promptID string) error {
+	ctx := context.Background()
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, s.key, promptID)
+		pipe.HDel(ctx, s.claims, promptID)
+		return nil
+	})
+	return err
+}
+
+func (s *redisStore) DeletePending(promptID string) (bool, error) {
+	deleted, err := deletePendingScript.Run(context.Background(), s.client, []string{s.key, s.claims}, promptID, s.owner).Int()
+	return deleted == 1, err
+}
+
+func (s *redisStore) ClaimPrompt(promptID string) (bool, error) {
+	claimed, err := claimScript.Run(context.Background(), s.client, []string{s.key, s.claims}, promptID, s.owner).Int()
+	return claimed == 1, err
+}
+
+func (s *redisStore) NextQueueID(clientID string) (int, error) {
+	key := s.prefix + "queue_id"
+	if clientID != "" {
+		key += ":" + clientID
+	}
+	id, err := s.client.Incr(context.Background(), key).Result()
+	return int(id), err
+}
+
+// storeQueue 在后台 goroutine 中按提交顺序执行共享存储的请求，持有 m.mu 时只入队，不等待网络
+type storeQueue struct {
+	mu    sync.Mutex
+	ops   []func()
+	seq   uint64
+	ready chan struct{}
+}
+
+func newStoreQueue() *storeQueue {
+	q := &storeQueue{ready: make(chan struct{}, 1)}
+	go q.run()
+	return q
+}
+
+// async 将 op 加入队列，返回的序号用于判断之后的读取是否已经包含这次写入
+func (q *storeQueue) async(op func()) uint64 {
+	q.mu.Lock()
+	q.ops = append(q.ops, op)
+	q.seq++
+	seq := q.seq
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return seq
+}
+
+// wait 执行 op 并等待完成，之前入队的写入都会先执行，不能在持有 m.mu 时调用
+func (q *storeQueue) wait(op func()) uint64 {
+	done := make(chan struct{})
+	seq := q.async(func() {
+		op()
+		close(done)
+	})
+	<-done
+	return seq
+}
+
+func (q *storeQueue) run() {
+	for range q.ready {
+		for {
+			q.mu.Lock()
+			ops := q.ops
+			q.ops = nil
+			q.mu.Unlock()
+			if len(ops) == 0 {
+				break
+			}
+			for _, op := range ops {
+				op()
+			}
+		}
+	}
+}
+
+// useStore 开启共享队列：本地队列为空时定期领取其他实例等待中的 prompt
+func (m *ComfyUIMock) useStore(store StateStore) {
+	m.store = store
+	m.storeOps = newStoreQueue()
+	go func() {
+		for range time.Tick(time.Second) {
+			m.notifyQueue()
+		}
+	}()
+}
+
+// persist 将 prompt 的最新状态写入共享存储，写入在后台执行，调用方需持有锁
+func (m *ComfyUIMock) persist(prompt *PromptInfo) {
+	if m.store == nil {
+		return
+	}
+	data, err := json.Marshal(prompt)
+	if err != nil {
+		fmt.Printf("写入共享状态失败: %v\n", err)
+		return
+	}
+	store, promptID := m.store, prompt.PromptID
+	prompt.savedSeq = m.storeOps.async(func() {
+		if err := store.SavePrompt(promptID, data); err != nil {
+			fmt.Printf("写入共享状态失败: %v\n", err)
+		}
+	})
+}
+
+// flushStore 等待之前入队的写入完成，新提交的 prompt 在返回给客户端之前要对其他实例可见，不能在持有锁时调用
+func (m *ComfyUIMock) flushStore() {
+	if m.store != nil {
+		m.storeOps.wait(func() {})
+	}
+}
+
+// unpersist 从共享存储中删除 prompt，删除在后台执行，调用方需持有锁
+func (m *ComfyUIMock) unpersist(promptID string) {
+	if m.store == nil {
+		return
+	}
+	store := m.store
+	m.storeOps.async(func() {
+		if err := store.DeletePrompt(promptID); err != nil {
+			fmt.Printf("删除共享状态失败: %v\n", err)
+		}
+	})
+}
+
+// sharedQueueID 从共享存储分配队列编号，没有共享存储或出错时返回 0，由 newPrompt 在本地分配，不能在持有锁时调用
+func (m *ComfyUIMock) sharedQueueID(clientID string) int {
+	if m.store == nil {
+		return 0
+	}
+	if !m.cfg.TenantIsolation {
+		clientID = ""
+	}
+	id, err := m.store.NextQueueID(clientID)
+	if err != nil {
+		fmt.Printf("分配共享队列编号失败: %v\n", err)
+		return 0
+	}
+	return id
+}
+
+// claimPrompt 在执行前领取 prompt，没有共享存储或出错时按已领取处理，不能在持有锁时调用
+func (m *ComfyUIMock) claimPrompt(prompt *PromptInfo) bool {
+	if m.store == nil {
+		return true
+	}
+	claimed := true
+	m.storeOps.wait(func() {
+		var err error
+		if claimed, err = m.store.ClaimPrompt(prompt.PromptID); err != nil {
+			fmt.Printf("领取共享 prompt 失败: %v\n", err)
+			claimed = true
+		}
+	})
+	return claimed
+}
+
+// deleteQueued 删除等待中的 prompt，共享模式下也删除其他实例提交的 prompt，返回删除成功的 prompt_id，不能在持有锁时调用
+func (m *ComfyUIMock) deleteQueued(promptIDs []string) []string {
+	local := map[string]bool{}
+	m.mu.Lock()
+	for _, promptID := range promptIDs {
+		local[promptID] = m.deletePending(promptID)
+	}
+	m.mu.Unlock()
+
+	deleted := []string{}
+	for _, promptID := range promptIDs {
+		ok := local[promptID]
+		if m.store != nil {
+			m.storeOps.wait(func() {
+				removed, err := m.store.DeletePending(promptID)
+				if err != nil {
+					fmt.Printf("删除共享状态失败: %v\n", err)
+					return
+				}
+				// 本地的 prompt 已经被其他实例领取时不算删除
+				ok = removed
+			})
+		}
+		if ok {
+			deleted = append(deleted, promptID)
+		}
+	}
+	return deleted
+}
+
+// sharedPrompts 返回共享存储中的所有 prompt，之前入队的写入都已生效，seq 用于 reconcileShared，不能在持有锁时调用
+func (m *ComfyUIMock) sharedPrompts() (prompts []*PromptInfo, seq uint64) {
+	if m.store == nil {
+		return nil, 0
+	}
+	seq = m.storeOps.wait(func() {
+		var err error
+		if prompts, err = m.store.ListPrompts(); err != nil {
+			fmt.Printf("读取共享状态失败: %v\n", err)
+		}
+	})
+	return prompts, seq
+}
+
+// reconcileShared 返回 listed 中由其他实例持有的 prompt，并移除已被其他实例删除或领取的本地等待 prompt。
+// 只处理最近一次写入早于 seq 的 prompt，之后的写入不在 listed 中，调用方需持有锁
+func (m *ComfyUIMock) reconcileShared(listed []*PromptInfo, seq uint64) []*PromptInfo {
+	if m.store == nil {
+		return nil
+	}
+	shared := make(map[string]*PromptInfo, len(listed))
+	remote := []*PromptInfo{}
+	for _, prompt := range listed {
+		shared[prompt.PromptID] = prompt
+		if _, local := m.prompts[prompt.PromptID]; !local {
+			remote = append(remote, prompt)
+		}
+	}
+
+	for _, prompt := range append([]*PromptInfo(nil), m.pending...) {
+		if prompt.savedSeq == 0 || prompt.savedSeq > seq {
+			continue
+		}
+		if current, ok := shared[prompt.PromptID]; ok && current.Status == "pending" {
+			continue
+		}
+		m.removePending(prompt)
+		delete(m.prompts, prompt.PromptID)
+		prompt.trace.finish("deleted", nil)
+		if current, ok := shared[prompt.PromptID]; ok {
+			remote = append(remote, current)
+		}
+	}
+	return remote
+}
+
+// claimShared 本地队列为空时领取其他实例等待中的 prompt，所属实例已退出的 prompt 也由此执行，领取到时返回 true。
+// 前置 prompt 的状态在其他实例上，带 depends_on 的 prompt 留给提交它的实例，不能在持有锁时调用
+func (m *ComfyUIMock) claimShared() bool {
+	listed, seq := m.sharedPrompts()
+	m.mu.Lock()
+	remote := m.reconcileShared(listed, seq)
+	m.mu.Unlock()
+
+	sort.Slice(remote, func(i, j int) bool { return remote[i].ID < remote[j].ID })
+	for _, prompt := range remote {
+		if prompt.Status != "pending" {
+			continue
+		}
+		if ids, _ := promptDependencies(prompt.ExtraData); len(ids) > 0 {
+			continue
+		}
+		if !m.claimPrompt(prompt) {
+			continue
+		}
+
+		m.mu.Lock()
+		if _, exists := m.prompts[prompt.PromptID]; !exists {
+			prompt.trace = startPromptTrace(context.Background(), prompt)
+			m.prompts[prompt.PromptID] = prompt
+			m.pending = append(m.pending, prompt)
+		}
+		m.mu.Unlock()
+		return true
+	}
+	return false
+}
+
+// lookupPrompt 先查本地，再查共享存储中其他实例提交的 prompt，返回的是当前状态的副本
+func (m *ComfyUIMock) lookupPrompt(promptID string) (*PromptInfo, bool) {
+	m.mu.Lock()
+	prompt, exists := m.prompts[promptID]
+	if exists {
+		// 返回副本，避免调用方读取时与执行中的 worker 竞争
+		snapshot := *prompt
+		prompt = &snapshot
+	}
+	m.mu.Unlock()
+
+	// 本地等待中的 prompt 可能已被其他实例领取执行
+	if m.store == nil || (exists && prompt.Status != "pending") {
+		return prompt, exists
+	}
+
+	shared, err := m.store.LoadPrompt(promptID)
+	if err != nil {
+		fmt.Printf("读取共享状态失败: %v\n", err)
+		return prompt, exists
+	}
+	if shared == nil || (exists && shared.Status == "pending") {
+		return prompt, exists
+	}
+	return shared, true
+}
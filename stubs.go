@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeStub 是未实现路由的固定响应，用于模拟自定义节点的 HTTP 扩展，如 /impact/...、/manager/...
+type routeStub struct {
+	Status      int               `json:"status,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	// Body 为 JSON 字符串时按文本返回，其他 JSON 值按 JSON 返回
+	Body json.RawMessage `json:"body,omitempty"`
+	File string          `json:"file,omitempty"`
+	Hits int             `json:"hits"`
+
+	method  string
+	pattern string
+	data    []byte
+}
+
+// routeStubs 保存 --stubs 和 /__mock/stubs 注册的桩，键为 "GET /impact/*" 这样的路由，省略方法时匹配所有方法
+type routeStubs struct {
+	mu    sync.Mutex
+	stubs map[string]*routeStub
+}
+
+func newRouteStubs() *routeStubs {
+	return &routeStubs{stubs: map[string]*routeStub{}}
+}
+
+// loadRouteStubs 读取 --stubs 配置，格式与 POST /__mock/stubs 相同，file 相对于配置文件所在目录
+func loadRouteStubs(file string) (map[string]*routeStub, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("读取桩配置失败: %w", err)
+	}
+	stubs := map[string]*routeStub{}
+	if err := json.Unmarshal(data, &stubs); err != nil {
+		return nil, fmt.Errorf("解析桩配置失败: %w", err)
+	}
+	if err := prepareRouteStubs(stubs, filepath.Dir(file)); err != nil {
+		return nil, err
+	}
+	return stubs, nil
+}
+
+// prepareRouteStubs 解析路由并读取响应体，file 为相对路径时相对于 dir
+func prepareRouteStubs(stubs map[string]*routeStub, dir string) error {
+	for route, stub := range stubs {
+		if stub == nil {
+			return fmt.Errorf("桩 %s 缺少响应", route)
+		}
+		stub.method, stub.pattern = "", route
+		if method, pattern, ok := strings.Cut(route, " "); ok {
+			stub.method, stub.pattern = strings.ToUpper(method), strings.TrimSpace(pattern)
+		}
+		if !strings.HasPrefix(stub.pattern, "/") {
+			return fmt.Errorf("桩的路由格式错误: %s", route)
+		}
+		if _, err := path.Match(stub.pattern, "/"); err != nil {
+			return fmt.Errorf("桩的路由格式错误: %s", route)
+		}
+		if stub.Status == 0 {
+			stub.Status = http.StatusOK
+		}
+		stub.Hits = 0
+
+		var text string
+		switch {
+		case stub.File != "":
+			file := stub.File
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(dir, file)
+			}
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("读取桩 %s 的响应失败: %w", route, err)
+			}
+			stub.data = content
+			if stub.ContentType == "" {
+				stub.ContentType = contentTypeFor(file)
+			}
+		case len(stub.Body) == 0:
+			stub.data = nil
+			if stub.ContentType == "" {
+				stub.ContentType = "text/plain; charset=utf-8"
+			}
+		case json.Unmarshal(stub.Body, &text) == nil:
+			stub.data = []byte(text)
+			if stub.ContentType == "" {
+				stub.ContentType = "text/plain; charset=utf-8"
+			}
+		default:
+			stub.data = stub.Body
+			if stub.ContentType == "" {
+				stub.ContentType = "application/json; charset=utf-8"
+			}
+		}
+	}
+	return nil
+}
+
+// contentTypeFor 按扩展名返回 Content-Type，未知扩展名按二进制处理
+func contentTypeFor(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		return "application/json; charset=utf-8"
+	case ".txt":
+		return "text/plain; charset=utf-8"
+	case ".html":
+		return "text/html; charset=utf-8"
+	case ".js":
+		return "application/javascript"
+	case ".png":
+		return "image/png"
+	}
+	return "application/octet-stream"
+}
+
+// matches 判断桩是否匹配请求。路由中的 * 与 path.Match 一致匹配一段路径，结尾的 /** 匹配任意多段
+func (s *routeStub) matches(method, requestPath string) bool {
+	if s.method != "" && s.method != method {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(s.pattern, "/**"); ok {
+		return requestPath == prefix || strings.HasPrefix(requestPath, prefix+"/")
+	}
+	matched, _ := path.Match(s.pattern, requestPath)
+	return matched
+}
+
+// specificity 用于在多个桩匹配同一请求时选择最具体的：指定了方法的优先，其次是通配符少的，最后是路由长的
+func (s *routeStub) specificity() (bool, int, int) {
+	return s.method != "", -strings.Count(s.pattern, "*"), len(s.pattern)
+}
+
+// match 返回匹配请求的最具体的桩，并记录命中次数
+func (r *routeStubs) match(method, requestPath string) (string, *routeStub) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var bestRoute string
+	var best *routeStub
+	for route, stub := range r.stubs {
+		if !stub.matches(method, requestPath) {
+			continue
+		}
+		if best == nil || moreSpecific(stub, best) || (!moreSpecific(best, stub) && route < bestRoute) {
+			bestRoute, best = route, stub
+		}
+	}
+	if best != nil {
+		best.Hits++
+	}
+	return bestRoute, best
+}
+
+func moreSpecific(a, b *routeStub) bool {
+	aMethod, aWildcards, aLength := a.specificity()
+	bMethod, bWildcards, bLength := b.specificity()
+	if aMethod != bMethod {
+		return aMethod
+	}
+	if aWildcards != bWildcards {
+		return aWildcards > bWildcards
+	}
+	return aLength > bLength
+}
+
+// serveStub 用注册的桩响应未实现的路由，没有匹配的桩时返回 false
+func (m *ComfyUIMock) serveStub(c *gin.Context) bool {
+	route, stub := m.stubs.match(c.Request.Method, c.Request.URL.Path)
+	if stub == nil {
+		return false
+	}
+	// 路由存在但方法不同时 gin 已经设置了 Allow 头
+	c.Writer.Header().Del("Allow")
+	for key, value := range stub.Headers {
+		c.Header(key, value)
+	}
+	c.Header("X-Mock-Stub", route)
+	c.Data(stub.Status, stub.ContentType, stub.data)
+	return true
+}
+
+// handleStubs 返回已注册的桩和命中次数
+func (m *ComfyUIMock) handleStubs(c *gin.Context) {
+	m.stubs.mu.Lock()
+	defer m.stubs.mu.Unlock()
+	c.JSON(http.StatusOK, m.stubs.stubs)
+}
+
+// handleStubsRegister 注册桩，请求体格式与 --stubs 配置相同，已存在的路由被替换，file 相对于 mock 的工作目录
+func (m *ComfyUIMock) handleStubsRegister(c *gin.Context) {
+	stubs := map[string]*routeStub{}
+	if err := c.ShouldBindJSON(&stubs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := prepareRouteStubs(stubs, "."); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	m.stubs.mu.Lock()
+	for route, stub := range stubs {
+		m.stubs.stubs[route] = stub
+	}
+	routes := make([]string, 0, len(m.stubs.stubs))
+	for route := range m.stubs.stubs {
+		routes = append(routes, route)
+	}
+	m.stubs.mu.Unlock()
+
+	sort.Strings(routes)
+	c.JSON(http.StatusOK, gin.H{"routes": routes})
+}
+
+// handleStubsRemove 删除 route 参数指定的桩，没有 route 参数时删除所有桩
+func (m *ComfyUIMock) handleStubsRemove(c *gin.Context) {
+	route, ok := c.GetQuery("route")
+
+	m.stubs.mu.Lock()
+	defer m.stubs.mu.Unlock()
+	if !ok {
+		m.stubs.stubs = map[string]*routeStub{}
+		c.Status(http.StatusNoContent)
+		return
+	}
+	if _, exists := m.stubs.stubs[route]; !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "stub not found: " + route})
+		return
+	}
+	delete(m.stubs.stubs, route)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errStuckReleased 是释放永不结束的 prompt 时的取消原因
+var errStuckReleased = errors.New("stuck task released")
+
+// errStuckInstalled 表示已经安装了永不结束的 prompt
+var errStuckInstalled = errors.New("a stuck task is already installed")
+
+// stuckNode 是永不结束的 prompt 停留的节点
+const stuckNode = "3"
+
+// stuckGraph 是永不结束的 prompt 的图，只有一个采样节点
+func stuckGraph() map[string]interface{} {
+	return map[string]interface{}{
+		stuckNode: map[string]interface{}{
+			"class_type": "KSampler",
+			"inputs": map[string]interface{}{
+				"seed":         0,
+				"steps":        20,
+				"cfg":          8,
+				"sampler_name": "euler",
+				"scheduler":    "normal",
+				"denoise":      1,
+			},
+		},
+	}
+}
+
+// hang 停在采样节点上直到被取消，不受 --prompt-timeout 限制
+func (m *ComfyUIMock) hang(ctx context.Context, prompt *PromptInfo) {
+	m.sendExecuting(prompt, stuckNode)
+	<-ctx.Done()
+}
+
+// handleStuck 安装一个永不结束的 prompt，以最高优先级排队，开始执行后一直占用队列，
+// 在 /queue 和 status 消息中与普通 prompt 相同，直到 DELETE /__mock/stuck 释放
+func (m *ComfyUIMock) handleStuck(c *gin.Context) {
+	var request struct {
+		ClientID string `json:"client_id"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var existing *PromptInfo
+	prompt, err := m.enqueuePromptWith(c.Request.Context(), request.ClientID, stuckGraph(), nil, math.MaxInt32, func(prompt *PromptInfo) error {
+		if m.stuck != nil && m.prompts[m.stuck.PromptID] == m.stuck {
+			existing = m.stuck
+			return errStuckInstalled
+		}
+		prompt.stuck = true
+		m.stuck = prompt
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "prompt_id": existing.PromptID})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"prompt_id": prompt.PromptID, "number": prompt.ID})
+}
+
+func (m *ComfyUIMock) handleStuckStatus(c *gin.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prompt := m.stuck
+	if prompt == nil || m.prompts[prompt.PromptID] != prompt {
+		c.JSON(http.StatusOK, gin.H{"installed": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"installed": true, "prompt_id": prompt.PromptID, "running": m.runningTask == prompt})
+}
+
+// handleStuckRelease 移除永不结束的 prompt，不留下 history，队列中的其他 prompt 继续执行
+func (m *ComfyUIMock) handleStuckRelease(c *gin.Context) {
+	m.mu.Lock()
+	prompt := m.stuck
+	if prompt == nil || m.prompts[prompt.PromptID] != prompt {
+		m.mu.Unlock()
+		c.JSON(http.StatusNotFound, gin.H{"error": "no stuck task installed"})
+		return
+	}
+	running := m.runningTask == prompt
+	if running {
+		m.cancelRunning(errStuckReleased)
+	} else {
+		m.removePending(prompt)
+	}
+	prompt.trace.finish("deleted", nil)
+	delete(m.prompts, prompt.PromptID)
+	m.unpersist(prompt.PromptID)
+	m.stuck = nil
+	m.mu.Unlock()
+
+	if running {
+		m.ws.send(prompt.ClientID, "executing", gin.H{"node": nil, "prompt_id": prompt.PromptID})
+	}
+	m.broadcastStatus()
+	m.notifyQueue()
+	c.JSON(http.StatusOK, gin.H{"prompt_id": prompt.PromptID, "was_running": running})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math/rand"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveTampered 按 --view-tamper-modes 随机选择一种方式返回损坏的文件，文件不存在时返回 false。
+// 响应带有 X-Mock-Tampered 头，便于测试确认客户端收到的是哪种损坏
+func serveTampered(c *gin.Context, path, modes string) bool {
+	data, err := readOutputFile(path)
+	if err != nil {
+		return false
+	}
+
+	candidates := []string{}
+	for _, mode := range strings.Split(modes, ",") {
+		if mode = strings.TrimSpace(mode); mode != "" {
+			candidates = append(candidates, mode)
+		}
+	}
+	if len(candidates) == 0 {
+		return false
+	}
+	mode := candidates[rand.Intn(len(candidates))]
+
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+
+	switch mode {
+	case "corrupt":
+		data = corruptData(data)
+	case "content-type":
+		contentType = "text/html; charset=utf-8"
+	case "empty":
+		data = nil
+	default:
+		return false
+	}
+
+	c.Header("X-Mock-Tampered", mode)
+	c.Data(http.StatusOK, contentType, data)
+	return true
+}
+
+// corruptData 保留 PNG/JPEG 的文件头让客户端按图片解析，截断到一半并破坏剩余的数据
+func corruptData(data []byte) []byte {
+	header := min(16, len(data))
+	corrupted := append([]byte(nil), data[:max(header, len(data)/2)]...)
+	for i := header; i < len(corrupted); i += 7 {
+		corrupted[i] ^= 0xFF
+	}
+	return corrupted
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responseTemplate 覆盖一个接口的响应，用于在 mock 发布新版本前模拟上游 ComfyUI 的协议变化
+type responseTemplate struct {
+	Template    string `json:"template"`
+	File        string `json:"file"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+
+	tmpl *template.Template
+}
+
+// templateData 是模板的输入，Response 是原始响应按 JSON 解析后的内容
+type templateData struct {
+	Method   string
+	Path     string
+	Params   map[string]string
+	Query    map[string]string
+	Request  interface{}
+	Status   int
+	Body     string
+	Response interface{}
+	Prompt   *PromptInfo
+	Now      time.Time
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// loadResponseTemplates 读取 --response-templates 配置，键为 "GET /history/:prompt_id" 这样的路由，
+// 省略方法时匹配所有方法。file 相对于配置文件所在目录
+func loadResponseTemplates(path string) (map[string]*responseTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应模板配置失败: %w", err)
+	}
+	templates := map[string]*responseTemplate{}
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("解析响应模板配置失败: %w", err)
+	}
+
+	for route, rt := range templates {
+		text := rt.Template
+		if rt.File != "" {
+			file := rt.File
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(filepath.Dir(path), file)
+			}
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("读取响应模板 %s 失败: %w", route, err)
+			}
+			text = string(content)
+		}
+		rt.tmpl, err = template.New(route).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("解析响应模板 %s 失败: %w", route, err)
+		}
+	}
+	return templates, nil
+}
+
+// templateWriter 缓存处理函数写出的响应，由模板生成最终的响应
+type templateWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *templateWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *templateWriter) WriteHeaderNow() {}
+
+func (w *templateWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *templateWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *templateWriter) Status() int {
+	return w.status
+}
+
+func (w *templateWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *templateWriter) Written() bool {
+	return false
+}
+
+// templateMiddleware 用模板替换匹配路由的响应体，模板执行失败时返回 500
+func (m *ComfyUIMock) templateMiddleware(templates map[string]*responseTemplate) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rt, ok := templates[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			rt, ok = templates[c.FullPath()]
+		}
+		if !ok || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		var requestBody []byte
+		if c.Request.Body != nil {
+			var err error
+			// 分块上传的请求体超过 --max-upload-size 时直接返回 413，不能把截断的请求体交给 handler
+			if requestBody, err = io.ReadAll(c.Request.Body); abortTooLarge(c, err) {
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(requestBody))
+		}
+
+		original := c.Writer
+		writer := &templateWriter{ResponseWriter: original, status: http.StatusOK}
+		c.Writer = writer
+		c.Next()
+		c.Writer = original
+
+		data := templateData{
+			Method: c.Request.Method,
+			Path:   c.Request.URL.Path,
+			Params: map[string]string{},
+			Query:  map[string]string{},
+			Status: writer.status,
+			Body:   writer.body.String(),
+			Now:    time.Now(),
+		}
+		for _, param := range c.Params {
+			data.Params[param.Key] = param.Value
+		}
+		for key, values := range c.Request.URL.Query() {
+			data.Query[key] = values[0]
+		}
+		json.Unmarshal(requestBody, &data.Request)
+		json.Unmarshal(writer.body.Bytes(), &data.Response)
+
+		promptID := data.Params["prompt_id"]
+		if response, ok := data.Response.(map[string]interface{}); ok && promptID == "" {
+			promptID, _ = response["prompt_id"].(string)
+		}
+		if promptID != "" {
+			data.Prompt, _ = m.lookupPrompt(promptID)
+		}
+
+		var out bytes.Buffer
+		if err := rt.tmpl.Execute(&out, data); err != nil {
+			original.Header().Del("Content-Length")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		status := writer.status
+		if rt.Status != 0 {
+			status = rt.Status
+		}
+		contentType := rt.ContentType
+		if contentType == "" {
+			contentType = original.Header().Get("Content-Type")
+		}
+		if contentType == "" {
+			contentType = "application/json; charset=utf-8"
+		}
+		original.Header().Del("Content-Length")
+		c.Data(status, contentType, out.Bytes())
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// previewOptions 是 /view 的 preview 参数，格式与 ComfyUI 一致为 "webp;90" 或 "jpeg;90"
+type previewOptions struct {
+	format  string
+	quality int
+}
+
+// previewQuery 返回 preview 参数。参数值中的分号通常不会被编码，Go 的查询解析会丢弃含分号的参数，因此直接从原始查询串中读取
+func previewQuery(c *gin.Context) (string, bool) {
+	for _, pair := range strings.Split(c.Request.URL.RawQuery, "&") {
+		key, value, _ := strings.Cut(pair, "=")
+		if key != "preview" {
+			continue
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		return value, true
+	}
+	return "", false
+}
+
+// parsePreview 解析 preview 参数，与 ComfyUI 一致，不支持的格式按 webp 处理，缺少质量时为 90
+func parsePreview(value string) previewOptions {
+	parts := strings.Split(value, ";")
+	options := previewOptions{format: parts[0], quality: 90}
+	if options.format != "webp" && options.format != "jpeg" {
+		options.format = "webp"
+	}
+	if len(parts) > 1 {
+		if quality, err := strconv.Atoi(parts[len(parts)-1]); err == nil && quality > 0 && quality <= 100 {
+			options.quality = quality
+		}
+	}
+	return options
+}
+
+// thumbnail 按区域平均缩小图片，使长边不超过 size，图片本身更小时原样返回
+func thumbnail(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if size <= 0 || (width <= size && height <= size) {
+		return src
+	}
+	scale := float64(size) / float64(max(width, height))
+	dstWidth, dstHeight := max(int(float64(width)*scale), 1), max(int(float64(height)*scale), 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0, y1 := y*height/dstHeight, max((y+1)*height/dstHeight, y*height/dstHeight+1)
+		for x := 0; x < dstWidth; x++ {
+			x0, x1 := x*width/dstWidth, max((x+1)*width/dstWidth, x*width/dstWidth+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / n >> 8)
+			dst.Pix[offset+1] = uint8(g / n >> 8)
+			dst.Pix[offset+2] = uint8(b / n >> 8)
+			dst.Pix[offset+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
+
+// servePreview 按 preview 参数返回重新编码的图片，开启 --thumbnails 时同时缩小为缩略图。
+// 文件不是图片时返回 false，由调用方按原文件返回
+func (m *ComfyUIMock) servePreview(c *gin.Context, path string, options previewOptions) bool {
+	data, err := readOutputFile(path)
+	if err != nil {
+		return false
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	if m.cfg.Thumbnails {
+		img = thumbnail(img, m.cfg.ThumbnailSize)
+	}
+
+	var buf bytes.Buffer
+	format := imageFormat{ext: ".webp"}
+	contentType := "image/webp"
+	if options.format == "jpeg" {
+		format = imageFormat{ext: ".jpg", quality: options.quality}
+		contentType = "image/jpeg"
+	}
+	if err := encodeImage(&buf, img, format); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("filename=%q", filepath.Base(path)))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+	return true
+}
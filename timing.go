@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// processingTime 优先使用脚本指定的时间，否则在 --min-processing 和 --max-processing 之间选择处理时间，deterministic 模式下由 workflow 哈希决定
+func (m *ComfyUIMock) processingTime(prompt *PromptInfo) time.Duration {
+	if prompt.script.processing > 0 {
+		return prompt.script.processing
+	}
+	span := int64(m.cfg.MaxProcessing-m.cfg.MinProcessing) + 1
+	if m.cfg.Deterministic {
+		return m.cfg.MinProcessing + time.Duration(workflowHash(prompt.Prompt)%uint64(span))
+	}
+	return m.cfg.MinProcessing + time.Duration(rand.Int63n(span))
+}
+
+// expectedProcessing 估算 processingTime 的结果：on_submit 脚本指定或 --deterministic 时与实际执行一致，随机时为范围的均值。
+// 配置了节点权重时各节点的耗时之和仍为 processingTime
+func (m *ComfyUIMock) expectedProcessing(prompt *PromptInfo) time.Duration {
+	if prompt.script.processing > 0 || m.cfg.Deterministic {
+		return m.processingTime(prompt)
+	}
+	return (m.cfg.MinProcessing + m.cfg.MaxProcessing) / 2
+}
+
+// parseNodeWeights 解析 "KSampler=80,VAEDecode=15,*=1" 形式的节点耗时权重，"*" 为未列出节点的权重
+func parseNodeWeights(spec string) (map[string]float64, error) {
+	weights := map[string]float64{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		classType, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("节点权重格式错误: %s", item)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("节点权重格式错误: %s", item)
+		}
+		weights[strings.TrimSpace(classType)] = weight
+	}
+	return weights, nil
+}
+
+// nodeDurations 按权重把总处理时间分配到各节点，未配置权重时返回 nil
+func (m *ComfyUIMock) nodeDurations(graph map[string]interface{}, total time.Duration) map[string]time.Duration {
+	if len(m.nodeWeights) == 0 {
+		return nil
+	}
+
+	weights := map[string]float64{}
+	sum := 0.0
+	for _, nodeID := range sortedNodeIDs(graph) {
+		classType, _ := graph[nodeID].(map[string]interface{})["class_type"].(string)
+		weight, ok := m.nodeWeights[classType]
+		if !ok {
+			weight = m.nodeWeights["*"]
+		}
+		weights[nodeID] = weight
+		sum += weight
+	}
+	if sum == 0 {
+		return nil
+	}
+
+	durations := map[string]time.Duration{}
+	for nodeID, weight := range weights {
+		durations[nodeID] = time.Duration(float64(total) * weight / sum)
+	}
+	return durations
+}
+
+// executionOrder 按依赖关系返回节点的执行顺序，上游节点在前
+func executionOrder(graph map[string]interface{}) []string {
+	order := []string{}
+	visited := map[string]bool{}
+
+	var visit func(nodeID string)
+	visit = func(nodeID string) {
+		if visited[nodeID] {
+			return
+		}
+		visited[nodeID] = true
+
+		node, _ := graph[nodeID].(map[string]interface{})
+		inputs, _ := node["inputs"].(map[string]interface{})
+		for _, name := range sortedKeys(inputs) {
+			if link, ok := inputs[name].([]interface{}); ok && len(link) == 2 {
+				if _, exists := graph[fmt.Sprint(link[0])]; exists {
+					visit(fmt.Sprint(link[0]))
+				}
+			}
+		}
+		order = append(order, nodeID)
+	}
+
+	for _, nodeID := range sortedNodeIDs(graph) {
+		visit(nodeID)
+	}
+	return order
+}
+
+// isOutputNode 判断节点是否会在 history 中产生 output
+func isOutputNode(node interface{}) bool {
+	classType, _ := node.(map[string]interface{})["class_type"].(string)
+	if _, ok := outputGenerators[classType]; ok {
+		return true
+	}
+	return classType == "SaveImage" || classType == "SaveImageWebsocket"
+}
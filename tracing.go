@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/nofrish/mock-comfy")
+
+// initTracing 配置 OTLP 导出，未配置 endpoint 时使用默认的 noop tracer
+func initTracing(endpoint string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if endpoint == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracehttp.Option{}
+	if endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("创建 OTLP 导出器失败: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "mock-comfy"))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// tracingMiddleware 从 traceparent 等请求头中恢复上游 trace，并为每个请求创建 server span
+func tracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		ctx, span := tracer.Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", c.Request.URL.Path),
+			),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, "")
+		}
+	}
+}
+
+// promptTrace 记录一个 prompt 从入队到完成的 span
+type promptTrace struct {
+	ctx       context.Context
+	span      trace.Span
+	queueSpan trace.Span
+}
+
+func startPromptTrace(ctx context.Context, prompt *PromptInfo) *promptTrace {
+	ctx, span := tracer.Start(ctx, "comfyui.prompt", trace.WithAttributes(
+		attribute.String("comfyui.prompt_id", prompt.PromptID),
+		attribute.String("comfyui.client_id", prompt.ClientID),
+		attribute.Int("comfyui.number", prompt.ID),
+	))
+	_, queueSpan := tracer.Start(ctx, "comfyui.queue_wait")
+	return &promptTrace{ctx: ctx, span: span, queueSpan: queueSpan}
+}
+
+// dequeued 在 prompt 开始执行时结束排队 span
+func (t *promptTrace) dequeued() {
+	if t == nil {
+		return
+	}
+	t.queueSpan.End()
+}
+
+func (t *promptTrace) startExecute() (context.Context, trace.Span) {
+	if t == nil {
+		return tracer.Start(context.Background(), "comfyui.execute")
+	}
+	return tracer.Start(t.ctx, "comfyui.execute")
+}
+
+// finish 结束整个 prompt 的 span，status 为 prompt 的最终状态
+func (t *promptTrace) finish(status string, err map[string]interface{}) {
+	if t == nil {
+		return
+	}
+
+	t.queueSpan.End()
+	t.span.SetAttributes(attribute.String("comfyui.status", status))
+	if err != nil {
+		message, _ := err["exception_message"].(string)
+		t.span.SetStatus(codes.Error, message)
+	}
+	t.span.End()
+}
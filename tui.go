@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tuiRefresh 是终端界面的刷新间隔
+const tuiRefresh = 500 * time.Millisecond
+
+// tuiRecent 是界面中显示的最近完成的 prompt 和日志行数
+const tuiRecent = 8
+
+// runTUI 用 ANSI 控制字符在终端中定期重绘队列、正在执行的 prompt、最近完成的 prompt 和日志，
+// 开启后不再输出 gin 的请求日志
+func (m *ComfyUIMock) runTUI() {
+	ticker := time.NewTicker(tuiRefresh)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		fmt.Fprint(os.Stdout, "\033[H\033[2J"+m.renderTUI(time.Now()))
+	}
+}
+
+func (m *ComfyUIMock) renderTUI(now time.Time) string {
+	var b strings.Builder
+
+	m.mu.Lock()
+	pending := len(m.pending)
+	running := m.runningTask
+	var runningID, runningClient string
+	var elapsed time.Duration
+	if running != nil {
+		runningID, runningClient = running.PromptID, running.ClientID
+		elapsed = now.Sub(running.started)
+	}
+	finished := []*PromptInfo{}
+	for _, prompt := range m.prompts {
+		if prompt.Status == "completed" || prompt.Status == "failed" {
+			finished = append(finished, prompt)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].FinishedAt.After(finished[j].FinishedAt) })
+	if len(finished) > tuiRecent {
+		finished = finished[:tuiRecent]
+	}
+	recent := make([]string, 0, len(finished))
+	for _, prompt := range finished {
+		recent = append(recent, fmt.Sprintf("  %s  %-9s %s  %6.1fs",
+			prompt.FinishedAt.Format("15:04:05"), prompt.Status, prompt.PromptID, prompt.FinishedAt.Sub(prompt.started).Seconds()))
+	}
+	paused := m.resumed != nil
+	vramUsed := m.vramUsed
+	m.mu.Unlock()
+
+	state := "running"
+	if paused {
+		state = "paused"
+	}
+	fmt.Fprintf(&b, "\033[1mmock-comfy\033[0m  %s  uptime %s  %s\n\n", m.cfg.Addr, now.Sub(m.launchedAt).Truncate(time.Second), state)
+	fmt.Fprintf(&b, "queue pending: %d   clients: %d   vram: %d / %d MiB\n\n", pending, m.ws.count(), vramUsed/mib, m.cfg.VRAMTotalMB)
+
+	b.WriteString("\033[1mrunning\033[0m\n")
+	if running == nil {
+		b.WriteString("  idle\n")
+	} else {
+		// 按处理时间的均值估算进度，与 /__mock/queue/eta 一致
+		expected := (m.cfg.MinProcessing + m.cfg.MaxProcessing) / 2
+		progress := 1.0
+		if expected > 0 {
+			progress = min(elapsed.Seconds()/expected.Seconds(), 1)
+		}
+		const width = 30
+		filled := int(progress * width)
+		fmt.Fprintf(&b, "  %s  client %s\n  [%s%s] %3.0f%%  %.1fs\n", runningID, runningClient,
+			strings.Repeat("#", filled), strings.Repeat("-", width-filled), progress*100, elapsed.Seconds())
+	}
+
+	b.WriteString("\n\033[1mrecent\033[0m\n")
+	if len(recent) == 0 {
+		b.WriteString("  -\n")
+	}
+	for _, line := range recent {
+		b.WriteString(line + "\n")
+	}
+
+	b.WriteString("\n\033[1mlog\033[0m\n")
+	m.logs.mu.Lock()
+	entries := m.logs.entries[max(len(m.logs.entries)-tuiRecent, 0):]
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "  %s  %s", entry.T[11:19], entry.M)
+	}
+	m.logs.mu.Unlock()
+	return b.String()
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// typeDir 返回 ComfyUI 文件类型对应的目录
+func typeDir(fileType string) (string, bool) {
+	switch fileType {
+	case "", "input":
+		return inputDir, true
+	case "temp":
+		return tempDir, true
+	case "output":
+		return outputDir, true
+	}
+	return "", false
+}
+
+// resolveFilePath 按文件类型拼接路径并防止目录穿越
+func resolveFilePath(fileType, subfolder, filename string) (string, error) {
+	baseDir, ok := typeDir(fileType)
+	if !ok {
+		return "", fmt.Errorf("invalid type: %s", fileType)
+	}
+
+	dir := filepath.Join(baseDir, filepath.FromSlash(subfolder))
+	path := filepath.Join(dir, filepath.Base(filename))
+	if !strings.HasPrefix(filepath.Clean(path), filepath.Clean(baseDir)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("invalid path")
+	}
+	return path, nil
+}
+
+// uniquePath 与 ComfyUI 一致，文件已存在时依次尝试 "name (1).ext"、"name (2).ext"
+func uniquePath(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+func isOverwrite(value string) bool {
+	return value == "true" || value == "1"
+}
+
+func saveUploadedFile(file *multipart.FileHeader, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("创建上传目录失败: %w", err)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("打开上传文件失败: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建目标文件失败: %w", err)
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		return fmt.Errorf("写入上传文件失败: %w", err)
+	}
+	return nil
+}
+
+func (m *ComfyUIMock) handleUploadImage(c *gin.Context) {
+	file, err := c.FormFile("image")
+	if err != nil {
+		if abortTooLarge(c, err) {
+			return
+		}
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	fileType := c.PostForm("type")
+	subfolder := c.PostForm("subfolder")
+	path, err := resolveFilePath(fileType, subfolder, file.Filename)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	if !isOverwrite(c.PostForm("overwrite")) {
+		path = uniquePath(path)
+	}
+
+	if m.diskFull(file.Size) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": noSpaceError(path)})
+		return
+	}
+	if err := disk.track(path, func() error { return saveUploadedFile(file, path) }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":      filepath.Base(path),
+		"subfolder": subfolder,
+		"type":      uploadType(fileType),
+	})
+}
+
+func (m *ComfyUIMock) handleUploadMask(c *gin.Context) {
+	file, err := c.FormFile("image")
+	if err != nil {
+		if abortTooLarge(c, err) {
+			return
+		}
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var originalRef struct {
+		Filename  string `json:"filename"`
+		Subfolder string `json:"subfolder"`
+		Type      string `json:"type"`
+	}
+	if err := json.Unmarshal([]byte(c.PostForm("original_ref")), &originalRef); err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	originalPath, err := resolveFilePath(originalRef.Type, originalRef.Subfolder, originalRef.Filename)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	// 遮罩默认保存到 clipspace 子目录，与前端的 clipspace 保持一致
+	fileType := c.PostForm("type")
+	subfolder := c.DefaultPostForm("subfolder", "clipspace")
+	path, err := resolveFilePath(fileType, subfolder, file.Filename)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	if !isOverwrite(c.PostForm("overwrite")) {
+		path = uniquePath(path)
+	}
+
+	if m.diskFull(file.Size) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": noSpaceError(path)})
+		return
+	}
+	if err := disk.track(path, func() error { return applyMask(originalPath, file, path) }); err != nil {
+		if os.IsNotExist(err) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":      filepath.Base(path),
+		"subfolder": subfolder,
+		"type":      uploadType(fileType),
+	})
+}
+
+func uploadType(fileType string) string {
+	if fileType == "" {
+		return "input"
+	}
+	return fileType
+}
+
+// applyMask 将遮罩的 alpha 通道合成到原图上，保存为 PNG
+func applyMask(originalPath string, maskFile *multipart.FileHeader, destPath string) error {
+	originalFile, err := os.Open(originalPath)
+	if err != nil {
+		return err
+	}
+	defer originalFile.Close()
+
+	original, _, err := image.Decode(originalFile)
+	if err != nil {
+		return fmt.Errorf("解码原图失败: %w", err)
+	}
+
+	src, err := maskFile.Open()
+	if err != nil {
+		return fmt.Errorf("打开遮罩文件失败: %w", err)
+	}
+	defer src.Close()
+
+	mask, _, err := image.Decode(src)
+	if err != nil {
+		return fmt.Errorf("解码遮罩失败: %w", err)
+	}
+
+	bounds := original.Bounds()
+	result := image.NewNRGBA(bounds)
+	draw.Draw(result, bounds, original, bounds.Min, draw.Src)
+	maskBounds := mask.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			mx := maskBounds.Min.X + x - bounds.Min.X
+			my := maskBounds.Min.Y + y - bounds.Min.Y
+			if mx >= maskBounds.Max.X || my >= maskBounds.Max.Y {
+				continue
+			}
+			alpha := color.NRGBAModel.Convert(mask.At(mx, my)).(color.NRGBA).A
+			result.Pix[result.PixOffset(x, y)+3] = alpha
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), os.ModePerm); err != nil {
+		return fmt.Errorf("创建上传目录失败: %w", err)
+	}
+
+	dst, err := os.Create(destPath)
+	if err != nil {
+		return fmt.Errorf("创建目标文件失败: %w", err)
+	}
+	defer dst.Close()
+
+	if err := png.Encode(dst, result); err != nil {
+		return fmt.Errorf("保存遮罩图片失败: %w", err)
+	}
+	return nil
+}
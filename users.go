@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// usersMu 保护 users.json 的读写，用户目录下的文件由各自的请求直接读写
+var usersMu sync.Mutex
+
+var unsafeUsername = regexp.MustCompile(`[^a-zA-Z0-9-_]+`)
+
+// loadUsers 读取 user 目录下 ComfyUI 格式的 users.json，即 user_id 到用户名的映射
+func loadUsers() (map[string]string, error) {
+	users := map[string]string{}
+	data, err := os.ReadFile(filepath.Join(userDir, "users.json"))
+	if os.IsNotExist(err) {
+		return users, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取 users.json 失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("解析 users.json 失败: %w", err)
+	}
+	return users, nil
+}
+
+// requestUser 与 ComfyUI 一致，单用户模式下总是 default，多用户模式下由 comfy-user 请求头指定
+func (m *ComfyUIMock) requestUser(c *gin.Context) (string, error) {
+	if !m.cfg.MultiUser {
+		return "default", nil
+	}
+	user := c.GetHeader("comfy-user")
+	if user == "" {
+		user = "default"
+	}
+
+	usersMu.Lock()
+	users, err := loadUsers()
+	usersMu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	if _, ok := users[user]; !ok {
+		return "", fmt.Errorf("Unknown user: %s", user)
+	}
+	return user, nil
+}
+
+// userFilePath 返回当前用户目录下的文件路径并防止目录穿越，file 为空时返回用户目录
+func (m *ComfyUIMock) userFilePath(c *gin.Context, file string) (string, bool) {
+	user, err := m.requestUser(c)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return "", false
+	}
+	base := filepath.Join(userDir, user)
+	path := filepath.Join(base, filepath.FromSlash(file))
+	if path != base && !strings.HasPrefix(path, base+string(os.PathSeparator)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid path"})
+		return "", false
+	}
+	return path, true
+}
+
+// userFileInfo 返回 full_info=true 时的文件信息，path 相对于用户目录
+func userFileInfo(base, path string) (gin.H, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"path":     filepath.ToSlash(rel),
+		"size":     info.Size(),
+		"modified": float64(info.ModTime().UnixMilli()),
+	}, nil
+}
+
+func (m *ComfyUIMock) handleUsers(c *gin.Context) {
+	usersMu.Lock()
+	users, err := loadUsers()
+	usersMu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if m.cfg.MultiUser {
+		c.JSON(http.StatusOK, gin.H{"storage": "server", "users": users})
+		return
+	}
+	_, err = os.Stat(filepath.Join(userDir, "default"))
+	c.JSON(http.StatusOK, gin.H{"storage": "server", "migrated": err == nil})
+}
+
+func (m *ComfyUIMock) handleUserCreate(c *gin.Context) {
+	var request struct {
+		Username string `json:"username"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	username := strings.TrimSpace(request.Username)
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username not provided"})
+		return
+	}
+
+	usersMu.Lock()
+	defer usersMu.Unlock()
+
+	users, err := loadUsers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, existing := range users {
+		if existing == username {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Duplicate username."})
+			return
+		}
+	}
+
+	userID := unsafeUsername.ReplaceAllString(username, "-") + "_" + uuid.New().String()
+	users[userID] = username
+	data, err := json.Marshal(users)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(userDir, "users.json"), data, 0644)
+	}
+	if err == nil {
+		err = os.MkdirAll(filepath.Join(userDir, userID), os.ModePerm)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, userID)
+}
+
+// handleUserdataList 列出用户目录下 dir 中的文件，支持 recurse、full_info 和 split
+func (m *ComfyUIMock) handleUserdataList(c *gin.Context) {
+	dir := c.Query("dir")
+	if dir == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dir is required"})
+		return
+	}
+	base, ok := m.userFilePath(c, "")
+	if !ok {
+		return
+	}
+	root, ok := m.userFilePath(c, dir)
+	if !ok {
+		return
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "directory not found"})
+		return
+	}
+
+	recurse := isOverwrite(c.Query("recurse"))
+	fullInfo := isOverwrite(c.Query("full_info"))
+	split := isOverwrite(c.Query("split"))
+
+	paths := []string{}
+	err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != root && !recurse {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sort.Strings(paths)
+
+	results := make([]interface{}, 0, len(paths))
+	for _, path := range paths {
+		if fullInfo {
+			info, err := userFileInfo(base, path)
+			if err != nil {
+				continue
+			}
+			// full_info 的 path 相对于 dir
+			rel, _ := filepath.Rel(root, path)
+			info["path"] = filepath.ToSlash(rel)
+			results = append(results, info)
+			continue
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		if split {
+			parts := []interface{}{rel}
+			for _, part := range strings.Split(rel, "/") {
+				parts = append(parts, part)
+			}
+			results = append(results, parts)
+			continue
+		}
+		results = append(results, rel)
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// handleUserdata 处理 /userdata/{file} 和 /userdata/{file}/move/{dest}，file 中的 / 由客户端编码为 %2F
+func (m *ComfyUIMock) handleUserdata(c *gin.Context) {
+	file := strings.TrimPrefix(c.Param("file"), "/")
+	if source, dest, ok := strings.Cut(file, "/move/"); ok && c.Request.Method == http.MethodPost {
+		m.moveUserdata(c, source, dest)
+		return
+	}
+	if file == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	path, ok := m.userFilePath(c, file)
+	if !ok {
+		return
+	}
+
+	switch c.Request.Method {
+	case http.MethodGet:
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+			return
+		}
+		c.File(path)
+
+	case http.MethodPost:
+		if _, err := os.Stat(path); err == nil && c.Query("overwrite") == "false" {
+			c.JSON(http.StatusConflict, gin.H{"error": "File already exists"})
+			return
+		}
+		data, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			if abortTooLarge(c, err) {
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		m.userdataResponse(c, path)
+
+	case http.MethodDelete:
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+			return
+		}
+		if err := os.Remove(path); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func (m *ComfyUIMock) moveUserdata(c *gin.Context, source, dest string) {
+	sourcePath, ok := m.userFilePath(c, source)
+	if !ok {
+		return
+	}
+	destPath, ok := m.userFilePath(c, dest)
+	if !ok {
+		return
+	}
+	if _, err := os.Stat(sourcePath); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	if _, err := os.Stat(destPath); err == nil && c.Query("overwrite") == "false" {
+		c.JSON(http.StatusConflict, gin.H{"error": "File already exists"})
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), os.ModePerm); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := os.Rename(sourcePath, destPath); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	m.userdataResponse(c, destPath)
+}
+
+// userdataResponse 返回保存后的路径，full_info=true 时返回文件信息
+func (m *ComfyUIMock) userdataResponse(c *gin.Context, path string) {
+	base, ok := m.userFilePath(c, "")
+	if !ok {
+		return
+	}
+	info, err := userFileInfo(base, path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if isOverwrite(c.Query("full_info")) {
+		c.JSON(http.StatusOK, info)
+		return
+	}
+	c.JSON(http.StatusOK, info["path"])
+}
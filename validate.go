@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func validationError(errType, message, details string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       errType,
+		"message":    message,
+		"details":    details,
+		"extra_info": map[string]interface{}{},
+	}
+}
+
+func inputError(errType, message, details, inputName string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       errType,
+		"message":    message,
+		"details":    details,
+		"extra_info": map[string]interface{}{"input_name": inputName},
+	}
+}
+
+// validatePrompt 按 object_info 检查 prompt 的结构，返回值与 ComfyUI /prompt 的 error 和 node_errors 格式一致
+func validatePrompt(graph map[string]interface{}, objectInfo map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	nodeErrors := map[string]interface{}{}
+
+	outputNodes := []string{}
+	for _, nodeID := range sortedNodeIDs(graph) {
+		node, _ := graph[nodeID].(map[string]interface{})
+		classType, ok := node["class_type"].(string)
+		if !ok {
+			return validationError("invalid_prompt",
+				"Cannot execute because a node is missing the class_type property.",
+				fmt.Sprintf("Node ID '#%s'", nodeID)), nodeErrors
+		}
+
+		info, ok := objectInfo[classType].(map[string]interface{})
+		if !ok {
+			return validationError("invalid_prompt",
+				fmt.Sprintf("Cannot execute because node %s does not exist.", classType),
+				fmt.Sprintf("Node ID '#%s'", nodeID)), nodeErrors
+		}
+		if isOutput, _ := info["output_node"].(bool); isOutput {
+			outputNodes = append(outputNodes, nodeID)
+		}
+	}
+
+	if len(outputNodes) == 0 {
+		return validationError("prompt_no_outputs", "Prompt has no outputs", ""), nodeErrors
+	}
+
+	for _, nodeID := range sortedNodeIDs(graph) {
+		node := graph[nodeID].(map[string]interface{})
+		classType := node["class_type"].(string)
+		errors := validateNodeInputs(graph, node, objectInfo[classType].(map[string]interface{}), objectInfo)
+		if len(errors) == 0 {
+			continue
+		}
+
+		dependentOutputs := []string{}
+		for _, outputID := range outputNodes {
+			if upstreamNodes(graph, outputID)[nodeID] {
+				dependentOutputs = append(dependentOutputs, outputID)
+			}
+		}
+		nodeErrors[nodeID] = map[string]interface{}{
+			"errors":            errors,
+			"dependent_outputs": dependentOutputs,
+			"class_type":        classType,
+		}
+	}
+
+	if len(nodeErrors) > 0 {
+		return validationError("prompt_outputs_failed_validation", "Prompt outputs failed validation", ""), nodeErrors
+	}
+	return nil, nodeErrors
+}
+
+func validateNodeInputs(graph, node, info, objectInfo map[string]interface{}) []map[string]interface{} {
+	inputs, _ := node["inputs"].(map[string]interface{})
+	infoInputs, _ := info["input"].(map[string]interface{})
+	required, _ := infoInputs["required"].(map[string]interface{})
+	optional, _ := infoInputs["optional"].(map[string]interface{})
+
+	errors := []map[string]interface{}{}
+	for _, name := range sortedKeys(required) {
+		if _, ok := inputs[name]; !ok {
+			errors = append(errors, inputError("required_input_missing", "Required input is missing", name, name))
+			continue
+		}
+		if err := validateInput(graph, objectInfo, name, inputs[name], required[name]); err != nil {
+			errors = append(errors, err)
+		}
+	}
+	for _, name := range sortedKeys(optional) {
+		if value, ok := inputs[name]; ok {
+			if err := validateInput(graph, objectInfo, name, value, optional[name]); err != nil {
+				errors = append(errors, err)
+			}
+		}
+	}
+	return errors
+}
+
+func validateInput(graph, objectInfo map[string]interface{}, name string, value, spec interface{}) map[string]interface{} {
+	if _, ok := value.([]interface{}); ok {
+		return validateLink(graph, objectInfo, name, value, spec)
+	}
+	if isImageUpload(spec) {
+		return validateImageInput(name, value)
+	}
+	return validateValue(name, value, spec)
+}
+
+// validateValue 与 ComfyUI 一致检查控件的值：INT 和 FLOAT 能否转换为数字、是否在 min 和 max 之间，
+// 下拉框的值是否在选项中。STRING 和 BOOLEAN 在 ComfyUI 中任何值都能转换，不检查
+func validateValue(name string, value, spec interface{}) map[string]interface{} {
+	specList, _ := spec.([]interface{})
+	if len(specList) == 0 {
+		return nil
+	}
+	var options map[string]interface{}
+	if len(specList) > 1 {
+		options, _ = specList[1].(map[string]interface{})
+	}
+
+	inputType, _ := specList[0].(string)
+	choices, isCombo := specList[0].([]interface{})
+	if inputType == "COMBO" {
+		choices, isCombo = options["options"].([]interface{})
+	}
+	if isCombo {
+		for _, choice := range choices {
+			if choice == value {
+				return nil
+			}
+		}
+		return inputError("value_not_in_list", "Value not in list",
+			fmt.Sprintf("%s: '%v' not in %v", name, value, choices), name)
+	}
+
+	if inputType != "INT" && inputType != "FLOAT" {
+		return nil
+	}
+	number, ok := numericValue(value, inputType == "INT")
+	if !ok {
+		return inputError("invalid_input_type", fmt.Sprintf("Failed to convert an input value to a %s value", inputType),
+			fmt.Sprintf("%s, %v", name, value), name)
+	}
+	if minValue, ok := options["min"].(float64); ok && number < minValue {
+		return inputError("value_smaller_than_min", fmt.Sprintf("Value %v smaller than min of %v", number, minValue), name, name)
+	}
+	if maxValue, ok := options["max"].(float64); ok && number > maxValue {
+		return inputError("value_bigger_than_max", fmt.Sprintf("Value %v bigger than max of %v", number, maxValue), name, name)
+	}
+	return nil
+}
+
+// numericValue 模拟 Python 的 int() 和 float() 转换，布尔值和数字字符串也可以转换，int() 会截断小数
+func numericValue(value interface{}, integer bool) (float64, bool) {
+	var number float64
+	switch v := value.(type) {
+	case float64:
+		number = v
+	case bool:
+		if v {
+			number = 1
+		}
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, false
+		}
+		// Python 的 int("1.5") 会失败
+		if integer && strings.ContainsAny(v, ".eE") {
+			return 0, false
+		}
+		number = parsed
+	default:
+		return 0, false
+	}
+	if integer {
+		number = math.Trunc(number)
+	}
+	return number, true
+}
+
+// validateLink 检查 [node_id, slot_index] 形式的连线是否指向存在的节点，且输出类型匹配
+func validateLink(graph, objectInfo map[string]interface{}, name string, value, spec interface{}) map[string]interface{} {
+	link, _ := value.([]interface{})
+
+	if len(link) != 2 {
+		return inputError("bad_linked_input", "Bad linked input, must be a length-2 list of [node_id, slot_index]", name, name)
+	}
+
+	sourceID := fmt.Sprint(link[0])
+	source, ok := graph[sourceID].(map[string]interface{})
+	if !ok {
+		return inputError("bad_linked_input", "Linked node does not exist",
+			fmt.Sprintf("%s, linked node '#%s' does not exist", name, sourceID), name)
+	}
+	slot, ok := link[1].(float64)
+	if !ok {
+		return inputError("bad_linked_input", "Bad linked input, must be a length-2 list of [node_id, slot_index]", name, name)
+	}
+
+	specList, _ := spec.([]interface{})
+	if len(specList) == 0 {
+		return nil
+	}
+	expected, ok := specList[0].(string)
+	if !ok {
+		return nil
+	}
+
+	sourceClass, _ := source["class_type"].(string)
+	sourceInfo, _ := objectInfo[sourceClass].(map[string]interface{})
+	outputs, _ := sourceInfo["output"].([]interface{})
+	if int(slot) < 0 || int(slot) >= len(outputs) {
+		return inputError("bad_linked_input", "Linked output slot does not exist",
+			fmt.Sprintf("%s, slot %d of '#%s'", name, int(slot), sourceID), name)
+	}
+
+	received, _ := outputs[int(slot)].(string)
+	if received != expected && received != "*" && expected != "*" {
+		return inputError("return_type_mismatch", "Return type mismatch between linked nodes",
+			fmt.Sprintf("%s, received_type(%s) mismatch input_type(%s)", name, received, expected), name)
+	}
+	return nil
+}
+
+// upstreamNodes 返回节点及其所有上游节点
+func upstreamNodes(graph map[string]interface{}, nodeID string) map[string]bool {
+	seen := map[string]bool{}
+	stack := []string{nodeID}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		node, _ := graph[id].(map[string]interface{})
+		inputs, _ := node["inputs"].(map[string]interface{})
+		for _, value := range inputs {
+			if link, ok := value.([]interface{}); ok && len(link) == 2 {
+				if _, exists := graph[fmt.Sprint(link[0])]; exists {
+					stack = append(stack, fmt.Sprint(link[0]))
+				}
+			}
+		}
+	}
+	return seen
+}
+
+func (m *ComfyUIMock) handleValidate(c *gin.Context) {
+	var body map[string]interface{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	graph := body
+	if prompt, ok := body["prompt"].(map[string]interface{}); ok {
+		graph = prompt
+	}
+
+	validationErr, nodeErrors := validatePrompt(graph, m.currentObjectInfo())
+	if validationErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErr, "node_errors": nodeErrors})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"valid": true, "node_errors": nodeErrors})
+}
+
+// runValidate 离线检查 workflow 文件，有错误时返回非零退出码
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	objectInfoPath := fs.String("object-info", "resources/object_info.json", "object_info JSON 文件")
+	customNodes := fs.String("custom-nodes", "", "逗号分隔的自定义节点定义 JSON 文件或目录，合并到 object_info 中")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("用法: mock-comfy validate [--object-info file] workflow.json ...")
+	}
+
+	objectInfo, err := loadObjectInfo(*objectInfoPath, *customNodes)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, path := range fs.Args() {
+		graph, err := loadWorkflow(path)
+		if err != nil {
+			return err
+		}
+
+		validationErr, nodeErrors := validatePrompt(graph, objectInfo)
+		if validationErr == nil {
+			fmt.Printf("%s: OK\n", path)
+			continue
+		}
+
+		failed++
+		report, _ := json.MarshalIndent(gin.H{"error": validationErr, "node_errors": nodeErrors}, "", "  ")
+		fmt.Printf("%s:\n%s\n", path, report)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d 个 workflow 校验失败", failed)
+	}
+	return nil
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"math"
+	"path/filepath"
+)
+
+const (
+	videoFrameCount = 16
+	videoMaxWidth   = 256
+)
+
+// videoCombineOutput 模拟 VideoHelperSuite 的 VHS_VideoCombine 节点
+func videoCombineOutput(prompt *PromptInfo, nodeID string, node map[string]interface{}) (map[string]interface{}, error) {
+	inputs, _ := node["inputs"].(map[string]interface{})
+
+	frameRate := 8.0
+	if value, ok := inputs["frame_rate"].(float64); ok && value > 0 {
+		frameRate = value
+	}
+	format, fileType, subfolder, path, err := videoCombineTarget(inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	frames, err := videoFrames()
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if format == "image/gif" {
+		data, err = encodeGIF(frames, frameRate)
+	} else {
+		data, err = encodeMJPEGMP4(frames, frameRate)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeFile(path, data); err != nil {
+		return nil, err
+	}
+
+	fullpath, _ := filepath.Abs(path)
+	return map[string]interface{}{
+		"gifs": []map[string]interface{}{
+			{
+				"filename":   filepath.Base(path),
+				"subfolder":  subfolder,
+				"type":       fileType,
+				"format":     format,
+				"frame_rate": frameRate,
+				"fullpath":   fullpath,
+			},
+		},
+	}, nil
+}
+
+// videoCombineTarget 按 VHS_VideoCombine 的输入返回输出格式和下一个输出文件的路径。
+// 只能生成 GIF 和 MJPEG 编码的 MP4 容器，其他格式统一输出 MP4。
+// format 返回与文件内容一致的 video/mp4，而不是 VHS 的 video/h264-mp4，避免 client 按 H.264 解码
+func videoCombineTarget(inputs map[string]interface{}) (format, fileType, subfolder, path string, err error) {
+	format, _ = inputs["format"].(string)
+	ext := "gif"
+	if format == "" {
+		format = "image/gif"
+	}
+	if format != "image/gif" {
+		format = "video/mp4"
+		ext = "mp4"
+	}
+	prefix, _ := inputs["filename_prefix"].(string)
+	if prefix == "" {
+		prefix = "AnimateDiff"
+	}
+	fileType = "output"
+	if saveOutput, ok := inputs["save_output"].(bool); ok && !saveOutput {
+		fileType = "temp"
+	}
+
+	subfolder = filepath.ToSlash(filepath.Dir(prefix))
+	if subfolder == "." {
+		subfolder = ""
+	}
+	// 与 ComfyUI 的 get_save_image_path 一致，不允许 filename_prefix 指向输出目录之外
+	first, err := resolveFilePath(fileType, subfolder, filepath.Base(prefix))
+	if err != nil {
+		return "", "", "", "", fmt.Errorf("filename_prefix 不能指向 %s 目录之外: %s", fileType, prefix)
+	}
+	return format, fileType, subfolder, nextCounterPath(filepath.Dir(first), filepath.Base(prefix), ext), nil
+}
+
+// nextCounterPath 与 VideoHelperSuite 一致，生成 prefix_00001.ext 形式的文件名，in-memory 模式下的文件同样占用编号
+func nextCounterPath(dir, prefix, ext string) string {
+	for counter := 1; ; counter++ {
+		path := filepath.Join(dir, fmt.Sprintf("%s_%05d.%s", prefix, counter, ext))
+		if !outputFileExists(path) {
+			return path
+		}
+	}
+}
+
+// videoFrames 将固定图片缩小后逐帧横向平移，生成一段可见变化的动画
+func videoFrames() ([]image.Image, error) {
+	src, err := decodeImageFixture()
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > videoMaxWidth {
+		height = height * videoMaxWidth / width
+		width = videoMaxWidth
+	}
+	// MJPEG 和大多数播放器要求偶数尺寸
+	width, height = width&^1, height&^1
+
+	frames := make([]image.Image, videoFrameCount)
+	for i := range frames {
+		shift := i * width / videoFrameCount
+		frame := image.NewRGBA(image.Rect(0, 0, width, height))
+		for y := 0; y < height; y++ {
+			sy := bounds.Min.Y + y*bounds.Dy()/height
+			for x := 0; x < width; x++ {
+				sx := bounds.Min.X + ((x+shift)%width)*bounds.Dx()/width
+				frame.Set(x, y, src.At(sx, sy))
+			}
+		}
+		frames[i] = frame
+	}
+	return frames, nil
+}
+
+func encodeGIF(frames []image.Image, frameRate float64) ([]byte, error) {
+	delay := int(math.Round(100 / frameRate))
+	anim := &gif.GIF{}
+	for _, frame := range frames {
+		paletted := image.NewPaletted(frame.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), frame, image.Point{})
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, delay)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		return nil, fmt.Errorf("编码 GIF 失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeMJPEGMP4 生成一个只有单条 MJPEG 视频轨的最小 MP4 文件
+func encodeMJPEGMP4(frames []image.Image, frameRate float64) ([]byte, error) {
+	const timescale = 90000
+	delta := uint32(math.Round(timescale / frameRate))
+
+	samples := make([][]byte, len(frames))
+	for i, frame := range frames {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, frame, &jpeg.Options{Quality: 75}); err != nil {
+			return nil, fmt.Errorf("编码视频帧失败: %w", err)
+		}
+		samples[i] = buf.Bytes()
+	}
+
+	bounds := frames[0].Bounds()
+	width, height := uint32(bounds.Dx()), uint32(bounds.Dy())
+	count := uint32(len(samples))
+	duration := count * delta
+
+	ftyp := mp4Box("ftyp", []byte("isom"), u32(512), []byte("isomiso2mp41"))
+
+	var payload []byte
+	sizes := make([]byte, 0, 4*len(samples))
+	for _, sample := range samples {
+		payload = append(payload, sample...)
+		sizes = append(sizes, u32(uint32(len(sample)))...)
+	}
+	mdat := mp4Box("mdat", payload)
+	chunkOffset := uint32(len(ftyp) + 8)
+
+	matrix := concat(u32(0x00010000), u32(0), u32(0), u32(0), u32(0x00010000), u32(0), u32(0), u32(0), u32(0x40000000))
+
+	mvhd := mp4FullBox("mvhd", 0, 0,
+		u32(0), u32(0), u32(timescale), u32(duration),
+		u32(0x00010000), u16(0x0100), make([]byte, 10), matrix, make([]byte, 24), u32(2))
+
+	tkhd := mp4FullBox("tkhd", 0, 3,
+		u32(0), u32(0), u32(1), u32(0), u32(duration), make([]byte, 8),
+		u16(0), u16(0), u16(0), u16(0), matrix, u32(width<<16), u32(height<<16))
+
+	mdhd := mp4FullBox("mdhd", 0, 0, u32(0), u32(0), u32(timescale), u32(duration), u16(0x55c4), u16(0))
+	hdlr := mp4FullBox("hdlr", 0, 0, u32(0), []byte("vide"), make([]byte, 12), []byte("VideoHandler\x00"))
+
+	compressorName := make([]byte, 32)
+	copy(compressorName[1:], "Photo - JPEG")
+	compressorName[0] = byte(len("Photo - JPEG"))
+	sampleEntry := mp4Box("jpeg",
+		make([]byte, 6), u16(1), u16(0), u16(0), make([]byte, 12),
+		u16(uint16(width)), u16(uint16(height)), u32(0x00480000), u32(0x00480000),
+		u32(0), u16(1), compressorName, u16(0x0018), u16(0xffff))
+
+	stbl := mp4Box("stbl",
+		mp4FullBox("stsd", 0, 0, u32(1), sampleEntry),
+		mp4FullBox("stts", 0, 0, u32(1), u32(count), u32(delta)),
+		mp4FullBox("stsc", 0, 0, u32(1), u32(1), u32(count), u32(1)),
+		mp4FullBox("stsz", 0, 0, u32(0), u32(count), sizes),
+		mp4FullBox("stco", 0, 0, u32(1), u32(chunkOffset)),
+	)
+	minf := mp4Box("minf",
+		mp4FullBox("vmhd", 0, 1, u16(0), u16(0), u16(0), u16(0)),
+		mp4Box("dinf", mp4FullBox("dref", 0, 0, u32(1), mp4FullBox("url ", 0, 1))),
+		stbl,
+	)
+	moov := mp4Box("moov", mvhd, mp4Box("trak", tkhd, mp4Box("mdia", mdhd, hdlr, minf)))
+
+	return concat(ftyp, mdat, moov), nil
+}
+
+func mp4Box(boxType string, parts ...[]byte) []byte {
+	payload := concat(parts...)
+	return concat(u32(uint32(8+len(payload))), []byte(boxType), payload)
+}
+
+func mp4FullBox(boxType string, version byte, flags uint32, parts ...[]byte) []byte {
+	header := u32(uint32(version)<<24 | flags&0xffffff)
+	return mp4Box(boxType, append([][]byte{header}, parts...)...)
+}
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func u16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func concat(parts ...[]byte) []byte {
+	var buf bytes.Buffer
+	for _, part := range parts {
+		buf.Write(part)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (m *ComfyUIMock) handleView(c *gin.Context) {
+	filename := c.Query("filename")
+	if filename == "" {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	fileType := c.DefaultQuery("type", "output")
+	path, err := resolveFilePath(fileType, c.Query("subfolder"), filename)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	// 输入文件始终在本地，输出和临时文件从对象存储读取
+	if m.objects != nil && fileType != "input" {
+		m.viewObject(c, objectKey(fileType, c.Query("subfolder"), filename))
+		return
+	}
+
+	if m.cfg.ViewTamperRate > 0 && rand.Float64() < m.cfg.ViewTamperRate && serveTampered(c, path, m.cfg.ViewTamperModes) {
+		return
+	}
+
+	if preview, ok := previewQuery(c); ok && m.servePreview(c, path, parsePreview(preview)) {
+		return
+	}
+
+	if inMemoryOutputs && fileType != "input" && serveMemFile(c, path, m.cfg.ViewETag) {
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	serveContent(c, path, info.ModTime(), file, m.cfg.ViewETag)
+}
+
+// serveContent 返回文件内容，带有 Content-Length 和 Last-Modified，支持 Range 和 If-Modified-Since。
+// etag 为 true 时按内容的 SHA-256 计算 ETag，支持 If-None-Match 和 If-Range
+func serveContent(c *gin.Context, path string, modTime time.Time, content io.ReadSeeker, etag bool) {
+	if etag {
+		hash := sha256.New()
+		if _, err := io.Copy(hash, content); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err := content.Seek(0, io.SeekStart); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("ETag", `"`+hex.EncodeToString(hash.Sum(nil)[:16])+`"`)
+	}
+	http.ServeContent(c.Writer, c.Request, filepath.Base(path), modTime, content)
+}
+
+// viewObject 按 --s3-view 重定向到预签名 URL，或由 mock 代理读取
+func (m *ComfyUIMock) viewObject(c *gin.Context, key string) {
+	if m.cfg.S3View != "proxy" {
+		target, err := m.objects.PresignGet(key, 15*time.Minute)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Redirect(http.StatusFound, target)
+		return
+	}
+
+	resp, err := m.objects.Get(key)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	for _, header := range []string{"Content-Type", "Content-Length", "ETag", "Last-Modified"} {
+		if value := resp.Header.Get(header); value != "" {
+			c.Header(header, value)
+		}
+	}
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, resp.Body)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+const mib = 1024 * 1024
+
+// allocateVRAM 为即将执行的 prompt 分配显存，调用方需持有锁
+func (m *ComfyUIMock) allocateVRAM(prompt *PromptInfo) error {
+	need := m.cfg.VRAMPerPromptMB * mib
+	total := m.cfg.VRAMTotalMB * mib
+	if m.vramUsed+need > total {
+		return fmt.Errorf("CUDA out of memory. Tried to allocate %d MiB (GPU 0; %d MiB total capacity; %d MiB already allocated)",
+			m.cfg.VRAMPerPromptMB, m.cfg.VRAMTotalMB, m.vramUsed/mib)
+	}
+	m.vramUsed += need
+	prompt.vram = need
+	return nil
+}
+
+// releaseVRAM 在 prompt 执行结束后释放它占用的显存，--vram-keep-models 时模型一直占用显存直到 /free，调用方需持有锁
+func (m *ComfyUIMock) releaseVRAM(prompt *PromptInfo) {
+	if !m.cfg.VRAMKeepModels {
+		// /free 和模拟崩溃会清空显存，不能减到负数
+		m.vramUsed = max(0, m.vramUsed-prompt.vram)
+	}
+	prompt.vram = 0
+}
+
+// loadModels 模拟第一次执行时加载 checkpoint 的耗时，加载期间 loader 节点处于 executing 状态
+func (m *ComfyUIMock) loadModels(ctx context.Context, prompt *PromptInfo) {
+	if m.cfg.ColdStart <= 0 {
+		return
+	}
+
+	nodeID, _ := findNode(prompt.Prompt, "CheckpointLoaderSimple", "CheckpointLoader", "UNETLoader")
+	if nodeID != "" {
+		m.sendExecuting(prompt, nodeID)
+	}
+	sleepCtx(ctx, m.cfg.ColdStart)
+}
+
+func (m *ComfyUIMock) handleSystemStats(c *gin.Context) {
+	m.mu.Lock()
+	vramUsed := m.vramUsed
+	m.mu.Unlock()
+	vramTotal := m.cfg.VRAMTotalMB * mib
+
+	system := gin.H{
+		"os":              runtime.GOOS,
+		"python_version":  "3.10.12 (mock)",
+		"embedded_python": false,
+		"pytorch_version": "2.3.1+cu121",
+		"argv":            []string{"main.py"},
+		"ram_total":       int64(32768) * mib,
+		"ram_free":        int64(16384) * mib,
+	}
+	// 旧版本的 /system_stats 没有 comfyui_version
+	if m.compat.version != "" {
+		system["comfyui_version"] = m.compat.version
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"system": system,
+		"devices": []gin.H{
+			{
+				"name":             "cuda:0 NVIDIA GeForce RTX 4090 : cudaMallocAsync",
+				"type":             "cuda",
+				"index":            0,
+				"vram_total":       vramTotal,
+				"vram_free":        vramTotal - vramUsed,
+				"torch_vram_total": vramUsed,
+				"torch_vram_free":  0,
+			},
+		},
+	})
+}
+
+func (m *ComfyUIMock) handleFree(c *gin.Context) {
+	var request struct {
+		UnloadModels bool `json:"unload_models"`
+		FreeMemory   bool `json:"free_memory"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.UnloadModels || request.FreeMemory {
+		m.mu.Lock()
+		m.vramUsed = 0
+		m.modelsLoaded = false
+		m.mu.Unlock()
+	}
+
+	c.Status(http.StatusOK)
+}
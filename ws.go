@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// 与 ComfyUI server.py 中的 BinaryEventTypes 保持一致
+const (
+	binaryEventPreviewImage = 1
+	imageFormatJPEG         = 1
+	imageFormatPNG          = 2
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// eventClient 是接收执行事件的连接，WebSocket 和 SSE 共用同一套路由
+type eventClient interface {
+	writeJSON(v interface{}) error
+	writeBinary(data []byte) error
+	close()
+}
+
+type wsClient struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+	// queue 非 nil 时消息通过发送队列异步写出，用于模拟慢速客户端
+	queue *sendQueue
+}
+
+func newWSClient(conn *websocket.Conn, backpressure wsBackpressure) *wsClient {
+	client := &wsClient{conn: conn}
+	if backpressure.enabled() {
+		client.queue = newSendQueue(client, backpressure)
+	}
+	return client
+}
+
+func (c *wsClient) writeJSON(v interface{}) error {
+	if c.queue != nil {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return c.queue.push(websocket.TextMessage, data)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.WriteJSON(v)
+}
+
+func (c *wsClient) writeBinary(data []byte) error {
+	if c.queue != nil {
+		return c.queue.push(websocket.BinaryMessage, data)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.WriteMessage(websocket.BinaryMessage, data)
+}
+
+func (c *wsClient) close() {
+	if c.queue != nil {
+		c.queue.stop()
+	}
+	c.conn.Close()
+}
+
+// closeWith 发送 close 帧后关闭连接，WriteControl 可以与其他写操作并发调用
+func (c *wsClient) closeWith(code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	c.close()
+}
+
+// wsHub 按 sid 管理 WebSocket 和 SSE 连接，同一个 client_id 可以有多个连接
+type wsHub struct {
+	mu       sync.Mutex
+	clients  map[string][]eventClient
+	recorder *recorder
+	// broadcastAll 为 true 时执行事件也发送给所有连接，便于调试
+	broadcastAll bool
+	// multiSocket 为 true 时同一个 clientId 允许多个 WebSocket 连接，否则新连接会替换旧连接
+	multiSocket  bool
+	backpressure wsBackpressure
+	// instance 非 nil 时在每条消息中标记集群模式下的虚拟实例编号
+	instance *int
+	// compat 按 --compat 版本调整消息格式
+	compat compatProfile
+	// partition 非 nil 时模拟只影响 WebSocket 的网络分区
+	partition *wsPartition
+	// faults 按 --ws-duplicate 和 --ws-reorder 重复或调整消息顺序
+	faults *wsFaults
+}
+
+func newWSHub() *wsHub {
+	return &wsHub{clients: make(map[string][]eventClient), compat: compatProfiles["latest"]}
+}
+
+func (h *wsHub) add(sid string, client eventClient) {
+	h.mu.Lock()
+	h.clients[sid] = append(h.clients[sid], client)
+	h.mu.Unlock()
+}
+
+// replace 与 ComfyUI 一致，同一个 clientId 重新连接时关闭旧的 WebSocket 连接，SSE 等其他连接不受影响
+func (h *wsHub) replace(sid string, client *wsClient) {
+	h.mu.Lock()
+	kept := []eventClient{}
+	old := []*wsClient{}
+	for _, c := range h.clients[sid] {
+		if ws, ok := c.(*wsClient); ok {
+			old = append(old, ws)
+			continue
+		}
+		kept = append(kept, c)
+	}
+	h.clients[sid] = append(kept, client)
+	h.mu.Unlock()
+
+	for _, ws := range old {
+		ws.closeWith(websocket.ClosePolicyViolation, "replaced by a new connection with the same clientId")
+	}
+}
+
+// count 返回当前的连接数
+func (h *wsHub) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	total := 0
+	for _, clients := range h.clients {
+		total += len(clients)
+	}
+	return total
+}
+
+// remove 移除一个连接，sid 没有其他连接时返回 true
+func (h *wsHub) remove(sid string, client eventClient) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	clients := h.clients[sid]
+	for i, c := range clients {
+		if c == client {
+			clients = append(clients[:i:i], clients[i+1:]...)
+			break
+		}
+	}
+	if len(clients) == 0 {
+		delete(h.clients, sid)
+		return true
+	}
+	h.clients[sid] = clients
+	return false
+}
+
+// targets 返回消息的接收方：与 ComfyUI 一致，sid 为空时发给所有连接
+func (h *wsHub) targets(sid string) map[string][]eventClient {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	targets := map[string][]eventClient{}
+	if sid == "" || h.broadcastAll {
+		for target, clients := range h.clients {
+			targets[target] = append([]eventClient(nil), clients...)
+		}
+		return targets
+	}
+	if clients, ok := h.clients[sid]; ok {
+		targets[sid] = append([]eventClient(nil), clients...)
+	}
+	return targets
+}
+
+// message 构造 JSON 消息，按 --compat 版本调整字段，集群模式下带上实例编号
+func (h *wsHub) message(msgType string, data interface{}) gin.H {
+	message := gin.H{"type": msgType, "data": h.compat.adapt(data)}
+	if h.instance != nil {
+		message["instance"] = *h.instance
+	}
+	return message
+}
+
+// send 向 sid 的所有连接发送 JSON 消息，没有连接时直接丢弃
+func (h *wsHub) send(sid, msgType string, data interface{}) {
+	if !h.compat.allows(msgType) {
+		return
+	}
+	message := h.message(msgType, data)
+	for target, clients := range h.targets(sid) {
+		h.recorder.record(map[string]interface{}{"kind": "ws_out", "sid": target, "message": message})
+		for _, arranged := range h.faults.arrange(target, message) {
+			for _, client := range clients {
+				h.deliver(target, client, func() error { return client.writeJSON(arranged) })
+			}
+		}
+	}
+}
+
+// sendTo 只向一个连接发送消息，用于连接建立时的初始 status
+func (h *wsHub) sendTo(sid string, client eventClient, msgType string, data interface{}) {
+	message := h.message(msgType, data)
+	h.recorder.record(map[string]interface{}{"kind": "ws_out", "sid": sid, "message": message})
+	h.deliver(sid, client, func() error { return client.writeJSON(message) })
+}
+
+// sendBinary 发送带 4 字节事件类型头的二进制消息
+func (h *wsHub) sendBinary(sid string, event uint32, payload []byte) {
+	message := make([]byte, 4, 4+len(payload))
+	binary.BigEndian.PutUint32(message, event)
+	message = append(message, payload...)
+
+	for target, clients := range h.targets(sid) {
+		h.recorder.record(map[string]interface{}{"kind": "ws_binary_out", "sid": target, "data_base64": base64.StdEncoding.EncodeToString(message)})
+		for _, client := range clients {
+			h.deliver(target, client, func() error { return client.writeBinary(message) })
+		}
+	}
+}
+
+// closeAll 直接关闭所有连接，不发送 close 帧，客户端看到的是异常断开
+func (h *wsHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, clients := range h.clients {
+		for _, client := range clients {
+			client.close()
+		}
+	}
+}
+
+// broadcast 向所有连接发送消息，不受 client_id 限制
+func (h *wsHub) broadcast(msgType string, data interface{}) {
+	h.send("", msgType, data)
+}
+
+func (m *ComfyUIMock) handleWebSocket(c *gin.Context) {
+	sid := c.Query("clientId")
+	if sid == "" {
+		sid = strings.ReplaceAll(uuid.New().String(), "-", "")
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	client := newWSClient(conn, m.ws.backpressure)
+	defer client.close()
+
+	if m.ws.multiSocket {
+		m.ws.add(sid, client)
+	} else {
+		m.ws.replace(sid, client)
+	}
+	m.contract.wsOpened(sid)
+	defer func() {
+		m.contract.wsClosed(sid)
+		if m.ws.remove(sid, client) {
+			m.clientDisconnected(sid)
+		}
+	}()
+
+	m.recorder.record(map[string]interface{}{"kind": "ws_connect", "sid": sid, "client_ip": c.ClientIP()})
+	defer m.recorder.record(map[string]interface{}{"kind": "ws_disconnect", "sid": sid})
+
+	m.mu.Lock()
+	delete(m.disconnected, sid)
+	status := m.statusData()
+	m.mu.Unlock()
+	status["sid"] = sid
+	m.ws.sendTo(sid, client, "status", status)
+
+	// ComfyUI 不处理客户端发来的消息，只需读到连接关闭为止
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		entry := map[string]interface{}{"kind": "ws_in", "sid": sid}
+		setBody(entry, "message", data)
+		m.recorder.record(entry)
+	}
+}
+
+// statusData 构造 status 消息内容，调用方需持有锁
+func (m *ComfyUIMock) statusData() gin.H {
+	remaining := len(m.pendingPrompts())
+	if m.runningTask != nil {
+		remaining++
+	}
+	return gin.H{"status": gin.H{"exec_info": gin.H{"queue_remaining": remaining}}}
+}
+
+func (m *ComfyUIMock) broadcastStatus() {
+	m.mu.Lock()
+	status := m.statusData()
+	m.mu.Unlock()
+	m.ws.broadcast("status", status)
+}
+
+// sendWebsocketImage 模拟 SaveImageWebsocket 节点，以 PNG 格式发送输出图片
+func (m *ComfyUIMock) sendWebsocketImage(sid string) {
+	img, err := decodeImageFixture()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, imageFormatPNG)
+	buf.Write(header)
+	if err := png.Encode(&buf, img); err != nil {
+		fmt.Printf("编码 PNG 失败: %v\n", err)
+		return
+	}
+
+	m.ws.sendBinary(sid, binaryEventPreviewImage, buf.Bytes())
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// wsFaults 模拟高负载下 ComfyUI 偶尔出现的消息重复和乱序，用于检验客户端状态机的健壮性
+type wsFaults struct {
+	// duplicate 中的消息类型会连续发送两次
+	duplicate map[string]bool
+	// reorder 为 true 时 executed 会先于它之前的最后一条进度消息发出
+	reorder bool
+	rate    float64
+
+	mu sync.Mutex
+	// held 是每个 sid 暂缓发送的进度消息
+	held map[string]gin.H
+}
+
+func newWSFaults(duplicate string, reorder bool, rate float64) (*wsFaults, error) {
+	if rate < 0 || rate > 1 {
+		return nil, fmt.Errorf("--ws-fault-rate 必须在 0 到 1 之间: %v", rate)
+	}
+	f := &wsFaults{duplicate: map[string]bool{}, reorder: reorder, rate: rate, held: map[string]gin.H{}}
+	for _, msgType := range strings.Split(duplicate, ",") {
+		if msgType = strings.TrimSpace(msgType); msgType != "" {
+			f.duplicate[msgType] = true
+		}
+	}
+	return f, nil
+}
+
+func (f *wsFaults) enabled() bool {
+	return f != nil && (f.reorder || len(f.duplicate) > 0)
+}
+
+// isProgressMessage 判断是否为节点执行中的进度消息，executing 只有带节点时才算
+func isProgressMessage(message gin.H) bool {
+	switch message["type"] {
+	case "progress", "progress_state":
+		return true
+	case "executing":
+		data, _ := message["data"].(gin.H)
+		return data["node"] != nil
+	}
+	return false
+}
+
+// arrange 返回发给 sid 的实际消息序列，可能为空（消息被暂缓）或包含之前暂缓的消息
+func (f *wsFaults) arrange(sid string, message gin.H) []gin.H {
+	if !f.enabled() {
+		return []gin.H{message}
+	}
+
+	messages := []gin.H{message}
+	if f.reorder {
+		f.mu.Lock()
+		held, ok := f.held[sid]
+		delete(f.held, sid)
+		if isProgressMessage(message) && rand.Float64() < f.rate {
+			f.held[sid] = message
+			messages = nil
+		}
+		f.mu.Unlock()
+
+		if ok {
+			if message["type"] == "executed" {
+				messages = append(messages, held)
+			} else {
+				messages = append([]gin.H{held}, messages...)
+			}
+		}
+	}
+
+	arranged := make([]gin.H, 0, len(messages))
+	for _, m := range messages {
+		arranged = append(arranged, m)
+		if msgType, _ := m["type"].(string); f.duplicate[msgType] && rand.Float64() < f.rate {
+			arranged = append(arranged, m)
+		}
+	}
+	return arranged
+}